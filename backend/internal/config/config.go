@@ -3,8 +3,11 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 )
 
 // config holds all application configuration
@@ -13,17 +16,24 @@ type Config struct {
 	Database DatabaseConfig
 	Storage  StorageConfig
 	Security SecurityConfig
+	Mail     MailConfig
+	OIDC     OIDCConfig
 }
 
 // server configuration
 type ServerConfig struct {
-	Port               string
-	AllowedOrigins     string
-	Environment        string
-	JWTSecret          string
-	JWTRefreshSecret   string
-	JWTExpiry          time.Duration
-	JWTRefreshExpiry   time.Duration
+	Port             string
+	AllowedOrigins   string
+	TrustedProxies   string // comma-separated proxy IPs/CIDRs whose X-Forwarded-For is believed; empty trusts none
+	Environment      string
+	JWTSecret        string
+	JWTRefreshSecret string
+	JWTExpiry        time.Duration
+	JWTRefreshExpiry time.Duration
+	JWTIssuer        string // iss claim written to and required on every token
+	JWTAudience      string // aud claim written to and required on every token
+	JWTKeysDir       string // directory of RS256/EdDSA PEM keys; empty signs with the HS256 secrets
+	JWTSigningKeyID  string // kid of the key to sign with; empty picks the last private key by name
 }
 
 // database configuration
@@ -36,16 +46,102 @@ type DatabaseConfig struct {
 
 // storage configuration
 type StorageConfig struct {
-	UploadDir      string
-	MaxFileSize    int64
-	ExpirationDays int
+	Backend          string // "local" or "s3"
+	UploadDir        string
+	MaxFileSize      int64
+	ExpirationDays   int           // default lifetime when a client doesn't ask for one
+	MaxExpiration    time.Duration // longest lifetime a client may ask for
+	UploadSessionTTL time.Duration // idle time before a resumable upload is abandoned
+	CodeAlphabet     string        // characters used for short share codes
+	CodeLength       int
+	S3               S3Config
+
+	// quotas on the shares one owner keeps at a time; 0 is unlimited. users can be given
+	// their own by an admin, anonymous uploads are counted per client address.
+	UserQuotaBytes      int64
+	UserQuotaItems      int
+	AnonymousQuotaBytes int64
+	AnonymousQuotaItems int
+
+	// global capacity guard; uploads are refused once either is reached
+	MaxTotalBytes        int64 // all stored file bytes together; 0 is unlimited
+	HighWatermarkPercent int   // fullness of the local upload directory's disk; 0 disables
+
+	FileTypes FileTypeConfig
+}
+
+// upload file type policy, applied to the filename's extension and to the type sniffed
+// from the file's first bytes. deny lists win; a nil allow list admits anything not denied.
+type FileTypeConfig struct {
+	AllowedTypes      []string // mime types, or "image/*" for a whole family
+	DeniedTypes       []string
+	AllowedExtensions []string // lowercase with the leading dot; a file without one never matches
+	DeniedExtensions  []string
+}
+
+// s3-compatible blob storage configuration (AWS, MinIO, R2, Tigris, ...)
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	PathStyle bool
+}
+
+// mail configuration
+type MailConfig struct {
+	Backend      string // "log", "file" or "smtp"
+	From         string
+	AppURL       string // base url of the frontend, used for links in emails
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	FileDir      string // where the file backend drops .eml files
+}
+
+// oidc configuration for signing in through external identity providers
+type OIDCConfig struct {
+	RedirectURL string // where providers send the browser back; the frontend posts code and state to the api
+	Providers   []OIDCProviderConfig
+}
+
+// oidc provider configuration, read from OIDC_<ID>_* variables
+type OIDCProviderConfig struct {
+	ID           string // used in urls and stored with linked identities
+	Name         string // shown on the login button
+	Issuer       string // discovery is fetched from <issuer>/.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string // empty for public clients, which rely on PKCE alone
+	Scopes       []string
 }
 
 // security configuration
 type SecurityConfig struct {
-	AdminSecret     string
-	RateLimitPerSec int
-	RateLimitBurst  int
+	AdminSecret      string
+	AllowAdminSecret bool // accept the legacy X-Admin-Secret header on /api/admin alongside admin accounts
+	RateLimitPerSec  int
+	RateLimitBurst   int
+	RevocationStore  string // "database" or "memory"; where revoked access tokens are remembered
+
+	// failed login and passcode attempts; after LockoutFreeAttempts failures each further
+	// one locks the account or share for LockoutBase, doubling up to LockoutMax
+	AttemptStore        string // "database" or "memory"
+	LockoutFreeAttempts int
+	LockoutBase         time.Duration
+	LockoutMax          time.Duration
+	LockoutWindow       time.Duration // failures are forgotten this long after the last one
+
+	TOTPIssuer      string        // name authenticator apps show next to the account
+	MFAChallengeTTL time.Duration // how long a login has to supply its second factor
+
+	RequireEmailVerification bool // unverified accounts can't log in
+	EmailVerificationTTL     time.Duration
+	PasswordResetTTL         time.Duration
+
+	AuditRetentionDays int // audit events older than this are pruned; 0 keeps them forever
 }
 
 // load reads configuration from environment variables
@@ -54,11 +150,16 @@ func Load() *Config {
 		Server: ServerConfig{
 			Port:             getEnv("PORT", "8080"),
 			AllowedOrigins:   getEnv("ALLOWED_ORIGINS", "*"),
+			TrustedProxies:   getEnv("TRUSTED_PROXIES", ""),
 			Environment:      getEnv("ENVIRONMENT", "development"),
 			JWTSecret:        getEnv("JWT_SECRET", devJWTSecret),
 			JWTRefreshSecret: getEnv("JWT_REFRESH_SECRET", devJWTRefreshSecret),
 			JWTExpiry:        time.Duration(getEnvAsInt("JWT_EXPIRY_HOURS", 1)) * time.Hour,
 			JWTRefreshExpiry: time.Duration(getEnvAsInt("JWT_REFRESH_EXPIRY_DAYS", 7)) * 24 * time.Hour,
+			JWTIssuer:        getEnv("JWT_ISSUER", "konbi"),
+			JWTAudience:      getEnv("JWT_AUDIENCE", "konbi-api"),
+			JWTKeysDir:       getEnv("JWT_KEYS_DIR", ""),
+			JWTSigningKeyID:  getEnv("JWT_SIGNING_KEY_ID", ""),
 		},
 		Database: DatabaseConfig{
 			URL:            getEnv("DATABASE_URL", ""),
@@ -67,29 +168,189 @@ func Load() *Config {
 			ConnMaxLife:    time.Duration(getEnvAsInt("DB_CONN_MAX_LIFE_MINUTES", 5)) * time.Minute,
 		},
 		Storage: StorageConfig{
-			UploadDir:      getEnv("UPLOAD_DIR", "uploads"),
-			MaxFileSize:    int64(getEnvAsInt("MAX_FILE_SIZE_MB", 50)) * 1024 * 1024,
-			ExpirationDays: getEnvAsInt("EXPIRATION_DAYS", 7),
+			Backend:          getEnv("STORAGE_BACKEND", "local"),
+			UploadDir:        getEnv("UPLOAD_DIR", "uploads"),
+			MaxFileSize:      int64(getEnvAsInt("MAX_FILE_SIZE_MB", 50)) * 1024 * 1024,
+			ExpirationDays:   getEnvAsInt("EXPIRATION_DAYS", 7),
+			MaxExpiration:    time.Duration(getEnvAsInt("MAX_EXPIRATION_DAYS", 30)) * 24 * time.Hour,
+			UploadSessionTTL: time.Duration(getEnvAsInt("UPLOAD_SESSION_TTL_HOURS", 24)) * time.Hour,
+			CodeAlphabet:     getEnv("SHARE_CODE_ALPHABET", DefaultCodeAlphabet),
+			CodeLength:       getEnvAsInt("SHARE_CODE_LENGTH", 6),
+
+			UserQuotaBytes:       int64(getEnvAsInt("USER_QUOTA_MB", 1024)) * 1024 * 1024,
+			UserQuotaItems:       getEnvAsInt("USER_QUOTA_ITEMS", 1000),
+			AnonymousQuotaBytes:  int64(getEnvAsInt("ANONYMOUS_QUOTA_MB", 200)) * 1024 * 1024,
+			AnonymousQuotaItems:  getEnvAsInt("ANONYMOUS_QUOTA_ITEMS", 50),
+			MaxTotalBytes:        int64(getEnvAsInt("STORAGE_MAX_TOTAL_MB", 0)) * 1024 * 1024,
+			HighWatermarkPercent: getEnvAsInt("STORAGE_HIGH_WATERMARK_PERCENT", 90),
+			FileTypes: FileTypeConfig{
+				AllowedTypes:      getEnvAsList("UPLOAD_ALLOWED_TYPES", "*"),
+				DeniedTypes:       getEnvAsList("UPLOAD_DENIED_TYPES", defaultDeniedTypes),
+				AllowedExtensions: extensions(getEnvAsList("UPLOAD_ALLOWED_EXTENSIONS", defaultAllowedExtensions)),
+				DeniedExtensions:  extensions(getEnvAsList("UPLOAD_DENIED_EXTENSIONS", defaultDeniedExtensions)),
+			},
+			S3: S3Config{
+				Endpoint:  getEnv("S3_ENDPOINT", ""),
+				Region:    getEnv("S3_REGION", "us-east-1"),
+				Bucket:    getEnv("S3_BUCKET", ""),
+				AccessKey: getEnv("S3_ACCESS_KEY", ""),
+				SecretKey: getEnv("S3_SECRET_KEY", ""),
+				UseSSL:    getEnvAsBool("S3_USE_SSL", true),
+				PathStyle: getEnvAsBool("S3_PATH_STYLE", false),
+			},
 		},
 		Security: SecurityConfig{
-			AdminSecret:     getEnv("ADMIN_SECRET", ""),
-			RateLimitPerSec: getEnvAsInt("RATE_LIMIT_PER_SEC", 10),
-			RateLimitBurst:  getEnvAsInt("RATE_LIMIT_BURST", 10),
+			AdminSecret:      getEnv("ADMIN_SECRET", ""),
+			AllowAdminSecret: getEnvAsBool("ALLOW_ADMIN_SECRET", false),
+			RateLimitPerSec:  getEnvAsInt("RATE_LIMIT_PER_SEC", 10),
+			RateLimitBurst:   getEnvAsInt("RATE_LIMIT_BURST", 10),
+			RevocationStore:  getEnv("TOKEN_REVOCATION_STORE", "database"),
+
+			AttemptStore:        getEnv("ATTEMPT_STORE", "database"),
+			LockoutFreeAttempts: getEnvAsInt("LOCKOUT_FREE_ATTEMPTS", 5),
+			LockoutBase:         time.Duration(getEnvAsInt("LOCKOUT_BASE_SECONDS", 30)) * time.Second,
+			LockoutMax:          time.Duration(getEnvAsInt("LOCKOUT_MAX_MINUTES", 15)) * time.Minute,
+			LockoutWindow:       time.Duration(getEnvAsInt("LOCKOUT_WINDOW_MINUTES", 60)) * time.Minute,
+
+			TOTPIssuer:      getEnv("TOTP_ISSUER", "konbi"),
+			MFAChallengeTTL: time.Duration(getEnvAsInt("MFA_CHALLENGE_TTL_MINUTES", 5)) * time.Minute,
+
+			RequireEmailVerification: getEnvAsBool("REQUIRE_EMAIL_VERIFICATION", false),
+			EmailVerificationTTL:     time.Duration(getEnvAsInt("EMAIL_VERIFICATION_TTL_HOURS", 24)) * time.Hour,
+			PasswordResetTTL:         time.Duration(getEnvAsInt("PASSWORD_RESET_TTL_MINUTES", 60)) * time.Minute,
+
+			AuditRetentionDays: getEnvAsInt("AUDIT_RETENTION_DAYS", 90),
+		},
+		OIDC: loadOIDCConfig(),
+		Mail: MailConfig{
+			Backend:      getEnv("MAIL_BACKEND", "log"),
+			From:         getEnv("MAIL_FROM", "konbi <no-reply@localhost>"),
+			AppURL:       getEnv("APP_URL", "http://localhost:3000"),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			FileDir:      getEnv("MAIL_FILE_DIR", "mail"),
 		},
 	}
 }
 
+// default code alphabet is crockford base32: digits and uppercase letters without I, L, O and U
+const DefaultCodeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// upload policy defaults: the extensions accepted before types were sniffed, and the
+// executable formats the sniffer recognizes, whatever the file is called
+const (
+	defaultAllowedExtensions = ".txt,.pdf,.doc,.docx,.jpg,.jpeg,.png,.gif,.zip,.tar,.gz,.mp4,.mp3,.wav,.csv,.xlsx,.xls,.json,.xml,.md"
+	defaultDeniedExtensions  = ".exe,.dll,.com,.scr,.msi,.bat,.cmd,.ps1,.vbs,.sh,.jar,.apk"
+	defaultDeniedTypes       = "application/vnd.microsoft.portable-executable,application/x-elf,application/x-mach-binary,text/x-shellscript,application/wasm"
+)
+
 const devJWTSecret = "dev-secret-key-change-in-production"
 const devJWTRefreshSecret = "dev-refresh-secret-key-change-in-production"
 
 // Validate returns an error if critical config is unsafe for the current environment
 func (c *Config) Validate() error {
-	if c.Server.Environment == "production" {
-		if c.Server.JWTSecret == "" || c.Server.JWTSecret == devJWTSecret {
-			return fmt.Errorf("JWT_SECRET must be set to a secure value in production")
+	switch c.Storage.Backend {
+	case "local":
+	case "s3":
+		if c.Storage.S3.Endpoint == "" || c.Storage.S3.Bucket == "" {
+			return fmt.Errorf("S3_ENDPOINT and S3_BUCKET must be set when STORAGE_BACKEND=s3")
+		}
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND %q (expected local or s3)", c.Storage.Backend)
+	}
+
+	if c.Storage.UserQuotaBytes < 0 || c.Storage.UserQuotaItems < 0 || c.Storage.AnonymousQuotaBytes < 0 || c.Storage.AnonymousQuotaItems < 0 || c.Storage.MaxTotalBytes < 0 {
+		return fmt.Errorf("storage quotas must not be negative")
+	}
+	if c.Storage.HighWatermarkPercent < 0 || c.Storage.HighWatermarkPercent > 100 {
+		return fmt.Errorf("STORAGE_HIGH_WATERMARK_PERCENT must be between 0 and 100")
+	}
+
+	switch c.Security.RevocationStore {
+	case "database", "memory":
+	default:
+		return fmt.Errorf("unknown TOKEN_REVOCATION_STORE %q (expected database or memory)", c.Security.RevocationStore)
+	}
+
+	switch c.Security.AttemptStore {
+	case "database", "memory":
+	default:
+		return fmt.Errorf("unknown ATTEMPT_STORE %q (expected database or memory)", c.Security.AttemptStore)
+	}
+	if c.Security.LockoutBase <= 0 || c.Security.LockoutMax < c.Security.LockoutBase {
+		return fmt.Errorf("LOCKOUT_MAX_MINUTES must be at least LOCKOUT_BASE_SECONDS, and both positive")
+	}
+	if c.Security.LockoutWindow < c.Security.LockoutMax {
+		return fmt.Errorf("LOCKOUT_WINDOW_MINUTES must be at least LOCKOUT_MAX_MINUTES")
+	}
+
+	if c.Security.AuditRetentionDays < 0 {
+		return fmt.Errorf("AUDIT_RETENTION_DAYS must not be negative")
+	}
+
+	if c.Security.AllowAdminSecret && c.Security.AdminSecret == "" {
+		return fmt.Errorf("ADMIN_SECRET must be set when ALLOW_ADMIN_SECRET=true")
+	}
+
+	switch c.Mail.Backend {
+	case "log", "file":
+	case "smtp":
+		if c.Mail.SMTPHost == "" {
+			return fmt.Errorf("SMTP_HOST must be set when MAIL_BACKEND=smtp")
+		}
+	default:
+		return fmt.Errorf("unknown MAIL_BACKEND %q (expected log, file or smtp)", c.Mail.Backend)
+	}
+
+	seenProviders := map[string]bool{}
+	for _, p := range c.OIDC.Providers {
+		if p.ID == "" || strings.Trim(p.ID, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+			return fmt.Errorf("OIDC_PROVIDERS entries may only contain lowercase letters, digits and dashes, got %q", p.ID)
+		}
+		if seenProviders[p.ID] {
+			return fmt.Errorf("OIDC provider %q is listed twice", p.ID)
+		}
+		seenProviders[p.ID] = true
+		if p.Issuer == "" || p.ClientID == "" {
+			return fmt.Errorf("OIDC provider %q needs an issuer and a client id", p.ID)
+		}
+	}
+	if len(c.OIDC.Providers) > 0 && c.OIDC.RedirectURL == "" {
+		return fmt.Errorf("OIDC_REDIRECT_URL must be set when OIDC providers are configured")
+	}
+
+	if c.Storage.ExpirationDays < 1 {
+		return fmt.Errorf("EXPIRATION_DAYS must be at least 1")
+	}
+	if c.Storage.MaxExpiration < time.Duration(c.Storage.ExpirationDays)*24*time.Hour {
+		return fmt.Errorf("MAX_EXPIRATION_DAYS must not be less than EXPIRATION_DAYS")
+	}
+
+	for _, t := range slices.Concat(c.Storage.FileTypes.AllowedTypes, c.Storage.FileTypes.DeniedTypes) {
+		major, minor, ok := strings.Cut(t, "/")
+		if !ok || major == "" || major == "*" || minor == "" || strings.ContainsAny(minor, "/;") {
+			return fmt.Errorf("UPLOAD_ALLOWED_TYPES and UPLOAD_DENIED_TYPES take types like image/png or image/*, got %q", t)
 		}
-		if c.Server.JWTRefreshSecret == "" || c.Server.JWTRefreshSecret == devJWTRefreshSecret {
-			return fmt.Errorf("JWT_REFRESH_SECRET must be set to a secure value in production")
+	}
+
+	if err := validateCodeAlphabet(c.Storage.CodeAlphabet); err != nil {
+		return err
+	}
+	if c.Storage.CodeLength < 4 || c.Storage.CodeLength > 32 {
+		return fmt.Errorf("SHARE_CODE_LENGTH must be between 4 and 32")
+	}
+
+	if c.Server.Environment == "production" {
+		// secrets are only used when tokens aren't signed with keys from JWT_KEYS_DIR
+		if c.Server.JWTKeysDir == "" {
+			if c.Server.JWTSecret == "" || c.Server.JWTSecret == devJWTSecret {
+				return fmt.Errorf("JWT_SECRET must be set to a secure value in production")
+			}
+			if c.Server.JWTRefreshSecret == "" || c.Server.JWTRefreshSecret == devJWTRefreshSecret {
+				return fmt.Errorf("JWT_REFRESH_SECRET must be set to a secure value in production")
+			}
 		}
 		if c.Server.AllowedOrigins == "*" || c.Server.AllowedOrigins == "" {
 			return fmt.Errorf("ALLOWED_ORIGINS must be set to explicit origins in production")
@@ -98,6 +359,47 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// validate code alphabet requires at least two distinct printable ascii characters that are safe in a url path
+func validateCodeAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return fmt.Errorf("SHARE_CODE_ALPHABET must contain at least 2 characters")
+	}
+	seen := map[rune]bool{}
+	for _, r := range alphabet {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return fmt.Errorf("SHARE_CODE_ALPHABET may only contain ascii letters and digits")
+		}
+		if seen[r] {
+			return fmt.Errorf("SHARE_CODE_ALPHABET contains duplicate character %q", r)
+		}
+		seen[r] = true
+	}
+	return nil
+}
+
+// load oidc config reads the providers named in OIDC_PROVIDERS, e.g. "corp" reads OIDC_CORP_ISSUER
+func loadOIDCConfig() OIDCConfig {
+	cfg := OIDCConfig{
+		RedirectURL: getEnv("OIDC_REDIRECT_URL", strings.TrimRight(getEnv("APP_URL", "http://localhost:3000"), "/")+"/auth/callback"),
+	}
+	for _, id := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_")) + "_"
+		cfg.Providers = append(cfg.Providers, OIDCProviderConfig{
+			ID:           id,
+			Name:         getEnv(prefix+"NAME", id),
+			Issuer:       strings.TrimRight(getEnv(prefix+"ISSUER", ""), "/"),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+		})
+	}
+	return cfg
+}
+
 // helper to get env variable with default
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -106,6 +408,31 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// helper to get a comma separated env variable as a lowercase list; "*" gives nil
+func getEnvAsList(key, defaultValue string) []string {
+	value := getEnv(key, defaultValue)
+	if strings.TrimSpace(value) == "*" {
+		return nil
+	}
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// extensions adds the leading dot to extensions listed without one
+func extensions(list []string) []string {
+	for i, ext := range list {
+		if !strings.HasPrefix(ext, ".") {
+			list[i] = "." + ext
+		}
+	}
+	return list
+}
+
 // helper to get env variable as int with default
 func getEnvAsInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
@@ -115,3 +442,13 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// helper to get env variable as bool with default
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
@@ -2,7 +2,9 @@ package errors
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"time"
 )
 
 // app error represents a domain-specific error
@@ -11,6 +13,7 @@ type AppError struct {
 	Message    string
 	StatusCode int
 	Err        error
+	RetryAfter time.Duration // sent as Retry-After when set
 }
 
 // implement error interface
@@ -21,6 +24,14 @@ func (e *AppError) Error() string {
 	return e.Message
 }
 
+// retry after seconds returns RetryAfter rounded up to whole seconds, or 0 if unset
+func (e *AppError) RetryAfterSeconds() int {
+	if e.RetryAfter <= 0 {
+		return 0
+	}
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
 // unwrap returns the underlying error
 func (e *AppError) Unwrap() error {
 	return e.Err
@@ -81,6 +92,16 @@ func NewRateLimitError() *AppError {
 	}
 }
 
+func NewTooManyAttemptsError(retryAfter time.Duration) *AppError {
+	return &AppError{
+		Code:       "TOO_MANY_ATTEMPTS",
+		Message:    "too many failed attempts, try again later",
+		StatusCode: http.StatusTooManyRequests,
+		Err:        nil,
+		RetryAfter: retryAfter,
+	}
+}
+
 func NewConflictError(message string) *AppError {
 	return &AppError{
 		Code:       "CONFLICT",
@@ -90,6 +111,24 @@ func NewConflictError(message string) *AppError {
 	}
 }
 
+func NewGoneError(message string) *AppError {
+	return &AppError{
+		Code:       "GONE",
+		Message:    message,
+		StatusCode: http.StatusGone,
+		Err:        nil,
+	}
+}
+
+func NewBadGatewayError(message string, err error) *AppError {
+	return &AppError{
+		Code:       "BAD_GATEWAY",
+		Message:    message,
+		StatusCode: http.StatusBadGateway,
+		Err:        err,
+	}
+}
+
 // validation errors
 func NewFileTooLargeError(maxSize int64) *AppError {
 	return &AppError{
@@ -117,3 +156,12 @@ func NewContentTooLargeError() *AppError {
 		Err:        nil,
 	}
 }
+
+func NewQuotaExceededError(message string) *AppError {
+	return &AppError{
+		Code:       "QUOTA_EXCEEDED",
+		Message:    message,
+		StatusCode: http.StatusInsufficientStorage,
+		Err:        nil,
+	}
+}
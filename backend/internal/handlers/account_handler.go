@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// account handler handles the signed-in user's account management endpoints
+type AccountHandler struct {
+	service *services.AccountService
+	logger  *logrus.Logger
+}
+
+// create new account handler
+func NewAccountHandler(service *services.AccountService, logger *logrus.Logger) *AccountHandler {
+	return &AccountHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// change password sets a new password, confirmed with the current one
+func (h *AccountHandler) ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	if err := h.service.ChangePassword(c.Request.Context(), tokenClaims(c), &req); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "password changed, other sessions have been logged out",
+	})
+}
+
+// change email moves the account to a new address and sends a verification link to it
+func (h *AccountHandler) ChangeEmail(c *gin.Context) {
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	user, err := h.service.ChangeEmail(c.Request.Context(), tokenClaims(c), &req)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user": user,
+	})
+}
+
+// delete account removes the account and everything it shared
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	if err := h.service.DeleteAccount(c.Request.Context(), tokenClaims(c), req.Password); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// enroll totp starts two-factor setup and returns the authenticator secret
+func (h *AccountHandler) EnrollTOTP(c *gin.Context) {
+	var req models.ConfirmPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	enrollment, err := h.service.EnrollTOTP(c.Request.Context(), tokenClaims(c), req.Password)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// activate totp confirms the enrollment with a code and returns recovery codes
+func (h *AccountHandler) ActivateTOTP(c *gin.Context) {
+	var req models.TOTPActivateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	codes, err := h.service.ActivateTOTP(c.Request.Context(), tokenClaims(c), req.Code)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// disable totp turns two-factor authentication off
+func (h *AccountHandler) DisableTOTP(c *gin.Context) {
+	var req models.TOTPDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	if err := h.service.DisableTOTP(c.Request.Context(), tokenClaims(c), &req); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// regenerate recovery codes returns a new set of recovery codes
+func (h *AccountHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var req models.ConfirmPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(c.Request.Context(), tokenClaims(c), req.Password)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// private helper to respond with error
+func (h *AccountHandler) respondWithError(c *gin.Context, err error) {
+	if appErr, ok := err.(*errors.AppError); ok {
+		h.logger.WithFields(logrus.Fields{
+			"code":    appErr.Code,
+			"message": appErr.Message,
+			"error":   appErr.Err,
+		}).Error("request error")
+
+		if secs := appErr.RetryAfterSeconds(); secs > 0 {
+			c.Header("Retry-After", strconv.Itoa(secs))
+		}
+		c.JSON(appErr.StatusCode, gin.H{
+			"error": appErr.Message,
+			"code":  appErr.Code,
+		})
+		return
+	}
+
+	h.logger.WithError(err).Error("unknown error")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "internal server error",
+		"code":  "INTERNAL_ERROR",
+	})
+}
@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// admin handler handles the moderation endpoints under /api/admin
+type AdminHandler struct {
+	service *services.AdminService
+	logger  *logrus.Logger
+}
+
+// create new admin handler
+func NewAdminHandler(service *services.AdminService, logger *logrus.Logger) *AdminHandler {
+	return &AdminHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// list content returns a filtered page of all content, newest first
+func (h *AdminHandler) ListContent(c *gin.Context) {
+	filter, err := parseContentFilter(c)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	h.listContent(c, filter)
+}
+
+// list content writes the page of content matching filter
+func (h *AdminHandler) listContent(c *gin.Context, filter *models.ContentFilter) {
+	contents, next, err := h.service.ListContent(c.Request.Context(), filter)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	items := make([]gin.H, 0, len(contents))
+	for _, content := range contents {
+		items = append(items, adminContentSummary(content))
+	}
+
+	response := gin.H{
+		"contents": items,
+		"limit":    filter.Limit,
+	}
+	if next != "" {
+		response["next_cursor"] = next
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// delete content soft-deletes one item
+func (h *AdminHandler) DeleteContent(c *gin.Context) {
+	h.single(c, h.service.DeleteContent)
+}
+
+// restore content undoes a soft delete
+func (h *AdminHandler) RestoreContent(c *gin.Context) {
+	h.single(c, h.service.RestoreContent)
+}
+
+// purge content permanently removes one item and its stored files
+func (h *AdminHandler) PurgeContent(c *gin.Context) {
+	h.single(c, h.service.PurgeContent)
+}
+
+// bulk delete content soft-deletes every listed item
+func (h *AdminHandler) BulkDeleteContent(c *gin.Context) {
+	h.bulk(c, h.service.DeleteContent)
+}
+
+// bulk restore content undoes the soft delete of every listed item
+func (h *AdminHandler) BulkRestoreContent(c *gin.Context) {
+	h.bulk(c, h.service.RestoreContent)
+}
+
+// bulk purge content permanently removes every listed item
+func (h *AdminHandler) BulkPurgeContent(c *gin.Context) {
+	h.bulk(c, h.service.PurgeContent)
+}
+
+// single runs action on the :id path parameter
+func (h *AdminHandler) single(c *gin.Context, action func(context.Context, string) error) {
+	if err := action(c.Request.Context(), c.Param("id")); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// bulk runs action on every id in the request body and reports each outcome
+func (h *AdminHandler) bulk(c *gin.Context, action func(context.Context, string) error) {
+	var req models.BulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("request body must list between 1 and 100 ids", nil))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.service.Bulk(c.Request.Context(), req.IDs, action))
+}
+
+// list users returns a filtered page of accounts
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	filter := &models.UserFilter{
+		Search: c.Query("q"),
+		Role:   c.Query("role"),
+		Limit:  limit,
+		Offset: offset,
+	}
+	if filter.Role != "" && !models.ValidRole(filter.Role) {
+		h.respondWithError(c, errors.NewBadRequestError("role must be user, moderator or admin", nil))
+		return
+	}
+	if filter.Disabled, err = queryBool(c, "disabled"); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	users, total, err := h.service.ListUsers(c.Request.Context(), filter)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":  users,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// get user returns one account with its storage usage
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, usage, err := h.service.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":  user,
+		"usage": usage,
+	})
+}
+
+// set quota overrides a user's quota; null fields go back to the default
+func (h *AdminHandler) SetQuota(c *gin.Context) {
+	var req models.QuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", err))
+		return
+	}
+
+	usage, err := h.service.SetQuota(c.Request.Context(), currentUserID(c), c.Param("id"), &req)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"usage": usage})
+}
+
+// list user content lists one account's content with the same filters as ListContent
+func (h *AdminHandler) ListUserContent(c *gin.Context) {
+	filter, err := parseContentFilter(c)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+	filter.OwnerID = c.Param("id")
+
+	h.listContent(c, filter)
+}
+
+// disable user blocks an account
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	h.userAction(c, h.service.DisableUser)
+}
+
+// enable user unblocks an account
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	h.userAction(c, h.service.EnableUser)
+}
+
+// force password reset makes the user choose a new password through a mailed link
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	h.userAction(c, h.service.ForcePasswordReset)
+}
+
+// delete user removes an account and everything it shared
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	h.userAction(c, h.service.DeleteUser)
+}
+
+// user action runs action for the signed-in admin on the :id account
+func (h *AdminHandler) userAction(c *gin.Context, action func(ctx context.Context, actorID, id string) error) {
+	if err := action(c.Request.Context(), currentUserID(c), c.Param("id")); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// admin content summary adds the fields moderators need to the public summary
+func adminContentSummary(content *models.Content) gin.H {
+	item := contentSummary(content)
+	if content.UserID != nil {
+		item["user_id"] = *content.UserID
+	}
+	if content.BundleID != nil {
+		item["bundle_id"] = *content.BundleID
+	}
+	if content.DeletedAt != nil {
+		item["deleted_at"] = content.DeletedAt.Format(time.RFC3339)
+	}
+	return item
+}
+
+// parse content filter reads the admin listing's query parameters
+func parseContentFilter(c *gin.Context) (*models.ContentFilter, error) {
+	notDeleted := false
+	filter := &models.ContentFilter{
+		Type:    c.Query("type"),
+		OwnerID: c.Query("owner"),
+		Search:  c.Query("q"),
+		Cursor:  c.Query("cursor"),
+		Deleted: &notDeleted,
+		Limit:   defaultPageLimit,
+	}
+
+	switch filter.Type {
+	case "", models.ContentTypeFile, models.ContentTypeNote, models.ContentTypeBundle:
+	default:
+		return nil, errors.NewBadRequestError("type must be file, note or bundle", nil)
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return nil, errors.NewBadRequestError(fmt.Sprintf("limit must be between 1 and %d", maxPageLimit), err)
+		}
+		filter.Limit = n
+	}
+
+	var err error
+	if filter.CreatedAfter, err = queryTime(c, "created_after"); err != nil {
+		return nil, err
+	}
+	if filter.CreatedBefore, err = queryTime(c, "created_before"); err != nil {
+		return nil, err
+	}
+	if filter.MinSize, err = queryInt64(c, "min_size"); err != nil {
+		return nil, err
+	}
+	if filter.MaxSize, err = queryInt64(c, "max_size"); err != nil {
+		return nil, err
+	}
+	if filter.HasPasscode, err = queryBool(c, "has_passcode"); err != nil {
+		return nil, err
+	}
+	if filter.Expired, err = queryBool(c, "expired"); err != nil {
+		return nil, err
+	}
+	if c.Query("deleted") == "any" {
+		filter.Deleted = nil
+	} else if filter.Deleted, err = queryBool(c, "deleted"); err != nil {
+		return nil, err
+	} else if filter.Deleted == nil {
+		filter.Deleted = &notDeleted
+	}
+
+	return filter, nil
+}
+
+// list audit returns a filtered page of the audit log, newest first
+func (h *AdminHandler) ListAudit(c *gin.Context) {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	filter := &models.AuditFilter{
+		Action:    c.Query("action"),
+		ActorID:   c.Query("actor_id"),
+		ActorIP:   c.Query("ip"),
+		TargetID:  c.Query("target_id"),
+		Outcome:   c.Query("outcome"),
+		RequestID: c.Query("request_id"),
+		Limit:     limit,
+		Offset:    offset,
+	}
+	switch filter.Outcome {
+	case "", models.AuditSuccess, models.AuditFailure, models.AuditDenied:
+	default:
+		h.respondWithError(c, errors.NewBadRequestError("outcome must be success, failure or denied", nil))
+		return
+	}
+	if filter.Since, err = queryTime(c, "since"); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+	if filter.Until, err = queryTime(c, "until"); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	events, total, err := h.service.ListAudit(c.Request.Context(), filter)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// query time reads an optional RFC 3339 timestamp parameter
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, errors.NewBadRequestError(name+" must be an RFC 3339 timestamp", err)
+	}
+	t = t.UTC()
+	return &t, nil
+}
+
+// query int64 reads an optional non-negative integer parameter
+func queryInt64(c *gin.Context, name string) (*int64, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		return nil, errors.NewBadRequestError(name+" must be a non-negative integer", err)
+	}
+	return &n, nil
+}
+
+// query bool reads an optional true/false parameter
+func queryBool(c *gin.Context, name string) (*bool, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, errors.NewBadRequestError(name+" must be true or false", err)
+	}
+	return &b, nil
+}
+
+// private helper to respond with error
+func (h *AdminHandler) respondWithError(c *gin.Context, err error) {
+	if appErr, ok := err.(*errors.AppError); ok {
+		h.logger.WithFields(logrus.Fields{
+			"code":    appErr.Code,
+			"message": appErr.Message,
+			"error":   appErr.Err,
+		}).Error("request error")
+
+		if secs := appErr.RetryAfterSeconds(); secs > 0 {
+			c.Header("Retry-After", strconv.Itoa(secs))
+		}
+		c.JSON(appErr.StatusCode, gin.H{
+			"error": appErr.Message,
+			"code":  appErr.Code,
+		})
+		return
+	}
+
+	h.logger.WithError(err).Error("unknown error")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "internal server error",
+		"code":  "INTERNAL_ERROR",
+	})
+}
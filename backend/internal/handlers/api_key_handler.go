@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// api key handler handles the endpoints for managing personal api keys
+type APIKeyHandler struct {
+	service *services.APIKeyService
+	logger  *logrus.Logger
+}
+
+// create new api key handler
+func NewAPIKeyHandler(service *services.APIKeyService, logger *logrus.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// create issues a new api key; the full key is in this response only
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	resp, err := h.service.Create(c.Request.Context(), currentUserID(c), &req)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// list returns the current user's api keys
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.service.List(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+	})
+}
+
+// revoke disables one of the current user's api keys
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	if err := h.service.Revoke(c.Request.Context(), currentUserID(c), c.Param("id")); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// private helper to respond with error
+func (h *APIKeyHandler) respondWithError(c *gin.Context, err error) {
+	if appErr, ok := err.(*errors.AppError); ok {
+		h.logger.WithFields(logrus.Fields{
+			"code":    appErr.Code,
+			"message": appErr.Message,
+			"error":   appErr.Err,
+		}).Error("request error")
+
+		if secs := appErr.RetryAfterSeconds(); secs > 0 {
+			c.Header("Retry-After", strconv.Itoa(secs))
+		}
+		c.JSON(appErr.StatusCode, gin.H{
+			"error": appErr.Message,
+			"code":  appErr.Code,
+		})
+		return
+	}
+
+	h.logger.WithError(err).Error("unknown error")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "internal server error",
+		"code":  "INTERNAL_ERROR",
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"konbi/internal/models"
 	"konbi/internal/services"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -32,7 +33,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.service.Register(c.Request.Context(), &req)
+	resp, err := h.service.Register(c.Request.Context(), &req, clientInfo(c))
 	if err != nil {
 		h.respondWithError(c, err)
 		return
@@ -49,7 +50,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.service.Login(c.Request.Context(), &req)
+	resp, err := h.service.Login(c.Request.Context(), &req, clientInfo(c))
 	if err != nil {
 		h.respondWithError(c, err)
 		return
@@ -58,7 +59,24 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, resp)
 }
 
-// refresh generates new access token from refresh token
+// login mfa completes a login that needs a second factor
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req models.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	resp, err := h.service.CompleteMFALogin(c.Request.Context(), &req, clientInfo(c))
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// refresh rotates the refresh token and returns a new token pair
 func (h *AuthHandler) Refresh(c *gin.Context) {
 	var req models.RefreshRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -66,14 +84,84 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		return
 	}
 
-	accessToken, err := h.service.RefreshAccessToken(c.Request.Context(), req.RefreshToken)
+	resp, err := h.service.Refresh(c.Request.Context(), req.RefreshToken, clientInfo(c))
 	if err != nil {
 		h.respondWithError(c, err)
 		return
 	}
 
+	c.JSON(http.StatusOK, resp)
+}
+
+// verify email confirms an email address with the token from a verification email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	if err := h.service.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "email verified",
+	})
+}
+
+// resend verification mails a new verification link
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req models.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	if err := h.service.ResendVerification(c.Request.Context(), req.Email); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "if the account exists and is unverified, a verification email has been sent",
+	})
+}
+
+// forgot password mails a password reset link
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req models.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	if err := h.service.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "if the account exists, a password reset email has been sent",
+	})
+}
+
+// reset password sets a new password with the token from a reset email
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	if err := h.service.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"access_token": accessToken,
+		"message": "password reset, please log in again",
 	})
 }
 
@@ -96,13 +184,75 @@ func (h *AuthHandler) Me(c *gin.Context) {
 	})
 }
 
-// logout invalidates token (frontend should discard token)
+// logout revokes the current session's refresh tokens
 func (h *AuthHandler) Logout(c *gin.Context) {
+	if err := h.service.Logout(c.Request.Context(), tokenClaims(c)); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "logged out successfully",
 	})
 }
 
+// list sessions returns the current user's active sessions
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.service.ListSessions(c.Request.Context(), c.GetString("user_id"), c.GetString("session_id"))
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+	})
+}
+
+// revoke session ends one of the current user's sessions
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	if err := h.service.RevokeSession(c.Request.Context(), tokenClaims(c), c.Param("id")); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// revoke all sessions logs the current user out everywhere
+func (h *AuthHandler) RevokeAllSessions(c *gin.Context) {
+	if err := h.service.RevokeAllSessions(c.Request.Context(), tokenClaims(c)); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "all sessions logged out",
+	})
+}
+
+// jwks publishes the public keys access tokens are signed with, so other services can verify them
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{
+		"keys": h.service.JWKS(),
+	})
+}
+
+// token claims returns the verified access token claims attached by the jwt middleware
+func tokenClaims(c *gin.Context) *models.TokenClaims {
+	claims, _ := c.MustGet("token_claims").(*models.TokenClaims)
+	return claims
+}
+
+// client info describes the device making the request, recorded on its session
+func clientInfo(c *gin.Context) models.ClientInfo {
+	return models.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+}
+
 // private helper to respond with error
 func (h *AuthHandler) respondWithError(c *gin.Context, err error) {
 	var status int
@@ -111,6 +261,9 @@ func (h *AuthHandler) respondWithError(c *gin.Context, err error) {
 	if appErr, ok := err.(*errors.AppError); ok {
 		status = appErr.StatusCode
 		message = appErr.Message
+		if secs := appErr.RetryAfterSeconds(); secs > 0 {
+			c.Header("Retry-After", strconv.Itoa(secs))
+		}
 	} else {
 		status = http.StatusInternalServerError
 		message = "internal server error"
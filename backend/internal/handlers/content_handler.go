@@ -7,8 +7,9 @@ import (
 	"konbi/internal/errors"
 	"konbi/internal/models"
 	"konbi/internal/services"
+	"mime/multipart"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,6 +27,11 @@ func hasPasscode(content *models.Content) bool {
 	return content.PasscodeHash != nil && strings.TrimSpace(*content.PasscodeHash) != ""
 }
 
+// current user id returns the authenticated user set by the jwt middleware, or "" for anonymous requests
+func currentUserID(c *gin.Context) string {
+	return c.GetString("user_id")
+}
+
 // create new content handler
 func NewContentHandler(service *services.ContentService, logger *logrus.Logger) *ContentHandler {
 	return &ContentHandler{
@@ -35,32 +41,41 @@ func NewContentHandler(service *services.ContentService, logger *logrus.Logger)
 }
 
 // upload handles file upload requests
+// the body is read as a multipart stream, so form fields (passcode) must precede the file part
 func (h *ContentHandler) Upload(c *gin.Context) {
 	ctx := c.Request.Context()
 
-	// parse multipart form
-	file, header, err := c.Request.FormFile("file")
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
-		appErr := errors.NewBadRequestError("no file provided", err)
-		h.respondWithError(c, appErr)
+		h.respondWithError(c, errors.NewBadRequestError("invalid multipart form", err))
+		return
+	}
+
+	fields := map[string]string{}
+	part, err := nextFilePart(reader, "file", fields)
+	if err == io.EOF {
+		h.respondWithError(c, errors.NewBadRequestError("no file provided", nil))
+		return
+	}
+	if err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid multipart form", err))
 		return
 	}
-	defer file.Close()
+	defer part.Close()
 
-	// read file content
-	fileBytes, err := io.ReadAll(file)
+	opts, err := shareOptionsFromFields(fields)
 	if err != nil {
-		appErr := errors.NewInternalError("failed to read file", err)
-		h.respondWithError(c, appErr)
+		h.respondWithError(c, err)
 		return
 	}
 
 	// prepare request
 	req := &models.UploadRequest{
-		File:     fileBytes,
-		Filename: header.Filename,
-		Size:     header.Size,
-		Passcode: c.PostForm("passcode"),
+		File:         part,
+		Filename:     part.FileName(),
+		Passcode:     fields["passcode"],
+		UserID:       currentUserID(c),
+		ShareOptions: opts,
 	}
 
 	// upload file
@@ -70,12 +85,16 @@ func (h *ContentHandler) Upload(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"id":        content.ID,
+		"code":      *content.Code,
 		"filename":  *content.Filename,
 		"size":      *content.Filesize,
+		"mimeType":  *content.MimeType,
 		"expiresAt": content.ExpiresAt.Format(time.RFC3339),
-	})
+	}
+	addManagementToken(response, content)
+	c.JSON(http.StatusOK, response)
 }
 
 // note handles note creation requests
@@ -88,6 +107,7 @@ func (h *ContentHandler) Note(c *gin.Context) {
 		h.respondWithError(c, appErr)
 		return
 	}
+	req.UserID = currentUserID(c)
 
 	// create note
 	content, err := h.service.CreateNote(ctx, &req)
@@ -98,61 +118,84 @@ func (h *ContentHandler) Note(c *gin.Context) {
 
 	response := gin.H{
 		"id":        content.ID,
+		"code":      *content.Code,
 		"expiresAt": content.ExpiresAt.Format(time.RFC3339),
 	}
 	if content.Title != nil {
 		response["title"] = *content.Title
 	}
+	addManagementToken(response, content)
 	c.JSON(http.StatusOK, response)
 }
 
 // bundle handles multi-file bundle upload
+// each file part is streamed to disk before the next one is read
 func (h *ContentHandler) Bundle(c *gin.Context) {
 	ctx := c.Request.Context()
 
-	form, err := c.MultipartForm()
+	reader, err := c.Request.MultipartReader()
 	if err != nil {
 		h.respondWithError(c, errors.NewBadRequestError("invalid multipart form", err))
 		return
 	}
 
-	fileHeaders := form.File["files"]
-	if len(fileHeaders) == 0 {
+	// read up to the first file so the option fields before it are known
+	fields := map[string]string{}
+	first, err := nextFilePart(reader, "files", fields)
+	if err == io.EOF {
 		h.respondWithError(c, errors.NewBadRequestError("no files provided", nil))
 		return
 	}
+	if err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid multipart form", err))
+		return
+	}
 
-	var requests []*models.UploadRequest
-	for _, fh := range fileHeaders {
-		f, err := fh.Open()
-		if err != nil {
-			h.respondWithError(c, errors.NewInternalError("failed to read file", err))
-			return
-		}
-		data, err := io.ReadAll(f)
-		f.Close()
-		if err != nil {
-			h.respondWithError(c, errors.NewInternalError("failed to read file", err))
-			return
-		}
-		requests = append(requests, &models.UploadRequest{
-			File:     data,
-			Filename: fh.Filename,
-			Size:     fh.Size,
-		})
+	opts, err := shareOptionsFromFields(fields)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	fileCount := 0
+	req := &models.BundleRequest{
+		UserID:       currentUserID(c),
+		ShareOptions: opts,
+		Next: func() (*models.UploadRequest, error) {
+			part := first
+			first = nil
+			if part == nil {
+				var err error
+				part, err = nextFilePart(reader, "files", fields)
+				if err == io.EOF {
+					return nil, io.EOF
+				}
+				if err != nil {
+					return nil, errors.NewBadRequestError("invalid multipart form", err)
+				}
+			}
+			fileCount++
+			return &models.UploadRequest{
+				File:     part,
+				Filename: part.FileName(),
+			}, nil
+		},
 	}
 
-	bundle, err := h.service.CreateBundle(ctx, requests)
+	bundle, err := h.service.CreateBundle(ctx, req)
 	if err != nil {
 		h.respondWithError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"id":        bundle.ID,
-		"fileCount": len(requests),
+		"code":      *bundle.Code,
+		"fileCount": fileCount,
 		"expiresAt": bundle.ExpiresAt.Format(time.RFC3339),
-	})
+	}
+	addManagementToken(response, bundle)
+	c.JSON(http.StatusOK, response)
 }
 
 // bundle zip streams all files in a bundle as a zip archive
@@ -182,7 +225,7 @@ func (h *ContentHandler) BundleZip(c *gin.Context) {
 			h.respondWithError(c, errors.NewUnauthorizedError("passcode required"))
 			return
 		}
-		if err := h.service.VerifyPasscode(bundle, passcode); err != nil {
+		if err := h.service.VerifyPasscode(ctx, bundle, passcode); err != nil {
 			h.respondWithError(c, err)
 			return
 		}
@@ -199,6 +242,11 @@ func (h *ContentHandler) BundleZip(c *gin.Context) {
 		return
 	}
 
+	if err := h.service.ConsumeView(ctx, bundle); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
 	c.Header("Content-Type", "application/zip")
 	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="bundle-%s.zip"`, id))
 	c.Status(http.StatusOK)
@@ -213,13 +261,13 @@ func (h *ContentHandler) BundleZip(c *gin.Context) {
 			h.logger.WithError(err).Error("failed to create zip entry")
 			continue
 		}
-		src, err := os.Open(*f.Filepath)
+		src, err := h.service.OpenFile(ctx, f)
 		if err != nil {
-			h.logger.WithError(err).WithField("filepath", *f.Filepath).Error("failed to open file for zip")
+			h.logger.WithError(err).WithField("content_id", f.ID).Error("failed to open file for zip")
 			continue
 		}
 		if _, err := io.Copy(w, src); err != nil {
-			h.logger.WithError(err).WithField("filepath", *f.Filepath).Error("failed to copy file to zip")
+			h.logger.WithError(err).WithField("content_id", f.ID).Error("failed to copy file to zip")
 		}
 		src.Close()
 	}
@@ -244,6 +292,30 @@ func (h *ContentHandler) GetContent(c *gin.Context) {
 		return
 	}
 
+	h.respondWithContent(c, content)
+}
+
+// get by code resolves a short share code to its content
+func (h *ContentHandler) GetByCode(c *gin.Context) {
+	code := c.Param("code")
+	if code == "" {
+		h.respondWithError(c, errors.NewBadRequestError("code required", nil))
+		return
+	}
+
+	content, err := h.service.GetContentByCode(c.Request.Context(), code)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	h.respondWithContent(c, content)
+}
+
+// respond with content writes the public view of a content record
+func (h *ContentHandler) respondWithContent(c *gin.Context, content *models.Content) {
+	ctx := c.Request.Context()
+
 	// if passcode-protected, return metadata only — no content or download URL
 	if hasPasscode(content) {
 		response := gin.H{
@@ -252,6 +324,9 @@ func (h *ContentHandler) GetContent(c *gin.Context) {
 			"has_passcode": true,
 			"expiresAt":    content.ExpiresAt.Format(time.RFC3339),
 		}
+		if content.Code != nil {
+			response["code"] = *content.Code
+		}
 		if content.Type == models.ContentTypeFile {
 			if content.Filename != nil {
 				response["filename"] = *content.Filename
@@ -270,10 +345,18 @@ func (h *ContentHandler) GetContent(c *gin.Context) {
 
 	// prepare response based on content type
 	if content.Type == models.ContentTypeNote {
+		// the note text is the payload, so handing it out uses up a view
+		if err := h.service.ConsumeView(ctx, content); err != nil {
+			h.respondWithError(c, err)
+			return
+		}
 		response := gin.H{
 			"type": "note",
 			"id":   content.ID,
 		}
+		if content.Code != nil {
+			response["code"] = *content.Code
+		}
 		if content.Title != nil {
 			response["title"] = *content.Title
 		}
@@ -283,13 +366,12 @@ func (h *ContentHandler) GetContent(c *gin.Context) {
 		c.JSON(http.StatusOK, response)
 	} else if content.Type == models.ContentTypeFile {
 		// check if file exists
-		if content.Filepath == nil {
-			appErr := errors.NewNotFoundError("file not found")
-			h.respondWithError(c, appErr)
+		exists, err := h.service.FileExists(ctx, content)
+		if err != nil {
+			h.respondWithError(c, err)
 			return
 		}
-
-		if _, err := os.Stat(*content.Filepath); os.IsNotExist(err) {
+		if !exists {
 			appErr := errors.NewNotFoundError("file not found")
 			h.respondWithError(c, appErr)
 			return
@@ -298,7 +380,10 @@ func (h *ContentHandler) GetContent(c *gin.Context) {
 		response := gin.H{
 			"type":        "file",
 			"id":          content.ID,
-			"downloadUrl": fmt.Sprintf("/api/content/%s/download", id),
+			"downloadUrl": fmt.Sprintf("/api/content/%s/download", content.ID),
+		}
+		if content.Code != nil {
+			response["code"] = *content.Code
 		}
 		if content.Filename != nil {
 			response["filename"] = *content.Filename
@@ -306,9 +391,12 @@ func (h *ContentHandler) GetContent(c *gin.Context) {
 		if content.Filesize != nil {
 			response["size"] = *content.Filesize
 		}
+		if content.MimeType != nil {
+			response["mimeType"] = *content.MimeType
+		}
 		c.JSON(http.StatusOK, response)
 	} else if content.Type == models.ContentTypeBundle {
-		files, err := h.service.GetBundleFiles(ctx, id)
+		files, err := h.service.GetBundleFiles(ctx, content.ID)
 		if err != nil {
 			h.respondWithError(c, err)
 			return
@@ -322,15 +410,22 @@ func (h *ContentHandler) GetContent(c *gin.Context) {
 			if f.Filesize != nil {
 				item["size"] = *f.Filesize
 			}
+			if f.MimeType != nil {
+				item["mimeType"] = *f.MimeType
+			}
 			fileList = append(fileList, item)
 		}
-		c.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"type":        "bundle",
 			"id":          content.ID,
 			"fileCount":   len(files),
 			"files":       fileList,
-			"downloadUrl": fmt.Sprintf("/api/content/%s/zip", id),
-		})
+			"downloadUrl": fmt.Sprintf("/api/content/%s/zip", content.ID),
+		}
+		if content.Code != nil {
+			response["code"] = *content.Code
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -366,37 +461,25 @@ func (h *ContentHandler) Download(c *gin.Context) {
 			h.respondWithError(c, errors.NewUnauthorizedError("passcode required"))
 			return
 		}
-		if err := h.service.VerifyPasscode(content, passcode); err != nil {
+		if err := h.service.VerifyPasscode(ctx, content, passcode); err != nil {
 			h.respondWithError(c, err)
 			return
 		}
 	}
 
-	// validate file path
-	if content.Filepath == nil {
-		appErr := errors.NewNotFoundError("file not found")
-		h.respondWithError(c, appErr)
-		return
-	}
-
-	// check if file exists
-	if _, err := os.Stat(*content.Filepath); os.IsNotExist(err) {
-		appErr := errors.NewNotFoundError("file not found")
-		h.respondWithError(c, appErr)
-		return
-	}
-
-	// serve file
+	// serve file (supports range and conditional requests)
 	filename := "download"
 	if content.Filename != nil {
 		filename = *content.Filename
 	}
 
-	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Transfer-Encoding", "binary")
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	c.Header("Content-Type", "application/octet-stream")
-	c.File(*content.Filepath)
+	// the type sniffed at upload; older files never had one detected
+	contentType := "application/octet-stream"
+	if content.MimeType != nil {
+		contentType = *content.MimeType
+	}
+
+	h.serveFile(c, content, filename, contentType)
 }
 
 // unlock verifies a passcode and returns full content
@@ -422,6 +505,10 @@ func (h *ContentHandler) Unlock(c *gin.Context) {
 	}
 
 	if content.Type == models.ContentTypeNote {
+		if err := h.service.ConsumeView(ctx, content); err != nil {
+			h.respondWithError(c, err)
+			return
+		}
 		response := gin.H{
 			"type": "note",
 			"id":   content.ID,
@@ -434,11 +521,12 @@ func (h *ContentHandler) Unlock(c *gin.Context) {
 		}
 		c.JSON(http.StatusOK, response)
 	} else if content.Type == models.ContentTypeFile {
-		if content.Filepath == nil {
-			h.respondWithError(c, errors.NewNotFoundError("file not found"))
+		exists, err := h.service.FileExists(ctx, content)
+		if err != nil {
+			h.respondWithError(c, err)
 			return
 		}
-		if _, err := os.Stat(*content.Filepath); os.IsNotExist(err) {
+		if !exists {
 			h.respondWithError(c, errors.NewNotFoundError("file not found"))
 			return
 		}
@@ -453,6 +541,9 @@ func (h *ContentHandler) Unlock(c *gin.Context) {
 		if content.Filesize != nil {
 			response["size"] = *content.Filesize
 		}
+		if content.MimeType != nil {
+			response["mimeType"] = *content.MimeType
+		}
 		c.JSON(http.StatusOK, response)
 	}
 }
@@ -475,55 +566,200 @@ func (h *ContentHandler) GetStats(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"viewCount": content.ViewCount,
 		"createdAt": content.CreatedAt.Format(time.RFC3339),
 		"expiresAt": content.ExpiresAt.Format(time.RFC3339),
-	})
+	}
+	if content.MaxViews != nil {
+		response["maxViews"] = *content.MaxViews
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// list admin retrieves all content for admin
-func (h *ContentHandler) ListAdmin(c *gin.Context) {
-	ctx := c.Request.Context()
+// list mine returns a page of the authenticated user's own shares
+func (h *ContentHandler) ListMine(c *gin.Context) {
+	userID := currentUserID(c)
+	if userID == "" {
+		h.respondWithError(c, errors.NewUnauthorizedError("authentication required"))
+		return
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
 
-	// list all content
-	contents, err := h.service.ListAll(ctx)
+	contents, total, err := h.service.ListUserContent(c.Request.Context(), userID, limit, offset)
 	if err != nil {
 		h.respondWithError(c, err)
 		return
 	}
 
-	// prepare response
-	var response []gin.H
+	items := make([]gin.H, 0, len(contents))
 	for _, content := range contents {
-		item := gin.H{
-			"id":           content.ID,
-			"type":         content.Type,
-			"has_passcode": hasPasscode(content),
-			"created_at":   content.CreatedAt.Format(time.RFC3339),
-			"expires_at":   content.ExpiresAt.Format(time.RFC3339),
-			"view_count":   content.ViewCount,
-		}
-		if content.Code != nil {
-			item["code"] = *content.Code
+		items = append(items, contentSummary(content))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+		"contents": items,
+	})
+}
+
+// update lets the owner change expiry, passcode, title or filename
+func (h *ContentHandler) Update(c *gin.Context) {
+	var req models.UpdateContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request", err))
+		return
+	}
+
+	content, err := h.service.UpdateContent(c.Request.Context(), c.Param("id"), currentUserID(c), c.GetHeader("X-Management-Token"), &req)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, contentSummary(content))
+}
+
+// delete lets the owner remove a share before it expires
+func (h *ContentHandler) Delete(c *gin.Context) {
+	if err := h.service.DeleteContent(c.Request.Context(), c.Param("id"), currentUserID(c), c.GetHeader("X-Management-Token")); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// content summary is the metadata view of a share used by list and management responses
+func contentSummary(content *models.Content) gin.H {
+	item := gin.H{
+		"id":           content.ID,
+		"type":         content.Type,
+		"has_passcode": hasPasscode(content),
+		"created_at":   content.CreatedAt.Format(time.RFC3339),
+		"expires_at":   content.ExpiresAt.Format(time.RFC3339),
+		"view_count":   content.ViewCount,
+	}
+	if content.Code != nil {
+		item["code"] = *content.Code
+	}
+	if content.Title != nil {
+		item["title"] = *content.Title
+	}
+	if content.Filename != nil {
+		item["filename"] = *content.Filename
+	}
+	if content.Filesize != nil {
+		item["filesize"] = *content.Filesize
+	}
+	if content.MaxViews != nil {
+		item["max_views"] = *content.MaxViews
+	}
+	return item
+}
+
+// add management token includes the one-time management token of an anonymous share in a create response
+func addManagementToken(response gin.H, content *models.Content) {
+	if content.ManagementToken != "" {
+		response["managementToken"] = content.ManagementToken
+	}
+}
+
+// pagination defaults for list endpoints
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// parse pagination reads the limit and offset query parameters
+func parsePagination(c *gin.Context) (int, int, error) {
+	limit := defaultPageLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return 0, 0, errors.NewBadRequestError(fmt.Sprintf("limit must be between 1 and %d", maxPageLimit), err)
 		}
-		if content.Title != nil {
-			item["title"] = *content.Title
+		limit = n
+	}
+
+	offset := 0
+	if raw := c.Query("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return 0, 0, errors.NewBadRequestError("offset must be a non-negative integer", err)
 		}
-		if content.Filename != nil {
-			item["filename"] = *content.Filename
+		offset = n
+	}
+
+	return limit, offset, nil
+}
+
+// share options from fields reads expires_in, max_views and burn_after_read from multipart form fields
+func shareOptionsFromFields(fields map[string]string) (models.ShareOptions, error) {
+	var opts models.ShareOptions
+
+	if raw := fields["expires_in"]; raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return opts, errors.NewBadRequestError("expires_in must be a number of seconds", err)
 		}
-		if content.Filesize != nil {
-			item["filesize"] = *content.Filesize
+		opts.ExpiresIn = n
+	}
+
+	if raw := fields["max_views"]; raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return opts, errors.NewBadRequestError("max_views must be a number", err)
 		}
+		opts.MaxViews = &n
+	}
 
-		response = append(response, item)
+	if raw := fields["burn_after_read"]; raw != "" {
+		burn, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, errors.NewBadRequestError("burn_after_read must be true or false", err)
+		}
+		opts.BurnAfterRead = burn
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"total":    len(response),
-		"contents": response,
-	})
+	return opts, nil
+}
+
+// max form field size bounds how much of a non-file multipart part is buffered
+const maxFormFieldSize = 4096
+
+// next file part advances the multipart stream to the next file part named fieldName.
+// plain form fields encountered on the way are collected into fields; other file parts are skipped.
+// returns io.EOF when the stream has no more matching file parts.
+func nextFilePart(reader *multipart.Reader, fieldName string, fields map[string]string) (*multipart.Part, error) {
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, err
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize))
+			part.Close()
+			if err != nil {
+				return nil, err
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+
+		if part.FormName() == fieldName {
+			return part, nil
+		}
+		part.Close()
+	}
 }
 
 // respond with error handles error responses
@@ -535,6 +771,9 @@ func (h *ContentHandler) respondWithError(c *gin.Context, err error) {
 			"error":   appErr.Err,
 		}).Error("request error")
 
+		if secs := appErr.RetryAfterSeconds(); secs > 0 {
+			c.Header("Retry-After", strconv.Itoa(secs))
+		}
 		c.JSON(appErr.StatusCode, gin.H{
 			"error": appErr.Message,
 			"code":  appErr.Code,
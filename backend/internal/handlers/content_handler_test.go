@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"konbi/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slow multipart body streams each file in chunks, pausing between them, so the whole
+// body takes longer than pause*chunks to arrive
+func slowMultipartBody(field string, files []string, chunks int, pause time.Duration) (io.Reader, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		for _, name := range files {
+			part, err := mw.CreateFormFile(field, name)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			for i := 0; i < chunks; i++ {
+				time.Sleep(pause)
+				if _, err := io.WriteString(part, strings.Repeat("slow upload\n", 64)); err != nil {
+					pw.CloseWithError(err)
+					return
+				}
+			}
+		}
+		pw.CloseWithError(mw.Close())
+	}()
+	return pr, mw.FormDataContentType()
+}
+
+func TestStreamedUploadsOutlastRequestTimeout(t *testing.T) {
+	const deadline = 100 * time.Millisecond
+
+	tests := []struct {
+		name  string
+		path  string
+		field string
+		files []string
+	}{
+		{"upload", "/api/upload", "file", []string{"slow.txt"}},
+		{"bundle", "/api/bundle", "files", []string{"one.txt", "two.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewContentHandler(testContentService(t), testLogger())
+
+			// the same exemptions main.go gives these routes
+			r := gin.New()
+			r.Use(middleware.Timeout(deadline, "/api/upload", "/api/bundle", "/api/uploads"))
+			r.POST("/api/upload", h.Upload)
+			r.POST("/api/bundle", h.Bundle)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			body, contentType := slowMultipartBody(tt.field, tt.files, 4, deadline)
+			start := time.Now()
+			resp, err := http.Post(srv.URL+tt.path, contentType, body)
+			if err != nil {
+				t.Fatalf("post: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if elapsed := time.Since(start); elapsed < 2*deadline {
+				t.Fatalf("body arrived in %v, not slower than the %v deadline", elapsed, deadline)
+			}
+			if resp.StatusCode != http.StatusOK {
+				msg, _ := io.ReadAll(resp.Body)
+				t.Fatalf("status = %d, want 200: %s", resp.StatusCode, msg)
+			}
+
+			var got struct {
+				ID string `json:"id"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if _, err := h.service.GetContent(t.Context(), got.ID); err != nil {
+				t.Errorf("stored share %s: %v", got.ID, err)
+			}
+		})
+	}
+}
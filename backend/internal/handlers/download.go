@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"konbi/internal/models"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// max ranges bounds how many parts a multi-range request may ask for;
+// anything beyond is answered with the whole file instead
+const maxRanges = 16
+
+// err unsatisfiable range means none of the requested ranges overlap the file
+var errUnsatisfiableRange = errors.New("requested range not satisfiable")
+
+// http range is a byte range resolved against a file size
+type httpRange struct {
+	start  int64
+	length int64
+}
+
+// content range formats the Content-Range header value for this range
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// serve file writes a file content to the response, honouring Range, If-Range,
+// If-None-Match and If-Modified-Since. blobs are read through storage ranges,
+// so this works the same for local disk and remote backends.
+func (h *ContentHandler) serveFile(c *gin.Context, content *models.Content, filename, contentType string) {
+	ctx := c.Request.Context()
+
+	size, err := h.service.FileSize(ctx, content)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	// the stored sha-256 identifies the bytes exactly, so it makes a strong validator
+	etag := ""
+	if content.ContentHash != nil && *content.ContentHash != "" {
+		etag = `"` + *content.ContentHash + `"`
+	}
+	lastModified := content.CreatedAt.UTC().Truncate(time.Second)
+
+	header := c.Writer.Header()
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Description", "File Transfer")
+	// quoted, and rfc 2231 encoded for non-ascii names, so spaces and ";" survive intact
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	header.Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	// browsers must take the sniffed type as given instead of guessing again
+	header.Set("X-Content-Type-Options", "nosniff")
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+
+	if notModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	var ranges []httpRange
+	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" && ifRangeMatches(c.GetHeader("If-Range"), etag, lastModified) {
+		ranges, err = parseRange(rangeHeader, size)
+		if err == errUnsatisfiableRange {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			c.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{
+				"error": err.Error(),
+				"code":  "RANGE_NOT_SATISFIABLE",
+			})
+			return
+		}
+		// overlapping and out-of-order ranges are coalesced, and serving the whole file
+		// is cheaper than honouring abusive range sets
+		ranges = mergeRanges(ranges)
+		if len(ranges) > maxRanges {
+			ranges = nil
+		}
+	}
+
+	// a view is a delivery of the start of the file: the whole file or ranges from offset 0.
+	// later ranges continue a download already counted, so resuming, seeking or fetching in
+	// segments costs one view. HEAD requests are free.
+	if c.Request.Method != http.MethodHead && (len(ranges) == 0 || ranges[0].start == 0) {
+		if err := h.service.ConsumeView(ctx, content); err != nil {
+			h.respondWithError(c, err)
+			return
+		}
+	}
+
+	switch len(ranges) {
+	case 0:
+		h.serveWhole(c, content, size, contentType)
+	case 1:
+		h.serveSingleRange(c, content, size, contentType, ranges[0])
+	default:
+		h.serveMultiRange(c, content, size, contentType, ranges)
+	}
+}
+
+// serve whole sends the complete file
+func (h *ContentHandler) serveWhole(c *gin.Context, content *models.Content, size int64, contentType string) {
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Length", strconv.FormatInt(size, 10))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	src, err := h.service.OpenFile(c.Request.Context(), content)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+	defer src.Close()
+
+	c.DataFromReader(http.StatusOK, size, contentType, src, nil)
+}
+
+// serve single range sends one byte range as a plain 206 response
+func (h *ContentHandler) serveSingleRange(c *gin.Context, content *models.Content, size int64, contentType string, r httpRange) {
+	c.Header("Content-Range", r.contentRange(size))
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Length", strconv.FormatInt(r.length, 10))
+		c.Status(http.StatusPartialContent)
+		return
+	}
+
+	src, err := h.service.OpenFileRange(c.Request.Context(), content, r.start, r.length)
+	if err != nil {
+		c.Writer.Header().Del("Content-Range")
+		h.respondWithError(c, err)
+		return
+	}
+	defer src.Close()
+
+	c.DataFromReader(http.StatusPartialContent, r.length, contentType, src, nil)
+}
+
+// serve multi range sends several byte ranges as multipart/byteranges
+func (h *ContentHandler) serveMultiRange(c *gin.Context, content *models.Content, size int64, contentType string, ranges []httpRange) {
+	mw := multipart.NewWriter(c.Writer)
+	c.Header("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	c.Status(http.StatusPartialContent)
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+
+	// headers are already sent, so failures past this point can only be logged
+	for _, r := range ranges {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {contentType},
+			"Content-Range": {r.contentRange(size)},
+		})
+		if err != nil {
+			h.logger.WithError(err).WithField("content_id", content.ID).Error("failed to write range part")
+			return
+		}
+		src, err := h.service.OpenFileRange(c.Request.Context(), content, r.start, r.length)
+		if err != nil {
+			h.logger.WithError(err).WithField("content_id", content.ID).Error("failed to open file range")
+			return
+		}
+		_, err = io.Copy(part, src)
+		src.Close()
+		if err != nil {
+			h.logger.WithError(err).WithField("content_id", content.ID).Error("failed to copy file range")
+			return
+		}
+	}
+	mw.Close()
+}
+
+// parse range resolves a Range header ("bytes=0-99,200-,-50") against size.
+// a malformed header or unknown unit yields no ranges, meaning the whole file is served;
+// errUnsatisfiableRange is returned when no range overlaps the file.
+func parseRange(header string, size int64) ([]httpRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+
+	var ranges []httpRange
+	noOverlap := false
+	for _, raw := range strings.Split(spec, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		startStr, endStr, ok := strings.Cut(raw, "-")
+		if !ok {
+			return nil, nil
+		}
+		startStr, endStr = strings.TrimSpace(startStr), strings.TrimSpace(endStr)
+
+		var r httpRange
+		if startStr == "" {
+			// suffix range: the last n bytes
+			n, err := strconv.ParseInt(endStr, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r.start = size - n
+			r.length = n
+		} else {
+			start, err := strconv.ParseInt(startStr, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			r.start = start
+			if endStr == "" {
+				r.length = size - start
+			} else {
+				end, err := strconv.ParseInt(endStr, 10, 64)
+				if err != nil || end < start {
+					return nil, nil
+				}
+				if end >= size {
+					end = size - 1
+				}
+				r.length = end - start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 && noOverlap {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// merge ranges sorts ranges by start and joins the ones that overlap or touch
+func mergeRanges(ranges []httpRange) []httpRange {
+	if len(ranges) < 2 {
+		return ranges
+	}
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b httpRange) int {
+		return cmp.Compare(a.start, b.start)
+	})
+
+	merged := sorted[:1]
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if r.start <= last.start+last.length {
+			last.length = max(last.length, r.start+r.length-last.start)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// if range matches reports whether a Range header should be honoured given If-Range.
+// an etag in If-Range must match strongly; a date must equal Last-Modified.
+func ifRangeMatches(ifRange, etag string, lastModified time.Time) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return etag != "" && ifRange == etag
+	}
+	t, err := http.ParseTime(ifRange)
+	return err == nil && t.Equal(lastModified)
+}
+
+// not modified evaluates If-None-Match (weak comparison) and, in its absence, If-Modified-Since
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !lastModified.After(t)
+	}
+	return false
+}
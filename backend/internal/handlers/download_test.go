@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"konbi/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// test download router serves the download routes of a fresh content handler
+func testDownloadRouter(t *testing.T) (*ContentHandler, *gin.Engine) {
+	t.Helper()
+	h := NewContentHandler(testContentService(t), testLogger())
+	r := gin.New()
+	r.GET("/api/content/:id/download", h.Download)
+	r.HEAD("/api/content/:id/download", h.Download)
+	return h, r
+}
+
+// upload test file stores a file share through the content service
+func uploadTestFile(t *testing.T, h *ContentHandler, filename, data string, opts models.ShareOptions) *models.Content {
+	t.Helper()
+	content, err := h.service.UploadFile(t.Context(), &models.UploadRequest{
+		File:         strings.NewReader(data),
+		Filename:     filename,
+		ShareOptions: opts,
+	})
+	if err != nil {
+		t.Fatalf("upload %s: %v", filename, err)
+	}
+	return content
+}
+
+func TestDownloadCountsViewsFromFirstByte(t *testing.T) {
+	const data = "0123456789abcdefghij"
+	h, r := testDownloadRouter(t)
+	maxViews := 2
+	content := uploadTestFile(t, h, "digits.txt", data, models.ShareOptions{MaxViews: &maxViews})
+
+	steps := []struct {
+		name       string
+		method     string
+		rangeSpec  string
+		wantStatus int
+		wantBody   string
+	}{
+		{"first bytes use a view", http.MethodGet, "bytes=0-4", http.StatusPartialContent, "01234"},
+		{"resuming is free", http.MethodGet, "bytes=5-", http.StatusPartialContent, data[5:]},
+		{"seeking is free", http.MethodGet, "bytes=-5", http.StatusPartialContent, "fghij"},
+		{"later segments are free", http.MethodGet, "bytes=10-12,15-", http.StatusPartialContent, ""},
+		{"head is free", http.MethodHead, "", http.StatusOK, ""},
+		{"whole file uses the last view", http.MethodGet, "", http.StatusOK, data},
+		{"no resuming past the last view", http.MethodGet, "bytes=5-", http.StatusGone, ""},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, "/api/content/"+content.ID+"/download", nil)
+		if step.rangeSpec != "" {
+			req.Header.Set("Range", step.rangeSpec)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != step.wantStatus {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, w.Code, step.wantStatus, w.Body)
+		}
+		if step.wantBody != "" && w.Body.String() != step.wantBody {
+			t.Errorf("%s: body = %q, want %q", step.name, w.Body, step.wantBody)
+		}
+	}
+}
+
+func TestDownloadContentDisposition(t *testing.T) {
+	h, r := testDownloadRouter(t)
+
+	for _, filename := range []string{"notes.txt", "my notes.txt", "a;b=c.txt", `say "hi".txt`, "résumé 履歴書.txt"} {
+		content := uploadTestFile(t, h, filename, "hello", models.ShareOptions{})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/api/content/"+content.ID+"/download", nil))
+
+		disposition := w.Header().Get("Content-Disposition")
+		kind, params, err := mime.ParseMediaType(disposition)
+		if err != nil || kind != "attachment" || params["filename"] != filename {
+			t.Errorf("Content-Disposition for %q = %q, parsed as %q %q (%v)", filename, disposition, kind, params["filename"], err)
+		}
+	}
+}
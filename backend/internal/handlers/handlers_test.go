@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"konbi/internal/config"
+	"konbi/internal/repository"
+	"konbi/internal/services"
+	"konbi/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// test logger discards output
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// test db opens a migrated sqlite database that is removed when the test ends
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := repository.NewMigrator(db, repository.SQLiteDialect{}, testLogger())
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	return db
+}
+
+// test content service builds a content service over a fresh sqlite database and upload directory
+func testContentService(t *testing.T) *services.ContentService {
+	t.Helper()
+	ctx := context.Background()
+	logger := testLogger()
+	db := testDB(t)
+	dialect := repository.SQLiteDialect{}
+
+	cfg := config.Load()
+	cfg.Storage.Backend = "local"
+	cfg.Storage.UploadDir = t.TempDir()
+	store, err := storage.New(ctx, cfg.Storage)
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+
+	contentRepo := repository.NewContentRepository(db, dialect, logger)
+	userRepo := repository.NewUserRepository(db, dialect, logger)
+	throttle := services.NewThrottle(services.NewMemoryAttemptStore(), cfg.Security, logger)
+	quota := services.NewQuota(userRepo, contentRepo, store, cfg, logger)
+	audit := services.NewAuditLogger(repository.NewAuditRepository(db, dialect, logger), cfg, logger)
+	return services.NewContentService(contentRepo, store, throttle, quota, audit, cfg, logger)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"konbi/internal/config"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// oidc state cookie binds a pending login to the browser that started it
+const oidcStateCookie = "konbi_oidc_state"
+
+// oidc handler handles sign-in through external openid connect providers
+type OIDCHandler struct {
+	service *services.OIDCService
+	config  *config.Config
+	logger  *logrus.Logger
+}
+
+// create new oidc handler
+func NewOIDCHandler(service *services.OIDCService, cfg *config.Config, logger *logrus.Logger) *OIDCHandler {
+	return &OIDCHandler{
+		service: service,
+		config:  cfg,
+		logger:  logger,
+	}
+}
+
+// providers lists the providers users can sign in with
+func (h *OIDCHandler) Providers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"providers": h.service.Providers(),
+	})
+}
+
+// login redirects the browser to the provider's authorization page
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, state, err := h.service.Start(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	h.setStateCookie(c, state, int(services.OIDCStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// callback exchanges the code the provider redirected back with for konbi tokens
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request body", nil))
+		return
+	}
+
+	browserState, _ := c.Cookie(oidcStateCookie)
+	resp, err := h.service.Callback(c.Request.Context(), &req, browserState, clientInfo(c))
+	// a state completes at most one callback, so the cookie is spent either way
+	h.setStateCookie(c, "", -1)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// set state cookie stores the login state in an http-only cookie scoped to the oidc routes.
+// in production the frontend usually lives on another site, so the cookie has to be
+// SameSite=None to reach the callback; it is Secure there, and Lax over plain http in development.
+func (h *OIDCHandler) setStateCookie(c *gin.Context, state string, maxAge int) {
+	cookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if h.config.Server.Environment == "production" {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+// private helper to respond with error
+func (h *OIDCHandler) respondWithError(c *gin.Context, err error) {
+	if appErr, ok := err.(*errors.AppError); ok {
+		h.logger.WithFields(logrus.Fields{
+			"code":    appErr.Code,
+			"message": appErr.Message,
+			"error":   appErr.Err,
+		}).Error("request error")
+
+		if secs := appErr.RetryAfterSeconds(); secs > 0 {
+			c.Header("Retry-After", strconv.Itoa(secs))
+		}
+		c.JSON(appErr.StatusCode, gin.H{
+			"error": appErr.Message,
+			"code":  appErr.Code,
+		})
+		return
+	}
+
+	h.logger.WithError(err).Error("unknown error")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "internal server error",
+		"code":  "INTERNAL_ERROR",
+	})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"konbi/internal/config"
+	"konbi/internal/oidc/oidctest"
+	"konbi/internal/repository"
+	"konbi/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOIDCLoginBindsStateToBrowser(t *testing.T) {
+	tests := []struct {
+		environment string
+		secure      bool
+		sameSite    http.SameSite
+	}{
+		{"development", false, http.SameSiteLaxMode},
+		{"production", true, http.SameSiteNoneMode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.environment, func(t *testing.T) {
+			srv := oidctest.NewServer(t)
+			cfg := config.Load()
+			cfg.Server.Environment = tt.environment
+			cfg.OIDC.RedirectURL = "http://localhost:3000/auth/callback"
+			cfg.OIDC.Providers = []config.OIDCProviderConfig{{ID: "test", Issuer: srv.URL, ClientID: "konbi-test", Scopes: []string{"openid"}}}
+
+			logger := testLogger()
+			states := repository.NewOIDCStateRepository(testDB(t), repository.SQLiteDialect{}, logger)
+			h := NewOIDCHandler(services.NewOIDCService(nil, nil, states, nil, cfg, logger), cfg, logger)
+
+			r := gin.New()
+			r.GET("/api/auth/oidc/:provider/login", h.Login)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/test/login", nil))
+
+			if w.Code != http.StatusFound {
+				t.Fatalf("status = %d, want 302", w.Code)
+			}
+			location, err := url.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("parse location: %v", err)
+			}
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Name != oidcStateCookie {
+				t.Fatalf("cookies = %v, want one %s", cookies, oidcStateCookie)
+			}
+			c := cookies[0]
+			if c.Value != location.Query().Get("state") {
+				t.Errorf("cookie value %q is not the state sent to the provider", c.Value)
+			}
+			if !c.HttpOnly || c.Secure != tt.secure || c.SameSite != tt.sameSite || c.Path != "/api/auth/oidc" {
+				t.Errorf("cookie = %+v, want HttpOnly, Secure %v, SameSite %v, Path /api/auth/oidc", c, tt.secure, tt.sameSite)
+			}
+			if c.MaxAge != int(services.OIDCStateTTL.Seconds()) {
+				t.Errorf("cookie max age = %d, want %v", c.MaxAge, services.OIDCStateTTL)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// upload session handler handles the resumable (tus-style) upload endpoints
+type UploadSessionHandler struct {
+	service *services.UploadSessionService
+	logger  *logrus.Logger
+}
+
+// create new upload session handler
+func NewUploadSessionHandler(service *services.UploadSessionService, logger *logrus.Logger) *UploadSessionHandler {
+	return &UploadSessionHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// create starts a new upload session
+func (h *UploadSessionHandler) Create(c *gin.Context) {
+	var req models.CreateUploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request", err))
+		return
+	}
+	req.UserID = currentUserID(c)
+
+	session, err := h.service.CreateSession(c.Request.Context(), &req)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	h.setUploadHeaders(c, session)
+	c.Header("Location", fmt.Sprintf("/api/uploads/%s", session.ID))
+	response := h.sessionResponse(session)
+	// the only time the token is shown; every later request must send it as X-Upload-Token
+	response["uploadToken"] = session.Token
+	c.JSON(http.StatusCreated, response)
+}
+
+// head reports the current offset in headers only, as tus clients expect
+func (h *UploadSessionHandler) Head(c *gin.Context) {
+	session, err := h.service.GetSession(c.Request.Context(), c.Param("id"), c.GetHeader("X-Upload-Token"))
+	if err != nil {
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.Status(appErr.StatusCode)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	h.setUploadHeaders(c, session)
+	c.Status(http.StatusOK)
+}
+
+// get returns the current state of an upload session
+func (h *UploadSessionHandler) Get(c *gin.Context) {
+	session, err := h.service.GetSession(c.Request.Context(), c.Param("id"), c.GetHeader("X-Upload-Token"))
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	h.setUploadHeaders(c, session)
+	c.JSON(http.StatusOK, h.sessionResponse(session))
+}
+
+// patch appends the request body at the offset given in the Upload-Offset header
+func (h *UploadSessionHandler) Patch(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		h.respondWithError(c, errors.NewBadRequestError("missing or invalid Upload-Offset header", err))
+		return
+	}
+
+	newOffset, err := h.service.AppendChunk(c.Request.Context(), c.Param("id"), c.GetHeader("X-Upload-Token"), offset, c.Request.Body)
+	c.Header("Upload-Offset", strconv.FormatInt(newOffset, 10))
+	c.Header("Cache-Control", "no-store")
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// complete assembles the uploaded chunks into a regular file share
+func (h *UploadSessionHandler) Complete(c *gin.Context) {
+	var req models.CompleteUploadSessionRequest
+	// body is optional; an empty body means no passcode
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		h.respondWithError(c, errors.NewBadRequestError("invalid request", err))
+		return
+	}
+
+	content, err := h.service.CompleteSession(c.Request.Context(), c.Param("id"), c.GetHeader("X-Upload-Token"), &req)
+	if err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+
+	response := gin.H{
+		"id":        content.ID,
+		"code":      *content.Code,
+		"filename":  *content.Filename,
+		"size":      *content.Filesize,
+		"mimeType":  *content.MimeType,
+		"expiresAt": content.ExpiresAt.Format(time.RFC3339),
+	}
+	addManagementToken(response, content)
+	c.JSON(http.StatusOK, response)
+}
+
+// delete aborts an upload session and discards its chunks
+func (h *UploadSessionHandler) Delete(c *gin.Context) {
+	if err := h.service.AbortSession(c.Request.Context(), c.Param("id"), c.GetHeader("X-Upload-Token")); err != nil {
+		h.respondWithError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// set upload headers mirrors the session state into tus-style headers
+func (h *UploadSessionHandler) setUploadHeaders(c *gin.Context, session *models.UploadSession) {
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	if session.TotalSize != nil {
+		c.Header("Upload-Length", strconv.FormatInt(*session.TotalSize, 10))
+	}
+	c.Header("Cache-Control", "no-store")
+}
+
+// session response builds the json view of a session
+func (h *UploadSessionHandler) sessionResponse(session *models.UploadSession) gin.H {
+	response := gin.H{
+		"id":        session.ID,
+		"filename":  session.Filename,
+		"offset":    session.Offset,
+		"expiresAt": session.ExpiresAt.Format(time.RFC3339),
+	}
+	if session.TotalSize != nil {
+		response["size"] = *session.TotalSize
+	}
+	return response
+}
+
+// respond with error handles error responses
+func (h *UploadSessionHandler) respondWithError(c *gin.Context, err error) {
+	if appErr, ok := err.(*errors.AppError); ok {
+		h.logger.WithFields(logrus.Fields{
+			"code":    appErr.Code,
+			"message": appErr.Message,
+			"error":   appErr.Err,
+		}).Error("request error")
+
+		if secs := appErr.RetryAfterSeconds(); secs > 0 {
+			c.Header("Retry-After", strconv.Itoa(secs))
+		}
+		c.JSON(appErr.StatusCode, gin.H{
+			"error": appErr.Message,
+			"code":  appErr.Code,
+		})
+		return
+	}
+
+	h.logger.WithError(err).Error("unknown error")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "internal server error",
+		"code":  "INTERNAL_ERROR",
+	})
+}
@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// file mailer drops each message as an .eml file in a directory,
+// so the flows that send mail can be exercised without a mail server
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// create new file mailer, creating dir if needed
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("MAIL_FILE_DIR must be set for the file mail backend")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// send writes the message to <dir>/<timestamp>-<random>.eml
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+
+	if err := os.WriteFile(filepath.Join(m.dir, name), formatMessage(m.from, msg), 0644); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package mail
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// log mailer writes messages to the application log instead of sending them.
+// meant for development, where the links in the body can be copied from the log.
+type LogMailer struct {
+	logger *logrus.Logger
+}
+
+// create new log mailer
+func NewLogMailer(logger *logrus.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+// send logs the message
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logger.WithFields(logrus.Fields{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	}).Info("email (log mailer, not sent)")
+	return nil
+}
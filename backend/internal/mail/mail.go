@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"konbi/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// mailer delivers email (smtp server, log output, files on disk, ...)
+type Mailer interface {
+	// send delivers msg or returns why it could not
+	Send(ctx context.Context, msg Message) error
+}
+
+// new creates the mailer selected by cfg.Backend
+func New(cfg config.MailConfig, logger *logrus.Logger) (Mailer, error) {
+	switch cfg.Backend {
+	case "", "log":
+		return NewLogMailer(logger), nil
+	case "file":
+		return NewFileMailer(cfg.FileDir, cfg.From)
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", cfg.Backend)
+	}
+}
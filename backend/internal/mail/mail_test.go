@@ -0,0 +1,97 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"konbi/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNew(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	tests := []struct {
+		backend string
+		want    string
+	}{
+		{"", "*mail.LogMailer"},
+		{"log", "*mail.LogMailer"},
+		{"file", "*mail.FileMailer"},
+		{"smtp", "*mail.SMTPMailer"},
+	}
+	for _, tt := range tests {
+		m, err := New(config.MailConfig{Backend: tt.backend, FileDir: t.TempDir(), SMTPHost: "localhost", SMTPPort: 25}, logger)
+		if err != nil {
+			t.Errorf("New(%q): %v", tt.backend, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", m); got != tt.want {
+			t.Errorf("New(%q) = %s, want %s", tt.backend, got, tt.want)
+		}
+	}
+
+	if _, err := New(config.MailConfig{Backend: "pigeon"}, logger); err == nil {
+		t.Error("New with an unknown backend succeeded")
+	}
+	if _, err := New(config.MailConfig{Backend: "file"}, logger); err == nil {
+		t.Error("file backend without a directory succeeded")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m, err := NewFileMailer(dir, "konbi <no-reply@localhost>")
+	if err != nil {
+		t.Fatalf("new file mailer: %v", err)
+	}
+
+	sent := []Message{
+		{To: "a@example.com", Subject: "Reset your password", Body: "first\n"},
+		{To: "b@example.com", Subject: "Grüße", Body: "second\n"},
+	}
+	for _, msg := range sent {
+		if err := m.Send(context.Background(), msg); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != len(sent) {
+		t.Fatalf("mail files = %v, %v; want %d", files, err, len(sent))
+	}
+
+	// file names sort in the order the messages were sent
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		msg, err := netmail.ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("parse %s: %v", file, err)
+		}
+		subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		if err != nil {
+			t.Fatalf("decode subject: %v", err)
+		}
+		body, _ := io.ReadAll(msg.Body)
+
+		want := sent[i]
+		if msg.Header.Get("To") != want.To || subject != want.Subject || string(body) != want.Body {
+			t.Errorf("mail %d = %s %q %q, want %s %q %q", i, msg.Header.Get("To"), subject, body, want.To, want.Subject, want.Body)
+		}
+		if from := msg.Header.Get("From"); from != "konbi <no-reply@localhost>" {
+			t.Errorf("from = %q", from)
+		}
+	}
+}
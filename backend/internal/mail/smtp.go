@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"konbi/internal/config"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// smtp mailer sends messages through an smtp server.
+// net/smtp upgrades to STARTTLS when the server offers it.
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// create new smtp mailer
+func NewSMTPMailer(cfg config.MailConfig) *SMTPMailer {
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return &SMTPMailer{
+		addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		auth: auth,
+		from: cfg.From,
+	}
+}
+
+// send delivers the message; net/smtp has no context support, so ctx is only checked up front
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, formatMessage(m.from, msg)); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// format message renders msg as an RFC 5322 plain-text email
+func formatMessage(from string, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+	return b.Bytes()
+}
@@ -1,46 +1,66 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"konbi/internal/config"
 	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/services"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
-// admin auth middleware
+// admin auth middleware; admits signed-in users by role, and the shared
+// X-Admin-Secret header only when ALLOW_ADMIN_SECRET is set
 type AdminAuth struct {
-	config *config.Config
-	logger *logrus.Logger
+	jwtAuth     *JWTAuth
+	authService *services.AuthService
+	audit       *services.AuditLogger
+	config      *config.Config
+	logger      *logrus.Logger
 }
 
 // create new admin auth middleware
-func NewAdminAuth(cfg *config.Config, logger *logrus.Logger) *AdminAuth {
+func NewAdminAuth(cfg *config.Config, jwtAuth *JWTAuth, authService *services.AuthService, audit *services.AuditLogger, logger *logrus.Logger) *AdminAuth {
 	return &AdminAuth{
-		config: cfg,
-		logger: logger,
+		jwtAuth:     jwtAuth,
+		authService: authService,
+		audit:       audit,
+		config:      cfg,
+		logger:      logger,
 	}
 }
 
-// middleware handler
-func (a *AdminAuth) Middleware() gin.HandlerFunc {
+// require admits users whose role grants at least role. the role is read from the
+// database on every request, so a demotion takes effect without waiting for tokens to expire.
+func (a *AdminAuth) Require(role string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// check if admin endpoint is enabled
-		if a.config.Security.AdminSecret == "" {
-			err := errors.NewForbiddenError("admin endpoint disabled")
-			c.JSON(err.StatusCode, gin.H{
-				"error": err.Message,
-				"code":  err.Code,
-			})
-			c.Abort()
+		// a route inside an already authorized group only needs its stricter role checked
+		if current := c.GetString("user_role"); current != "" {
+			if !models.RoleAtLeast(current, role) {
+				a.deny(c, c.GetString("user_id"), current)
+				c.Abort()
+				return
+			}
+			c.Next()
 			return
 		}
 
-		// validate admin secret
-		providedSecret := c.GetHeader("X-Admin-Secret")
-		if providedSecret != a.config.Security.AdminSecret {
+		if a.config.Security.AllowAdminSecret && c.GetHeader("X-Admin-Secret") != "" {
+			if !a.checkSecret(c) {
+				c.Abort()
+				return
+			}
+			a.admit(c)
+			return
+		}
+
+		if c.GetHeader("Authorization") == "" {
 			a.logger.WithField("ip", c.ClientIP()).Warn("unauthorized admin access attempt")
-			err := errors.NewUnauthorizedError("unauthorized")
+			err := errors.NewUnauthorizedError("missing authorization header")
+			a.record(c, models.AuditFailure, err.Message)
 			c.JSON(err.StatusCode, gin.H{
 				"error": err.Message,
 				"code":  err.Code,
@@ -49,6 +69,119 @@ func (a *AdminAuth) Middleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Next()
+		// api keys are refused here: the admin routes never allow an api key scope
+		if !a.jwtAuth.authenticate(c) {
+			a.record(c, models.AuditFailure, "invalid credentials")
+			c.Abort()
+			return
+		}
+
+		userID := c.GetString("user_id")
+		user, err := a.authService.GetUserByID(c.Request.Context(), userID)
+		if err != nil {
+			if appErr, ok := err.(*errors.AppError); ok && appErr.StatusCode == http.StatusNotFound {
+				err = errors.NewUnauthorizedError("user not found")
+			}
+			a.respondWithError(c, err)
+			c.Abort()
+			return
+		}
+
+		if !models.RoleAtLeast(user.Role, role) {
+			a.deny(c, user.ID, user.Role)
+			c.Abort()
+			return
+		}
+
+		c.Set("user_role", user.Role)
+		requestInfo(c).Role = user.Role
+		a.logger.WithFields(logrus.Fields{
+			"user_id": user.ID,
+			"role":    user.Role,
+			"method":  c.Request.Method,
+			"path":    c.FullPath(),
+		}).Info("admin access")
+
+		a.admit(c)
+	}
+}
+
+// admit runs the rest of the chain and records the access once it is known that no
+// stricter route check denied it
+func (a *AdminAuth) admit(c *gin.Context) {
+	c.Next()
+	if !c.GetBool("admin_denied") {
+		a.record(c, models.AuditSuccess, "")
+	}
+}
+
+// deny answers 403 for a user whose role falls short of the route's
+func (a *AdminAuth) deny(c *gin.Context, userID, role string) {
+	a.logger.WithFields(logrus.Fields{
+		"ip":      c.ClientIP(),
+		"user_id": userID,
+		"role":    role,
+		"path":    c.FullPath(),
+	}).Warn("admin access denied for role")
+	err := errors.NewForbiddenError("insufficient role")
+	c.Set("admin_denied", true)
+	a.record(c, models.AuditDenied, err.Message)
+	c.JSON(err.StatusCode, gin.H{
+		"error": err.Message,
+		"code":  err.Code,
+	})
+}
+
+// check secret validates the legacy shared secret in constant time.
+// on failure it writes the error response and returns false.
+func (a *AdminAuth) checkSecret(c *gin.Context) bool {
+	provided := c.GetHeader("X-Admin-Secret")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(a.config.Security.AdminSecret)) != 1 {
+		a.logger.WithField("ip", c.ClientIP()).Warn("unauthorized admin access attempt")
+		err := errors.NewUnauthorizedError("unauthorized")
+		a.record(c, models.AuditFailure, "invalid admin secret")
+		c.JSON(err.StatusCode, gin.H{
+			"error": err.Message,
+			"code":  err.Code,
+		})
+		return false
+	}
+
+	// the secret stands for no particular person, so it is logged as such
+	c.Set("user_role", models.RoleAdmin)
+	info := requestInfo(c)
+	info.ActorType = models.AuditActorAdminSecret
+	info.Role = models.RoleAdmin
+	a.logger.WithFields(logrus.Fields{
+		"ip":     c.ClientIP(),
+		"method": c.Request.Method,
+		"path":   c.FullPath(),
+	}).Warn("admin access with legacy shared secret")
+	return true
+}
+
+// record writes an admin access event; the detail names the route so denials show what was tried
+func (a *AdminAuth) record(c *gin.Context, outcome, reason string) {
+	detail := c.Request.Method + " " + c.FullPath()
+	if reason != "" {
+		detail += ": " + reason
 	}
+	a.audit.Record(c.Request.Context(), models.AuditAdminAccess, outcome, "", "", detail)
+}
+
+// private helper to respond with error
+func (a *AdminAuth) respondWithError(c *gin.Context, err error) {
+	if appErr, ok := err.(*errors.AppError); ok {
+		c.JSON(appErr.StatusCode, gin.H{
+			"error": appErr.Message,
+			"code":  appErr.Code,
+		})
+		return
+	}
+
+	a.logger.WithError(err).Error("failed to load admin user")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "internal server error",
+		"code":  "INTERNAL_ERROR",
+	})
 }
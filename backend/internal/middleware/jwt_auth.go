@@ -2,33 +2,47 @@ package middleware
 
 import (
 	"konbi/internal/errors"
+	"konbi/internal/models"
 	"konbi/internal/services"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
-// jwt auth middleware
+// jwt auth middleware; also accepts personal api keys on routes that allow them
 type JWTAuth struct {
-	authService *services.AuthService
-	logger      *logrus.Logger
+	authService   *services.AuthService
+	apiKeyService *services.APIKeyService
+	revocations   services.RevocationStore
+	logger        *logrus.Logger
 }
 
 // create new jwt auth middleware
-func NewJWTAuth(authService *services.AuthService, logger *logrus.Logger) *JWTAuth {
+func NewJWTAuth(authService *services.AuthService, apiKeyService *services.APIKeyService, revocations services.RevocationStore, logger *logrus.Logger) *JWTAuth {
 	return &JWTAuth{
-		authService: authService,
-		logger:      logger,
+		authService:   authService,
+		apiKeyService: apiKeyService,
+		revocations:   revocations,
+		logger:        logger,
+	}
+}
+
+// allow api key lets the following Middleware or Optional accept api keys that grant scope.
+// routes without it only accept session tokens, so a leaked key can't manage the account.
+func (j *JWTAuth) AllowAPIKey(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("api_key_scope", scope)
+		c.Next()
 	}
 }
 
 // middleware validates jwt token and attaches user to context
 func (j *JWTAuth) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
+		if c.GetHeader("Authorization") == "" {
 			j.logger.WithField("ip", c.ClientIP()).Warn("missing authorization header")
 			err := errors.NewUnauthorizedError("missing authorization header")
 			c.JSON(err.StatusCode, gin.H{"error": err.Message})
@@ -36,35 +50,146 @@ func (j *JWTAuth) Middleware() gin.HandlerFunc {
 			return
 		}
 
-		// extract bearer token
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			j.logger.WithField("ip", c.ClientIP()).Warn("invalid authorization header format")
-			err := errors.NewUnauthorizedError("invalid authorization header format")
-			c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		if !j.authenticate(c) {
 			c.Abort()
 			return
 		}
 
-		token := parts[1]
-
-		// verify token
-		claims, err := j.authService.VerifyAccessToken(token)
-		if err != nil {
-			j.logger.WithField("ip", c.ClientIP()).Warn("invalid token")
-			if appErr, ok := err.(*errors.AppError); ok {
-				c.JSON(appErr.StatusCode, gin.H{"error": appErr.Message})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
-			}
-			c.Abort()
+		c.Next()
+	}
+}
+
+// optional attaches the user when a bearer token is sent and lets anonymous requests through.
+// a token that is present but invalid is still rejected, so clients notice an expired session
+// instead of silently creating anonymous content.
+func (j *JWTAuth) Optional() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
 			return
 		}
 
-		// attach user info to context
-		c.Set("user_id", claims.UserID)
-		c.Set("user_email", claims.Email)
+		if !j.authenticate(c) {
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
 }
+
+// authenticate verifies the bearer token and attaches user info to context.
+// on failure it writes the error response and returns false.
+func (j *JWTAuth) authenticate(c *gin.Context) bool {
+	// extract bearer token
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		j.logger.WithField("ip", c.ClientIP()).Warn("invalid authorization header format")
+		err := errors.NewUnauthorizedError("invalid authorization header format")
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return false
+	}
+
+	token := parts[1]
+	if services.IsAPIKey(token) {
+		return j.authenticateAPIKey(c, token)
+	}
+
+	// verify token
+	claims, err := j.authService.VerifyAccessToken(token)
+	if err != nil {
+		j.logger.WithField("ip", c.ClientIP()).Warn("invalid token")
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, gin.H{"error": appErr.Message})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return false
+	}
+
+	// reject tokens revoked before their expiry (logout, session revocation)
+	revoked, err := j.revocations.IsRevoked(c.Request.Context(), claims.ID)
+	if err != nil {
+		j.logger.WithError(err).Error("failed to check token revocation")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return false
+	}
+	if revoked {
+		j.logger.WithFields(logrus.Fields{"ip": c.ClientIP(), "user_id": claims.UserID}).Warn("revoked token used")
+		err := errors.NewUnauthorizedError("token has been revoked")
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return false
+	}
+
+	if !j.ensureActive(c, claims.UserID, claims.IssuedAt.Time) {
+		return false
+	}
+
+	// attach user info to context
+	c.Set("user_id", claims.UserID)
+	c.Set("user_email", claims.Email)
+	c.Set("session_id", claims.SessionID)
+	c.Set("token_claims", claims)
+	info := requestInfo(c)
+	info.ActorType = models.AuditActorUser
+	info.UserID = claims.UserID
+	return true
+}
+
+// authenticate api key checks a personal api key against the scope the route allows
+// and attaches the key's owner to context
+func (j *JWTAuth) authenticateAPIKey(c *gin.Context, token string) bool {
+	scope := c.GetString("api_key_scope")
+	if scope == "" {
+		j.logger.WithField("ip", c.ClientIP()).Warn("api key used on a session-only route")
+		err := errors.NewUnauthorizedError("api keys are not accepted here")
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return false
+	}
+
+	key, err := j.apiKeyService.Authenticate(c.Request.Context(), token)
+	if err != nil {
+		j.logger.WithField("ip", c.ClientIP()).Warn("invalid api key")
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, gin.H{"error": appErr.Message})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return false
+	}
+
+	if !key.HasScope(scope) {
+		j.logger.WithFields(logrus.Fields{"api_key_id": key.ID, "scope": scope}).Warn("api key lacks scope")
+		err := errors.NewForbiddenError("api key lacks the " + scope + " scope")
+		c.JSON(err.StatusCode, gin.H{"error": err.Message})
+		return false
+	}
+
+	if !j.ensureActive(c, key.UserID, time.Time{}) {
+		return false
+	}
+
+	// attach the key's owner to context
+	c.Set("user_id", key.UserID)
+	c.Set("api_key_id", key.ID)
+	info := requestInfo(c)
+	info.ActorType = models.AuditActorAPIKey
+	info.UserID = key.UserID
+	return true
+}
+
+// ensure active rejects credentials of a deleted or disabled account, and session tokens
+// issued before the account's tokens were invalidated. on failure it writes the error
+// response and returns false.
+func (j *JWTAuth) ensureActive(c *gin.Context, userID string, issuedAt time.Time) bool {
+	if err := j.authService.EnsureActive(c.Request.Context(), userID, issuedAt); err != nil {
+		j.logger.WithFields(logrus.Fields{"ip": c.ClientIP(), "user_id": userID}).Warn("credentials of inactive account used")
+		if appErr, ok := err.(*errors.AppError); ok {
+			c.JSON(appErr.StatusCode, gin.H{"error": appErr.Message})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return false
+	}
+	return true
+}
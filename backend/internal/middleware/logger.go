@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"konbi/internal/models"
+	"konbi/internal/services"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -27,6 +29,15 @@ func (lm *LoggerMiddleware) Middleware() gin.HandlerFunc {
 		requestID := uuid.New().String()
 		c.Set("request_id", requestID)
 
+		// services read the caller from the request context, e.g. for the audit log;
+		// the auth middlewares fill in who it is once they know
+		info := &models.RequestInfo{
+			RequestID: requestID,
+			IP:        c.ClientIP(),
+			ActorType: models.AuditActorAnonymous,
+		}
+		c.Request = c.Request.WithContext(services.WithRequestInfo(c.Request.Context(), info))
+
 		// start timer
 		start := time.Now()
 
@@ -48,3 +59,12 @@ func (lm *LoggerMiddleware) Middleware() gin.HandlerFunc {
 		}).Info("request completed")
 	}
 }
+
+// request info returns the request info the middleware attached, or a detached one
+// when it isn't installed so callers needn't check
+func requestInfo(c *gin.Context) *models.RequestInfo {
+	if info := services.RequestInfoFrom(c.Request.Context()); info != nil {
+		return info
+	}
+	return &models.RequestInfo{}
+}
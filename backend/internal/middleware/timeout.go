@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -10,8 +11,17 @@ import (
 
 // timeout wraps the request context with a deadline so DB queries don't hang forever.
 // File streaming (io.Copy) is unaffected since it doesn't use the request context.
-func Timeout(d time.Duration) gin.HandlerFunc {
+// requests under one of the exempt path prefixes run without a deadline; routes that read
+// a large body belong there, since the deadline would answer 504 halfway through it.
+func Timeout(d time.Duration, exempt ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		for _, prefix := range exempt {
+			if strings.HasPrefix(c.Request.URL.Path, prefix) {
+				c.Next()
+				return
+			}
+		}
+
 		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
 		defer cancel()
 
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// ContentFilter narrows the admin content listing; nil and empty fields don't filter
+type ContentFilter struct {
+	Type          string
+	OwnerID       string // OwnerAnonymous matches content uploaded without an account
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	MinSize       *int64
+	MaxSize       *int64
+	HasPasscode   *bool
+	Expired       *bool
+	Deleted       *bool  // defaults to live content; nil lists both
+	Search        string // case-insensitive substring of the filename or title
+	Cursor        string // next_cursor of the previous page
+	Limit         int
+}
+
+// OwnerAnonymous is the owner filter value for content without an owner
+const OwnerAnonymous = "anonymous"
+
+// ContentCursor is the position after the last item of a page, newest first
+type ContentCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// UserFilter narrows the admin user listing; empty fields don't filter
+type UserFilter struct {
+	Search   string // case-insensitive substring of the email
+	Role     string
+	Disabled *bool
+	Limit    int
+	Offset   int
+}
+
+// StorageUsage sums up a user's live shares next to the quota that applies to them
+type StorageUsage struct {
+	Items      int   `json:"items"`       // top-level shares; a bundle counts once
+	Bytes      int64 `json:"bytes"`       // stored file bytes, bundle files included
+	QuotaItems int   `json:"quota_items"` // 0 is unlimited
+	QuotaBytes int64 `json:"quota_bytes"` // 0 is unlimited
+}
+
+// QuotaRequest overrides a user's quota; a null field goes back to the default and 0 is unlimited
+type QuotaRequest struct {
+	Bytes *int64 `json:"bytes" binding:"omitempty,min=0"`
+	Items *int   `json:"items" binding:"omitempty,min=0"`
+}
+
+// BulkRequest names the items a bulk admin action applies to
+type BulkRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=100"`
+}
+
+// BulkResult reports which items of a bulk action succeeded and why the others failed
+type BulkResult struct {
+	Succeeded []string          `json:"succeeded"`
+	Failed    map[string]string `json:"failed"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// APIKey is a long-lived credential a user creates for scripts and CI.
+// the key itself is shown once at creation; only its prefix and a hash of its secret are kept.
+type APIKey struct {
+	ID         string     `db:"id" json:"id"`
+	UserID     string     `db:"user_id" json:"-"`
+	Name       string     `db:"name" json:"name"`
+	Prefix     string     `db:"prefix" json:"prefix"`
+	SecretHash string     `db:"secret_hash" json:"-"`
+	Scopes     []string   `db:"scopes" json:"scopes"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+}
+
+// api key scopes; a key may only be used on routes that accept one of its scopes
+const (
+	APIKeyScopeUpload = "upload" // create shares
+	APIKeyScopeRead   = "read"   // list own shares
+	APIKeyScopeDelete = "delete" // delete own shares
+)
+
+// APIKeyScopes lists every scope, granted to keys created without an explicit list
+var APIKeyScopes = []string{APIKeyScopeUpload, APIKeyScopeRead, APIKeyScopeDelete}
+
+// HasScope reports whether the key grants scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest payload; scopes default to all and no expiry means the key never expires
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expires_in_days" binding:"omitempty,min=1"`
+}
+
+// CreateAPIKeyResponse carries the new key in full; it can't be retrieved again
+type CreateAPIKeyResponse struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// AuditEvent records one security-relevant action
+type AuditEvent struct {
+	ID         string    `db:"id" json:"id"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	RequestID  string    `db:"request_id" json:"request_id,omitempty"`
+	ActorType  string    `db:"actor_type" json:"actor_type"`
+	ActorID    *string   `db:"actor_id" json:"actor_id,omitempty"` // user id, nil for anonymous callers and the admin secret
+	ActorRole  *string   `db:"actor_role" json:"actor_role,omitempty"`
+	ActorIP    string    `db:"actor_ip" json:"actor_ip,omitempty"`
+	Action     string    `db:"action" json:"action"`
+	TargetType *string   `db:"target_type" json:"target_type,omitempty"`
+	TargetID   *string   `db:"target_id" json:"target_id,omitempty"`
+	Outcome    string    `db:"outcome" json:"outcome"`
+	Detail     *string   `db:"detail" json:"detail,omitempty"`
+}
+
+// audit actor types
+const (
+	AuditActorAnonymous   = "anonymous"    // known only by ip
+	AuditActorUser        = "user"         // signed in with a session token
+	AuditActorAPIKey      = "api_key"      // signed in with a personal api key
+	AuditActorAdminSecret = "admin_secret" // the legacy shared X-Admin-Secret
+	AuditActorSystem      = "system"       // background jobs
+)
+
+// audit outcomes
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure" // wrong credentials or invalid input
+	AuditDenied  = "denied"  // refused by a policy: lockout, role, disabled account
+)
+
+// audit target types
+const (
+	AuditTargetUser    = "user"
+	AuditTargetContent = "content"
+)
+
+// audit actions
+const (
+	AuditRegister            = "auth.register"
+	AuditLogin               = "auth.login"
+	AuditLoginMFA            = "auth.login_mfa"
+	AuditLoginOIDC           = "auth.login_oidc"
+	AuditLogout              = "auth.logout"
+	AuditRefreshReuse        = "auth.refresh_reuse"
+	AuditPasswordReset       = "auth.password_reset"
+	AuditPasscode            = "content.passcode"
+	AuditContentUpdate       = "content.update"
+	AuditContentDelete       = "content.delete"
+	AuditAdminAccess         = "admin.access"
+	AuditAdminContentDelete  = "admin.content_delete"
+	AuditAdminContentRestore = "admin.content_restore"
+	AuditAdminContentPurge   = "admin.content_purge"
+	AuditAdminUserDisable    = "admin.user_disable"
+	AuditAdminUserEnable     = "admin.user_enable"
+	AuditAdminUserReset      = "admin.user_password_reset"
+	AuditAdminUserDelete     = "admin.user_delete"
+	AuditAdminUserQuota      = "admin.user_quota"
+)
+
+// AuditFilter narrows the audit log listing; empty fields don't filter
+type AuditFilter struct {
+	Action    string // an exact action, or a prefix ending in "." such as "auth."
+	ActorID   string
+	ActorIP   string
+	TargetID  string
+	Outcome   string
+	RequestID string
+	Since     *time.Time
+	Until     *time.Time
+	Limit     int
+	Offset    int
+}
+
+// RequestInfo describes who is making a request. the logger middleware attaches it to the
+// request context and the auth middlewares fill in the caller once they know it.
+type RequestInfo struct {
+	RequestID string
+	IP        string
+	ActorType string
+	UserID    string
+	Role      string // set by the admin middleware
+}
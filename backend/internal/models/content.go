@@ -1,25 +1,33 @@
 package models
 
 import (
+	"io"
 	"time"
 )
 
 // content represents a shared item (file, note, or bundle)
 type Content struct {
-	ID           string     `db:"id" json:"id"`
-	Code         *string    `db:"code" json:"code,omitempty"`
-	BundleID     *string    `db:"bundle_id" json:"bundle_id,omitempty"`
-	Type         string     `db:"type" json:"type"`
-	Title        *string    `db:"title" json:"title,omitempty"`
-	Filename     *string    `db:"filename" json:"filename,omitempty"`
-	Filepath     *string    `db:"filepath" json:"filepath,omitempty"`
-	Filesize     *int64     `db:"filesize" json:"filesize,omitempty"`
-	Content      *string    `db:"content" json:"content,omitempty"`
-	PasscodeHash *string    `db:"passcode_hash" json:"-"`
-	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
-	ExpiresAt    time.Time  `db:"expires_at" json:"expires_at"`
-	ViewCount    int        `db:"view_count" json:"view_count"`
-	DeletedAt    *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+	ID                  string     `db:"id" json:"id"`
+	Code                *string    `db:"code" json:"code,omitempty"`
+	BundleID            *string    `db:"bundle_id" json:"bundle_id,omitempty"`
+	UserID              *string    `db:"user_id" json:"user_id,omitempty"` // owner, nil for anonymous uploads
+	Type                string     `db:"type" json:"type"`
+	Title               *string    `db:"title" json:"title,omitempty"`
+	Filename            *string    `db:"filename" json:"filename,omitempty"`
+	Filepath            *string    `db:"filepath" json:"filepath,omitempty"` // storage backend key
+	Filesize            *int64     `db:"filesize" json:"filesize,omitempty"`
+	ContentHash         *string    `db:"content_hash" json:"-"`                // hex sha-256 of the stored blob
+	MimeType            *string    `db:"mime_type" json:"mime_type,omitempty"` // sniffed from the first bytes at upload
+	Content             *string    `db:"content" json:"content,omitempty"`
+	PasscodeHash        *string    `db:"passcode_hash" json:"-"`
+	ManagementTokenHash *string    `db:"management_token_hash" json:"-"` // sha-256 of the anonymous uploader's management token
+	ManagementToken     string     `db:"-" json:"-"`                     // plaintext token, only set on the record returned at creation
+	CreatedAt           time.Time  `db:"created_at" json:"created_at"`
+	ExpiresAt           time.Time  `db:"expires_at" json:"expires_at"`
+	ViewCount           int        `db:"view_count" json:"view_count"`
+	MaxViews            *int       `db:"max_views" json:"max_views,omitempty"` // nil means unlimited
+	DeletedAt           *time.Time `db:"deleted_at" json:"deleted_at,omitempty"`
+	UploaderIP          *string    `db:"uploader_ip" json:"-"` // anonymous uploads only, counted against that address's quota
 }
 
 // content type constants
@@ -29,12 +37,30 @@ const (
 	ContentTypeBundle = "bundle"
 )
 
+// share options are the lifetime limits a client may request when creating a share
+type ShareOptions struct {
+	ExpiresIn     int64 `json:"expires_in"` // seconds; 0 uses the server default
+	MaxViews      *int  `json:"max_views"`
+	BurnAfterRead bool  `json:"burn_after_read"` // shorthand for max_views = 1
+}
+
 // upload request represents file upload data
+// file is streamed to storage; its size is measured while copying, not trusted from the client
 type UploadRequest struct {
-	File     []byte
+	File     io.Reader
 	Filename string
-	Size     int64
 	Passcode string
+	UserID   string // authenticated uploader, empty for anonymous
+	ShareOptions
+}
+
+// bundle request represents a multi-file upload
+// next yields one file at a time and returns io.EOF once all files are consumed,
+// so each file can be streamed before the following one is read
+type BundleRequest struct {
+	Next   func() (*UploadRequest, error)
+	UserID string
+	ShareOptions
 }
 
 // note request represents note creation data
@@ -42,6 +68,8 @@ type NoteRequest struct {
 	Title    string `json:"title"`
 	Content  string `json:"content" binding:"required"`
 	Passcode string `json:"passcode"`
+	UserID   string `json:"-"`
+	ShareOptions
 }
 
 // unlock request carries the passcode for protected content
@@ -49,6 +77,15 @@ type UnlockRequest struct {
 	Passcode string `json:"passcode" binding:"required"`
 }
 
+// update content request carries the fields an owner may change; absent fields are left as is.
+// an empty passcode removes the passcode and an empty title clears the title.
+type UpdateContentRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	Passcode  *string    `json:"passcode"`
+	Title     *string    `json:"title"`
+	Filename  *string    `json:"filename"`
+}
+
 // content response represents api response
 type ContentResponse struct {
 	ID          string  `json:"id"`
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// UserIdentity links an account at an external OIDC provider to a konbi user
+type UserIdentity struct {
+	ID          string     `db:"id" json:"id"`
+	UserID      string     `db:"user_id" json:"-"`
+	Provider    string     `db:"provider" json:"provider"`
+	Subject     string     `db:"subject" json:"-"`
+	Email       string     `db:"email" json:"email"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	LastLoginAt *time.Time `db:"last_login_at" json:"last_login_at,omitempty"`
+}
+
+// OIDCState is a pending authorization request, kept until its callback arrives
+type OIDCState struct {
+	State        string    `db:"state"`
+	Provider     string    `db:"provider"`
+	CodeVerifier string    `db:"code_verifier"`
+	Nonce        string    `db:"nonce"`
+	CreatedAt    time.Time `db:"created_at"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+// OIDCProvider is the public description of a configured provider
+type OIDCProvider struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	LoginURL string `json:"login_url"`
+}
+
+// OIDCCallbackRequest carries the state and code the provider redirected back with
+type OIDCCallbackRequest struct {
+	State string `json:"state" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// recovery code is a single-use fallback for a lost authenticator; only its hash is stored
+type RecoveryCode struct {
+	ID        string     `db:"id"`
+	UserID    string     `db:"user_id"`
+	CodeHash  string     `db:"code_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// MFALoginRequest exchanges a login challenge and a second factor for tokens.
+// code is a current TOTP code or an unused recovery code.
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// ConfirmPasswordRequest re-checks the password before a security change
+type ConfirmPasswordRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// TOTPActivateRequest confirms an enrollment with a code from the authenticator
+type TOTPActivateRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TOTPDisableRequest payload; needs the password and a TOTP or recovery code
+type TOTPDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TOTPEnrollment is the secret an authenticator app is set up with
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// RecoveryCodesResponse lists freshly generated recovery codes; they are shown only once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// refresh token is the stored record of an issued refresh token.
+// only the hash of the token is kept. rotating a token adds a new record to the
+// same family, and a family is one login session.
+type RefreshToken struct {
+	ID               string     `db:"id"`
+	FamilyID         string     `db:"family_id"`
+	UserID           string     `db:"user_id"`
+	TokenHash        string     `db:"token_hash"`
+	UserAgent        *string    `db:"user_agent"`
+	IPAddress        *string    `db:"ip_address"`
+	SessionStartedAt time.Time  `db:"session_started_at"`
+	CreatedAt        time.Time  `db:"created_at"`
+	ExpiresAt        time.Time  `db:"expires_at"`
+	RotatedAt        *time.Time `db:"rotated_at"`
+	RevokedAt        *time.Time `db:"revoked_at"`
+}
+
+// session describes a live login session (refresh token family) to its owner
+type Session struct {
+	ID         string    `json:"id"`
+	UserAgent  *string   `json:"user_agent,omitempty"`
+	IPAddress  *string   `json:"ip_address,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// client info identifies the device a session was started from
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
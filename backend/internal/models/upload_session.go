@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// upload session tracks a resumable (tus-style) upload assembled from chunks
+type UploadSession struct {
+	ID        string    `db:"id" json:"id"`
+	Filename  string    `db:"filename" json:"filename"`
+	TotalSize *int64    `db:"total_size" json:"size,omitempty"`
+	Offset    int64     `db:"upload_offset" json:"offset"`
+	Status    string    `db:"status" json:"-"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+	UserID    *string   `db:"user_id" json:"-"`    // creator, who will own the share; nil for anonymous
+	TokenHash *string   `db:"token_hash" json:"-"` // sha-256 of the upload token
+	Token     string    `db:"-" json:"-"`          // plaintext token, only set on the session returned at creation
+}
+
+// upload session status constants
+const (
+	UploadSessionActive     = "active"
+	UploadSessionFinalizing = "finalizing"
+)
+
+// upload chunk is one stored piece of an upload session
+type UploadChunk struct {
+	SessionID   string `db:"session_id"`
+	StartOffset int64  `db:"start_offset"`
+	Size        int64  `db:"size"`
+	StorageKey  string `db:"storage_key"`
+}
+
+// create upload session request starts a resumable upload
+// size is optional; when given, chunks beyond it are rejected and finalize requires it to be reached
+type CreateUploadSessionRequest struct {
+	Filename string `json:"filename" binding:"required"`
+	Size     *int64 `json:"size"`
+	UserID   string `json:"-"` // authenticated creator, empty for anonymous
+}
+
+// complete upload session request carries options applied when the file record is created
+type CompleteUploadSessionRequest struct {
+	Passcode string `json:"passcode"`
+	ShareOptions
+}
@@ -1,14 +1,51 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 // User represents a user account
 type User struct {
-	ID           string    `db:"id" json:"id"`
-	Email        string    `db:"email" json:"email"`
-	PasswordHash string    `db:"password_hash" json:"-"`
-	CreatedAt    time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+	ID               string     `db:"id" json:"id"`
+	Email            string     `db:"email" json:"email"`
+	PasswordHash     string     `db:"password_hash" json:"-"`
+	EmailVerifiedAt  *time.Time `db:"email_verified_at" json:"email_verified_at,omitempty"`
+	TOTPSecret       *string    `db:"totp_secret" json:"-"`
+	TOTPEnabledAt    *time.Time `db:"totp_enabled_at" json:"totp_enabled_at,omitempty"`
+	TOTPLastStep     *int64     `db:"totp_last_step" json:"-"`
+	Role             string     `db:"role" json:"role"`
+	DisabledAt       *time.Time `db:"disabled_at" json:"disabled_at,omitempty"`
+	StorageBytes     int64      `db:"storage_bytes" json:"storage_bytes"`       // file bytes of the user's live shares
+	StorageItems     int        `db:"storage_items" json:"storage_items"`       // live top-level shares; a bundle counts once
+	QuotaBytes       *int64     `db:"quota_bytes" json:"quota_bytes,omitempty"` // overrides the default quota; nil uses it, 0 is unlimited
+	QuotaItems       *int       `db:"quota_items" json:"quota_items,omitempty"`
+	TokensValidAfter *time.Time `db:"tokens_valid_after" json:"-"` // access tokens issued up to this time are refused
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt        time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// user roles, from least to most privileged
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator" // may use the admin api
+	RoleAdmin     = "admin"     // may use the admin api and manage other accounts
+)
+
+// roleRank orders the roles so a requirement is met by any role at or above it
+var roleRank = map[string]int{RoleUser: 0, RoleModerator: 1, RoleAdmin: 2}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants at least the privileges of min
+func RoleAtLeast(role, min string) bool {
+	have, ok := roleRank[role]
+	return ok && have >= roleRank[min]
 }
 
 // RegisterRequest payload
@@ -23,21 +60,51 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// ChangePasswordRequest payload
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// ChangeEmailRequest payload; the password confirms the change
+type ChangeEmailRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// DeleteAccountRequest payload; the password confirms the deletion
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
 // RefreshRequest payload
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
-// AuthResponse contains tokens after login
+// AuthResponse contains tokens after login; tokens are omitted when a new account must verify its email first.
+// when the account has two-factor authentication, login returns only MFARequired and MFAToken.
 type AuthResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int    `json:"expires_in"`
-	User         User   `json:"user"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
+	User         *User  `json:"user,omitempty"`
 }
 
-// TokenClaims holds JWT claims
+// TokenClaims holds JWT claims; the jti, issuer, audience and expiry live in the registered claims
 type TokenClaims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid"`
+	Type      string `json:"typ"`
+	jwt.RegisteredClaims
 }
+
+// token types, carried in the typ claim so one kind can't stand in for the other
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	TokenTypeMFA     = "mfa" // challenge exchanged for tokens at /api/auth/login/mfa
+)
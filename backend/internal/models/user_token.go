@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// user token is a single-use token mailed to a user; only its hash is stored
+type UserToken struct {
+	ID        string     `db:"id"`
+	UserID    string     `db:"user_id"`
+	Purpose   string     `db:"purpose"`
+	TokenHash string     `db:"token_hash"`
+	Email     *string    `db:"email"` // the address a verification token confirms
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// user token purposes
+const (
+	UserTokenVerifyEmail   = "verify_email"
+	UserTokenResetPassword = "reset_password"
+)
+
+// verify email request carries the token from a verification email
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// email request names the account a verification or reset email is sent for
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// reset password request carries the token from a reset email and the new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
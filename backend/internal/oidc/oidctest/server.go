@@ -0,0 +1,182 @@
+// package oidctest runs a local openid connect provider for tests: discovery, a signing key
+// set and a token endpoint that checks PKCE. there is no login page; Authorize stands in
+// for a user approving the authorization request.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// key id of the server's signing key
+const KeyID = "oidctest"
+
+// identity is the account a user approves an authorization request with
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// authorization is an approved request waiting for its code to be exchanged
+type authorization struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	identity    Identity
+}
+
+// server is a mock provider. DiscoveryIssuer and TokenIssuer default to the server's url
+// and can be changed to test issuer checks.
+type Server struct {
+	*httptest.Server
+	DiscoveryIssuer string
+	TokenIssuer     string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// new server starts a provider that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate signing key: %v", err)
+	}
+
+	s := &Server{key: key, codes: map[string]authorization{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	mux.HandleFunc("POST /token", s.token)
+	s.Server = httptest.NewServer(mux)
+	s.DiscoveryIssuer = s.URL
+	s.TokenIssuer = s.URL
+	t.Cleanup(s.Close)
+	return s
+}
+
+// authorize approves the authorization request in authURL as identity and returns the code
+// and state the provider would redirect back with
+func (s *Server) Authorize(t testing.TB, authURL string, identity Identity) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization url: %v", err)
+	}
+	q := u.Query()
+	if got := q.Get("response_type"); got != "code" {
+		t.Fatalf("response_type = %q, want code", got)
+	}
+	if got := q.Get("code_challenge_method"); got != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", got)
+	}
+	for _, name := range []string{"client_id", "redirect_uri", "state", "nonce", "code_challenge"} {
+		if q.Get(name) == "" {
+			t.Fatalf("authorization request has no %s", name)
+		}
+	}
+
+	code = rand.Text()
+	s.mu.Lock()
+	s.codes[code] = authorization{
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		identity:    identity,
+	}
+	s.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.DiscoveryIssuer,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// token exchanges a code once, checking the client, redirect uri and PKCE verifier
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	auth, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok ||
+		r.PostForm.Get("client_id") != auth.clientID ||
+		r.PostForm.Get("redirect_uri") != auth.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            s.TokenIssuer,
+		"aud":            auth.clientID,
+		"sub":            auth.identity.Subject,
+		"email":          auth.identity.Email,
+		"email_verified": auth.identity.EmailVerified,
+		"nonce":          auth.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	token.Header["kid"] = KeyID
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": rand.Text(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
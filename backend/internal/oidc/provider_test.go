@@ -0,0 +1,149 @@
+package oidc
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"konbi/internal/config"
+	"konbi/internal/oidc/oidctest"
+)
+
+const (
+	testClientID    = "konbi-test"
+	testRedirectURI = "http://localhost:3000/auth/callback"
+)
+
+func testProvider(srv *oidctest.Server) *Provider {
+	return NewProvider(config.OIDCProviderConfig{
+		ID:       "test",
+		Name:     "Test",
+		Issuer:   srv.URL,
+		ClientID: testClientID,
+		Scopes:   []string{"openid", "email"},
+	})
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	srv := oidctest.NewServer(t)
+	authURL, err := testProvider(srv).AuthCodeURL(context.Background(), testRedirectURI, "the-state", "the-nonce", "the-verifier")
+	if err != nil {
+		t.Fatalf("auth code url: %v", err)
+	}
+	if !strings.HasPrefix(authURL, srv.URL+"/authorize?") {
+		t.Fatalf("auth url %s is not the discovered authorization endpoint", authURL)
+	}
+
+	u, _ := url.Parse(authURL)
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURI,
+		"scope":                 "openid email",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        CodeChallenge("the-verifier"),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := u.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	identity := oidctest.Identity{Subject: "sub-1", Email: "a@example.com", EmailVerified: true}
+
+	tests := []struct {
+		name        string
+		verifier    string // sent with the code; the request was made with "verifier"
+		nonce       string // expected; the request was made with "nonce"
+		tokenIssuer string // iss of the id token; "" is the provider's own
+		wantErr     string
+	}{
+		{name: "valid", verifier: "verifier", nonce: "nonce"},
+		{name: "wrong PKCE verifier", verifier: "other", nonce: "nonce", wantErr: "invalid_grant"},
+		{name: "nonce mismatch", verifier: "verifier", nonce: "other", wantErr: "nonce mismatch"},
+		{name: "foreign token issuer", verifier: "verifier", nonce: "nonce", tokenIssuer: "https://evil.example.com", wantErr: "invalid issuer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv := oidctest.NewServer(t)
+			if tt.tokenIssuer != "" {
+				srv.TokenIssuer = tt.tokenIssuer
+			}
+			p := testProvider(srv)
+
+			authURL, err := p.AuthCodeURL(ctx, testRedirectURI, "state", "nonce", "verifier")
+			if err != nil {
+				t.Fatalf("auth code url: %v", err)
+			}
+			code, _ := srv.Authorize(t, authURL, identity)
+
+			claims, err := p.Exchange(ctx, testRedirectURI, code, tt.verifier, tt.nonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("exchange error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("exchange: %v", err)
+			}
+			if claims.Subject != identity.Subject || claims.VerifiedEmail() != identity.Email {
+				t.Errorf("claims = %s %q, want %s %q", claims.Subject, claims.VerifiedEmail(), identity.Subject, identity.Email)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeOnce(t *testing.T) {
+	ctx := context.Background()
+	srv := oidctest.NewServer(t)
+	p := testProvider(srv)
+
+	authURL, err := p.AuthCodeURL(ctx, testRedirectURI, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("auth code url: %v", err)
+	}
+	code, _ := srv.Authorize(t, authURL, oidctest.Identity{Subject: "sub-1"})
+	if _, err := p.Exchange(ctx, testRedirectURI, code, "verifier", "nonce"); err != nil {
+		t.Fatalf("first exchange: %v", err)
+	}
+	if _, err := p.Exchange(ctx, testRedirectURI, code, "verifier", "nonce"); err == nil {
+		t.Fatal("second exchange of the same code succeeded")
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	srv := oidctest.NewServer(t)
+	srv.DiscoveryIssuer = "https://evil.example.com"
+
+	_, err := testProvider(srv).AuthCodeURL(context.Background(), testRedirectURI, "state", "nonce", "verifier")
+	if err == nil || !strings.Contains(err.Error(), "returned issuer") {
+		t.Fatalf("auth code url error = %v, want an issuer mismatch", err)
+	}
+}
+
+func TestVerifiedEmail(t *testing.T) {
+	tests := []struct {
+		verified any
+		want     string
+	}{
+		{true, "a@example.com"},
+		{"true", "a@example.com"},
+		{false, ""},
+		{"false", ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		c := &Claims{Email: "a@example.com", EmailVerified: tt.verified}
+		if got := c.VerifiedEmail(); got != tt.want {
+			t.Errorf("VerifiedEmail() with %v = %q, want %q", tt.verified, got, tt.want)
+		}
+	}
+}
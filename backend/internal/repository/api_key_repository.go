@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// api key repository handles database operations for personal api keys
+type APIKeyRepository struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
+}
+
+// create new api key repository
+func NewAPIKeyRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *APIKeyRepository {
+	return &APIKeyRepository{
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// api key columns is the full column list scanned by scanAPIKey
+const apiKeyColumns = `id, user_id, name, prefix, secret_hash, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+// scan api key reads one row selected with apiKeyColumns
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	var scopes string
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.SecretHash,
+		&scopes,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Fields(scopes)
+	return key, nil
+}
+
+// create inserts a new api key
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	query := r.dialect.Rebind(`
+		INSERT INTO api_keys (id, user_id, name, prefix, secret_hash, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+
+	_, err := r.db.ExecContext(ctx, query,
+		key.ID,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		key.SecretHash,
+		strings.Join(key.Scopes, " "),
+		key.CreatedAt,
+		key.ExpiresAt,
+	)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", key.UserID).Error("failed to create api key")
+		return errors.NewInternalError("failed to save api key", err)
+	}
+
+	return nil
+}
+
+// find by prefix retrieves a key by its prefix, whatever its state
+func (r *APIKeyRepository) FindByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	query := r.dialect.Rebind(`
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE prefix = ?
+	`)
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, prefix))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		r.logger.WithError(err).Error("failed to find api key")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return key, nil
+}
+
+// list by user returns a user's keys that haven't been revoked, newest first
+func (r *APIKeyRepository) ListByUser(ctx context.Context, userID string) ([]*models.APIKey, error) {
+	query := r.dialect.Rebind(`
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`)
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to list api keys")
+		return nil, errors.NewInternalError("database error", err)
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			r.logger.WithError(err).Error("failed to scan api key row")
+			return nil, errors.NewInternalError("database error", err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("error iterating api keys")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return keys, nil
+}
+
+// revoke revokes one of a user's keys; returns false if the user has no such live key
+func (r *APIKeyRepository) Revoke(ctx context.Context, userID, id string) (bool, error) {
+	query := r.dialect.Rebind(`
+		UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`)
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		r.logger.WithError(err).WithField("api_key_id", id).Error("failed to revoke api key")
+		return false, errors.NewInternalError("failed to revoke api key", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// touch records that a key was just used
+func (r *APIKeyRepository) Touch(ctx context.Context, id string) error {
+	query := r.dialect.Rebind("UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?")
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		r.logger.WithError(err).WithField("api_key_id", id).Error("failed to update api key last use")
+		return errors.NewInternalError("database error", err)
+	}
+	return nil
+}
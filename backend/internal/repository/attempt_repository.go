@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"konbi/internal/errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// attempt repository is the database-backed store of unsuccessful login and passcode attempts,
+// shared by every instance pointing at the same database
+type AttemptRepository struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
+}
+
+// create new attempt repository
+func NewAttemptRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *AttemptRepository {
+	return &AttemptRepository{
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// reserve counts an attempt at now unless key is locked. the count is bumped with a
+// compare-and-swap on the count that was read, so of several instances deciding at once
+// only one moves each count forward and the others decide again against the new one.
+func (r *AttemptRepository) Reserve(ctx context.Context, key string, now time.Time, window time.Duration, lockout func(int) time.Duration) (time.Duration, int, error) {
+	now = now.UTC()
+	expiresAt := now.Add(window)
+	selectQuery := r.dialect.Rebind("SELECT failures, last_failure_at, expires_at FROM failed_attempts WHERE attempt_key = ?")
+	insertQuery := r.dialect.Rebind(r.dialect.Upsert("failed_attempts", []string{"attempt_key", "failures", "last_failure_at", "expires_at"}, []string{"attempt_key"}, nil))
+	updateQuery := r.dialect.Rebind(`
+		UPDATE failed_attempts SET failures = ?, last_failure_at = ?, expires_at = ?
+		WHERE attempt_key = ? AND failures = ?
+	`)
+
+	for {
+		var stored int
+		var lastFailure, storedExpiry time.Time
+		err := r.db.QueryRowContext(ctx, selectQuery, key).Scan(&stored, &lastFailure, &storedExpiry)
+		if err == sql.ErrNoRows {
+			result, err := r.db.ExecContext(ctx, insertQuery, key, 1, now, expiresAt)
+			if err != nil {
+				r.logger.WithError(err).WithField("key", key).Error("failed to record attempt")
+				return 0, 0, errors.NewInternalError("database error", err)
+			}
+			if rows, _ := result.RowsAffected(); rows == 1 {
+				return 0, 1, nil
+			}
+			continue // another attempt created the counter first
+		}
+		if err != nil {
+			r.logger.WithError(err).WithField("key", key).Error("failed to read failed attempts")
+			return 0, 0, errors.NewInternalError("database error", err)
+		}
+
+		// a count whose window has passed starts over
+		failures := stored
+		if !storedExpiry.After(now) {
+			failures = 0
+		}
+		if remaining := lastFailure.Add(lockout(failures)).Sub(now); failures > 0 && remaining > 0 {
+			return remaining, failures, nil
+		}
+
+		result, err := r.db.ExecContext(ctx, updateQuery, failures+1, now, expiresAt, key, stored)
+		if err != nil {
+			r.logger.WithError(err).WithField("key", key).Error("failed to record attempt")
+			return 0, 0, errors.NewInternalError("database error", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 1 {
+			return 0, failures + 1, nil
+		}
+		// another attempt changed the count in between; decide again against it
+	}
+}
+
+// reset forgets the failures of key
+func (r *AttemptRepository) Reset(ctx context.Context, key string) error {
+	query := r.dialect.Rebind("DELETE FROM failed_attempts WHERE attempt_key = ?")
+	if _, err := r.db.ExecContext(ctx, query, key); err != nil {
+		r.logger.WithError(err).WithField("key", key).Error("failed to reset failed attempts")
+		return errors.NewInternalError("database error", err)
+	}
+	return nil
+}
+
+// prune drops counters whose window has passed
+func (r *AttemptRepository) Prune(ctx context.Context) (int64, error) {
+	query := r.dialect.Rebind("DELETE FROM failed_attempts WHERE expires_at < CURRENT_TIMESTAMP")
+	result, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to prune failed attempts")
+		return 0, errors.NewInternalError("failed to prune failed attempts", err)
+	}
+	return result.RowsAffected()
+}
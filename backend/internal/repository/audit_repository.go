@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// audit repository handles database operations for the audit log
+type AuditRepository struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
+}
+
+// create new audit repository
+func NewAuditRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *AuditRepository {
+	return &AuditRepository{
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// audit columns is the full column list scanned by scanAuditEvent
+const auditColumns = `id, created_at, request_id, actor_type, actor_id, actor_role, actor_ip, action, target_type, target_id, outcome, detail`
+
+// scan audit event reads one row selected with auditColumns
+func scanAuditEvent(row rowScanner) (*models.AuditEvent, error) {
+	event := &models.AuditEvent{}
+	err := row.Scan(
+		&event.ID,
+		&event.CreatedAt,
+		&event.RequestID,
+		&event.ActorType,
+		&event.ActorID,
+		&event.ActorRole,
+		&event.ActorIP,
+		&event.Action,
+		&event.TargetType,
+		&event.TargetID,
+		&event.Outcome,
+		&event.Detail,
+	)
+	return event, err
+}
+
+// create inserts an audit event
+func (r *AuditRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	query := r.dialect.Rebind(`
+		INSERT INTO audit_events (id, created_at, request_id, actor_type, actor_id, actor_role, actor_ip, action, target_type, target_id, outcome, detail)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	_, err := r.db.ExecContext(ctx, query,
+		event.ID,
+		event.CreatedAt,
+		event.RequestID,
+		event.ActorType,
+		event.ActorID,
+		event.ActorRole,
+		event.ActorIP,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.Outcome,
+		event.Detail,
+	)
+	if err != nil {
+		r.logger.WithError(err).WithField("action", event.Action).Error("failed to create audit event")
+		return errors.NewInternalError("failed to create audit event", err)
+	}
+	return nil
+}
+
+// search returns one page of events matching filter, newest first, and the total number of matches
+func (r *AuditRepository) Search(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, int, error) {
+	var conditions []string
+	var args []any
+	if filter.Action != "" {
+		if strings.HasSuffix(filter.Action, ".") {
+			conditions = append(conditions, "action LIKE ? ESCAPE '!'")
+			args = append(args, likeEscaper.Replace(filter.Action)+"%")
+		} else {
+			conditions = append(conditions, "action = ?")
+			args = append(args, filter.Action)
+		}
+	}
+	if filter.ActorID != "" {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, filter.ActorID)
+	}
+	if filter.ActorIP != "" {
+		conditions = append(conditions, "actor_ip = ?")
+		args = append(args, filter.ActorIP)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.Outcome != "" {
+		conditions = append(conditions, "outcome = ?")
+		args = append(args, filter.Outcome)
+	}
+	if filter.RequestID != "" {
+		conditions = append(conditions, "request_id = ?")
+		args = append(args, filter.RequestID)
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC())
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	countQuery := r.dialect.Rebind("SELECT COUNT(*) FROM audit_events" + where)
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		r.logger.WithError(err).Error("failed to count audit events")
+		return nil, 0, errors.NewInternalError("database error", err)
+	}
+
+	query := r.dialect.Rebind("SELECT " + auditColumns + " FROM audit_events" + where + " ORDER BY created_at DESC, id ASC LIMIT ? OFFSET ?")
+	rows, err := r.db.QueryContext(ctx, query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to search audit events")
+		return nil, 0, errors.NewInternalError("database error", err)
+	}
+	defer rows.Close()
+
+	events := []*models.AuditEvent{}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			r.logger.WithError(err).Error("failed to scan audit event row")
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithError(err).Error("error iterating audit events")
+		return nil, 0, errors.NewInternalError("database error", err)
+	}
+
+	return events, total, nil
+}
+
+// delete before removes events older than cutoff and returns how many were removed
+func (r *AuditRepository) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := r.dialect.Rebind(`DELETE FROM audit_events WHERE created_at < ?`)
+	result, err := r.db.ExecContext(ctx, query, cutoff.UTC())
+	if err != nil {
+		r.logger.WithError(err).Error("failed to prune audit events")
+		return 0, errors.NewInternalError("database error", err)
+	}
+	return result.RowsAffected()
+}
@@ -6,60 +6,90 @@ import (
 	"fmt"
 	"konbi/internal/errors"
 	"konbi/internal/models"
-	"os"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
 // content repository handles database operations for content
 type ContentRepository struct {
-	db         *sql.DB
-	logger     *logrus.Logger
-	isPostgres bool
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
 }
 
 // create new repository
-func NewContentRepository(db *sql.DB, logger *logrus.Logger) *ContentRepository {
+func NewContentRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *ContentRepository {
 	return &ContentRepository{
-		db:         db,
-		logger:     logger,
-		isPostgres: os.Getenv("DATABASE_URL") != "",
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
 	}
 }
 
-// helper to get current timestamp function based on database type
-// for postgresql, always use UTC to match Go's time.Now().UTC()
-func (r *ContentRepository) nowFunc() string {
-	if r.isPostgres {
-		return "(NOW() AT TIME ZONE 'UTC')"
-	}
-	return "datetime('now')"
+// content columns is the full column list scanned by scanContent
+const contentColumns = `id, code, bundle_id, user_id, type, title, filename, filepath, filesize, content_hash, content, passcode_hash, management_token_hash, created_at, expires_at, view_count, max_views, deleted_at, mime_type`
+
+// row scanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-// helper to convert ? placeholders to postgresql $1, $2, etc
-func (r *ContentRepository) convertQuery(query string) string {
-	return convertQuery(r.isPostgres, query)
+// scan content reads one row selected with contentColumns
+func scanContent(row rowScanner) (*models.Content, error) {
+	content := &models.Content{}
+	err := row.Scan(
+		&content.ID,
+		&content.Code,
+		&content.BundleID,
+		&content.UserID,
+		&content.Type,
+		&content.Title,
+		&content.Filename,
+		&content.Filepath,
+		&content.Filesize,
+		&content.ContentHash,
+		&content.Content,
+		&content.PasscodeHash,
+		&content.ManagementTokenHash,
+		&content.CreatedAt,
+		&content.ExpiresAt,
+		&content.ViewCount,
+		&content.MaxViews,
+		&content.DeletedAt,
+		&content.MimeType,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
 }
 
 // create inserts new content record
 func (r *ContentRepository) Create(ctx context.Context, content *models.Content) error {
-	query := r.convertQuery(`
-		INSERT INTO content (id, code, bundle_id, type, title, filename, filepath, filesize, content, passcode_hash, expires_at, view_count)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
+	query := r.dialect.Rebind(`
+		INSERT INTO content (id, code, bundle_id, user_id, type, title, filename, filepath, filesize, content_hash, mime_type, content, passcode_hash, management_token_hash, expires_at, max_views, uploader_ip, view_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0)
 	`)
 
 	_, err := r.db.ExecContext(ctx, query,
 		content.ID,
 		content.Code,
 		content.BundleID,
+		content.UserID,
 		content.Type,
 		content.Title,
 		content.Filename,
 		content.Filepath,
 		content.Filesize,
+		content.ContentHash,
+		content.MimeType,
 		content.Content,
 		content.PasscodeHash,
+		content.ManagementTokenHash,
 		content.ExpiresAt,
+		content.MaxViews,
+		content.UploaderIP,
 	)
 
 	if err != nil {
@@ -77,29 +107,13 @@ func (r *ContentRepository) Create(ctx context.Context, content *models.Content)
 
 // find by id retrieves content by id
 func (r *ContentRepository) FindByID(ctx context.Context, id string) (*models.Content, error) {
-	query := r.convertQuery(fmt.Sprintf(`
-		SELECT id, code, bundle_id, type, title, filename, filepath, filesize, content, passcode_hash, created_at, expires_at, view_count, deleted_at
+	query := r.dialect.Rebind(`
+		SELECT ` + contentColumns + `
 		FROM content
 		WHERE id = ? AND deleted_at IS NULL
-	`))
+	`)
 
-	content := &models.Content{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&content.ID,
-		&content.Code,
-		&content.BundleID,
-		&content.Type,
-		&content.Title,
-		&content.Filename,
-		&content.Filepath,
-		&content.Filesize,
-		&content.Content,
-		&content.PasscodeHash,
-		&content.CreatedAt,
-		&content.ExpiresAt,
-		&content.ViewCount,
-		&content.DeletedAt,
-	)
+	content, err := scanContent(r.db.QueryRowContext(ctx, query, id))
 
 	if err == sql.ErrNoRows {
 		return nil, errors.NewNotFoundError("content not found")
@@ -114,29 +128,13 @@ func (r *ContentRepository) FindByID(ctx context.Context, id string) (*models.Co
 
 // find active by id retrieves non-expired content
 func (r *ContentRepository) FindActiveByID(ctx context.Context, id string) (*models.Content, error) {
-	query := r.convertQuery(fmt.Sprintf(`
-		SELECT id, code, bundle_id, type, title, filename, filepath, filesize, content, passcode_hash, created_at, expires_at, view_count, deleted_at
+	query := r.dialect.Rebind(`
+		SELECT ` + contentColumns + `
 		FROM content
-		WHERE id = ? AND expires_at > %s AND deleted_at IS NULL
-	`, r.nowFunc()))
+		WHERE id = ? AND expires_at > CURRENT_TIMESTAMP AND deleted_at IS NULL
+	`)
 
-	content := &models.Content{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&content.ID,
-		&content.Code,
-		&content.BundleID,
-		&content.Type,
-		&content.Title,
-		&content.Filename,
-		&content.Filepath,
-		&content.Filesize,
-		&content.Content,
-		&content.PasscodeHash,
-		&content.CreatedAt,
-		&content.ExpiresAt,
-		&content.ViewCount,
-		&content.DeletedAt,
-	)
+	content, err := scanContent(r.db.QueryRowContext(ctx, query, id))
 
 	if err == sql.ErrNoRows {
 		return nil, errors.NewNotFoundError("content not found or expired")
@@ -149,10 +147,31 @@ func (r *ContentRepository) FindActiveByID(ctx context.Context, id string) (*mod
 	return content, nil
 }
 
+// find active by code retrieves non-expired top-level content by its share code
+func (r *ContentRepository) FindActiveByCode(ctx context.Context, code string) (*models.Content, error) {
+	query := r.dialect.Rebind(`
+		SELECT ` + contentColumns + `
+		FROM content
+		WHERE code = ? AND expires_at > CURRENT_TIMESTAMP AND deleted_at IS NULL
+	`)
+
+	content, err := scanContent(r.db.QueryRowContext(ctx, query, code))
+
+	if err == sql.ErrNoRows {
+		return nil, errors.NewNotFoundError("content not found or expired")
+	}
+	if err != nil {
+		r.logger.WithError(err).WithField("code", code).Error("failed to find content by code")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return content, nil
+}
+
 // id exists checks if content id already exists
 func (r *ContentRepository) IDExists(ctx context.Context, id string) (bool, error) {
 	var exists bool
-	query := r.convertQuery("SELECT EXISTS(SELECT 1 FROM content WHERE id = ?)")
+	query := r.dialect.Rebind("SELECT EXISTS(SELECT 1 FROM content WHERE id = ?)")
 	err := r.db.QueryRowContext(ctx, query, id).Scan(&exists)
 	if err != nil {
 		r.logger.WithError(err).WithField("content_id", id).Error("failed to check id existence")
@@ -161,49 +180,122 @@ func (r *ContentRepository) IDExists(ctx context.Context, id string) (bool, erro
 	return exists, nil
 }
 
-// increment view count increases view counter
-func (r *ContentRepository) IncrementViewCount(ctx context.Context, id string) error {
-	query := r.convertQuery("UPDATE content SET view_count = view_count + 1 WHERE id = ?")
-	_, err := r.db.ExecContext(ctx, query, id)
+// code exists checks if a share code is already taken, including by expired or deleted content
+func (r *ContentRepository) CodeExists(ctx context.Context, code string) (bool, error) {
+	var exists bool
+	query := r.dialect.Rebind("SELECT EXISTS(SELECT 1 FROM content WHERE code = ?)")
+	err := r.db.QueryRowContext(ctx, query, code).Scan(&exists)
 	if err != nil {
-		r.logger.WithError(err).WithField("content_id", id).Error("failed to increment view count")
-		return errors.NewInternalError("failed to update view count", err)
+		r.logger.WithError(err).WithField("code", code).Error("failed to check code existence")
+		return false, errors.NewInternalError("database error", err)
 	}
-	return nil
+	return exists, nil
+}
+
+// consume view counts one view, but only while the content is live and under its view limit.
+// the check and the increment are a single statement, so concurrent readers can't overrun max_views.
+// returns false when no view was left to consume.
+func (r *ContentRepository) ConsumeView(ctx context.Context, id string) (bool, error) {
+	query := r.dialect.Rebind(`
+		UPDATE content SET view_count = view_count + 1
+		WHERE id = ? AND expires_at > CURRENT_TIMESTAMP AND deleted_at IS NULL
+		AND (max_views IS NULL OR view_count < max_views)
+	`)
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		r.logger.WithError(err).WithField("content_id", id).Error("failed to consume view")
+		return false, errors.NewInternalError("failed to update view count", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
 }
 
-// list all retrieves all content (for admin)
-func (r *ContentRepository) ListAll(ctx context.Context) ([]*models.Content, error) {
-	query := fmt.Sprintf(`
-		SELECT id, code, type, title, filename, filesize, passcode_hash, created_at, expires_at, view_count, deleted_at
+// search lists content for the admin api, newest first, including bundle files.
+// it returns up to filter.Limit items after cursor; the caller asks for one more than a page to detect the next one.
+func (r *ContentRepository) Search(ctx context.Context, filter *models.ContentFilter, cursor *models.ContentCursor) ([]*models.Content, error) {
+	var conditions []string
+	var args []any
+
+	if filter.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.OwnerID == models.OwnerAnonymous {
+		conditions = append(conditions, "user_id IS NULL")
+	} else if filter.OwnerID != "" {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.OwnerID)
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, timestampParam(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, timestampParam(*filter.CreatedBefore))
+	}
+	if filter.MinSize != nil {
+		conditions = append(conditions, "filesize >= ?")
+		args = append(args, *filter.MinSize)
+	}
+	if filter.MaxSize != nil {
+		conditions = append(conditions, "filesize <= ?")
+		args = append(args, *filter.MaxSize)
+	}
+	if filter.HasPasscode != nil {
+		if *filter.HasPasscode {
+			conditions = append(conditions, "(passcode_hash IS NOT NULL AND TRIM(passcode_hash) <> '')")
+		} else {
+			conditions = append(conditions, "(passcode_hash IS NULL OR TRIM(passcode_hash) = '')")
+		}
+	}
+	if filter.Expired != nil {
+		if *filter.Expired {
+			conditions = append(conditions, expiredCondition)
+		} else {
+			conditions = append(conditions, "NOT "+expiredCondition)
+		}
+	}
+	if filter.Deleted != nil {
+		if *filter.Deleted {
+			conditions = append(conditions, "deleted_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "deleted_at IS NULL")
+		}
+	}
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(filter.Search)) + "%"
+		conditions = append(conditions, "(LOWER(filename) LIKE ? ESCAPE '!' OR LOWER(title) LIKE ? ESCAPE '!')")
+		args = append(args, pattern, pattern)
+	}
+	if cursor != nil {
+		conditions = append(conditions, "(created_at < ? OR (created_at = ? AND id < ?))")
+		args = append(args, timestampParam(cursor.CreatedAt), timestampParam(cursor.CreatedAt), cursor.ID)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	query := r.dialect.Rebind(`
+		SELECT ` + contentColumns + `
 		FROM content
-		WHERE deleted_at IS NULL
-		ORDER BY created_at DESC
+		` + where + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
 	`)
+	args = append(args, filter.Limit)
 
-	rows, err := r.db.QueryContext(ctx, query)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		r.logger.WithError(err).Error("failed to list content")
+		r.logger.WithError(err).Error("failed to search content")
 		return nil, errors.NewInternalError("database error", err)
 	}
 	defer rows.Close()
 
-	var contents []*models.Content
+	contents := []*models.Content{}
 	for rows.Next() {
-		content := &models.Content{}
-		err := rows.Scan(
-			&content.ID,
-			&content.Code,
-			&content.Type,
-			&content.Title,
-			&content.Filename,
-			&content.Filesize,
-			&content.PasscodeHash,
-			&content.CreatedAt,
-			&content.ExpiresAt,
-			&content.ViewCount,
-			&content.DeletedAt,
-		)
+		content, err := scanContent(rows)
 		if err != nil {
 			r.logger.WithError(err).Error("failed to scan content row")
 			continue
@@ -211,16 +303,79 @@ func (r *ContentRepository) ListAll(ctx context.Context) ([]*models.Content, err
 		contents = append(contents, content)
 	}
 
+	if err := rows.Err(); err != nil {
+		r.logger.WithError(err).Error("error iterating content search")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
 	return contents, nil
 }
 
-// find expired content retrieves expired file content
+// like escaper escapes LIKE wildcards for use with ESCAPE '!'
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// list by user retrieves a page of a user's active top-level shares, newest first, with the total count.
+// files inside a bundle are listed through their bundle.
+func (r *ContentRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]*models.Content, int, error) {
+	var total int
+	countQuery := r.dialect.Rebind(`
+		SELECT COUNT(*)
+		FROM content
+		WHERE user_id = ? AND bundle_id IS NULL AND expires_at > CURRENT_TIMESTAMP AND deleted_at IS NULL
+	`)
+	if err := r.db.QueryRowContext(ctx, countQuery, userID).Scan(&total); err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to count user content")
+		return nil, 0, errors.NewInternalError("database error", err)
+	}
+
+	query := r.dialect.Rebind(`
+		SELECT ` + contentColumns + `
+		FROM content
+		WHERE user_id = ? AND bundle_id IS NULL AND expires_at > CURRENT_TIMESTAMP AND deleted_at IS NULL
+		ORDER BY created_at DESC, id ASC
+		LIMIT ? OFFSET ?
+	`)
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to list user content")
+		return nil, 0, errors.NewInternalError("database error", err)
+	}
+	defer rows.Close()
+
+	contents := []*models.Content{}
+	for rows.Next() {
+		content, err := scanContent(rows)
+		if err != nil {
+			r.logger.WithError(err).Error("failed to scan content row")
+			continue
+		}
+		contents = append(contents, content)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("error iterating user content")
+		return nil, 0, errors.NewInternalError("database error", err)
+	}
+
+	return contents, total, nil
+}
+
+// exhausted condition matches content that used up its views, including the files of such a bundle
+const exhaustedCondition = `(view_count >= max_views OR bundle_id IN (SELECT id FROM content WHERE view_count >= max_views))`
+
+// expired condition matches content past its expiry or out of views. unlike exhaustedCondition
+// it is never NULL, so it can be negated.
+const expiredCondition = `(expires_at < CURRENT_TIMESTAMP OR (CASE WHEN ` + exhaustedCondition + ` THEN 1 ELSE 0 END) = 1)`
+
+// find expired content retrieves expired file content. soft-deleted rows are included: their
+// records are removed with the rest, and a blob kept for a possible restore has to go with them.
 func (r *ContentRepository) FindExpiredContent(ctx context.Context) ([]*models.Content, error) {
-	query := r.convertQuery(fmt.Sprintf(`
+	query := r.dialect.Rebind(`
 		SELECT id, filepath
 		FROM content
-		WHERE expires_at < %s AND type = ? AND deleted_at IS NULL
-	`, r.nowFunc()))
+		WHERE (expires_at < CURRENT_TIMESTAMP OR ` + exhaustedCondition + `) AND type = ? AND filepath IS NOT NULL
+	`)
 
 	rows, err := r.db.QueryContext(ctx, query, models.ContentTypeFile)
 	if err != nil {
@@ -243,16 +398,61 @@ func (r *ContentRepository) FindExpiredContent(ctx context.Context) ([]*models.C
 	return contents, nil
 }
 
+// update saves the owner-editable fields of a content record.
+// a bundle's files share its expiry, so changing it on a bundle moves them along.
+func (r *ContentRepository) Update(ctx context.Context, content *models.Content) error {
+	return r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := r.dialect.Rebind(`
+			UPDATE content
+			SET title = ?, filename = ?, passcode_hash = ?, expires_at = ?
+			WHERE id = ? AND deleted_at IS NULL
+		`)
+		result, err := tx.ExecContext(ctx, query,
+			content.Title,
+			content.Filename,
+			content.PasscodeHash,
+			content.ExpiresAt,
+			content.ID,
+		)
+		if err != nil {
+			r.logger.WithError(err).WithField("content_id", content.ID).Error("failed to update content")
+			return errors.NewInternalError("failed to update content", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return errors.NewNotFoundError("content not found")
+		}
+
+		if content.Type == models.ContentTypeBundle {
+			query := r.dialect.Rebind("UPDATE content SET expires_at = ? WHERE bundle_id = ? AND deleted_at IS NULL")
+			if _, err := tx.ExecContext(ctx, query, content.ExpiresAt, content.ID); err != nil {
+				r.logger.WithError(err).WithField("bundle_id", content.ID).Error("failed to update bundle files")
+				return errors.NewInternalError("failed to update content", err)
+			}
+		}
+
+		return nil
+	})
+}
+
 // soft delete marks content as deleted
 func (r *ContentRepository) SoftDelete(ctx context.Context, id string) error {
-	query := r.convertQuery(fmt.Sprintf("UPDATE content SET deleted_at = %s WHERE id = ?", r.nowFunc()))
-	result, err := r.db.ExecContext(ctx, query, id)
+	var rows int64
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		if err := r.adjustUsage(ctx, tx, -1, "id = ?", id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, r.dialect.Rebind("UPDATE content SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?"), id)
+		if err != nil {
+			return err
+		}
+		rows, _ = result.RowsAffected()
+		return nil
+	})
 	if err != nil {
 		r.logger.WithError(err).WithField("content_id", id).Error("failed to soft delete content")
 		return errors.NewInternalError("failed to delete content", err)
 	}
 
-	rows, _ := result.RowsAffected()
 	if rows == 0 {
 		return errors.NewNotFoundError("content not found")
 	}
@@ -261,32 +461,261 @@ func (r *ContentRepository) SoftDelete(ctx context.Context, id string) error {
 	return nil
 }
 
+// usage by address sums up the live anonymous shares uploaded from ip. like a user's counters
+// it includes expired content the cleanup routine hasn't removed yet.
+func (r *ContentRepository) UsageByAddress(ctx context.Context, ip string) (*models.StorageUsage, error) {
+	query := r.dialect.Rebind(`
+		SELECT COALESCE(SUM(CASE WHEN bundle_id IS NULL THEN 1 ELSE 0 END), 0), COALESCE(SUM(filesize), 0)
+		FROM content
+		WHERE uploader_ip = ? AND user_id IS NULL AND deleted_at IS NULL
+	`)
+
+	usage := &models.StorageUsage{}
+	if err := r.db.QueryRowContext(ctx, query, ip).Scan(&usage.Items, &usage.Bytes); err != nil {
+		r.logger.WithError(err).WithField("ip", ip).Error("failed to sum anonymous content")
+		return nil, errors.NewInternalError("database error", err)
+	}
+	return usage, nil
+}
+
+// total stored bytes sums the files of every record, soft-deleted ones included since
+// their blobs are kept until cleanup
+func (r *ContentRepository) TotalStoredBytes(ctx context.Context) (int64, error) {
+	var total int64
+	if err := r.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(filesize), 0) FROM content").Scan(&total); err != nil {
+		r.logger.WithError(err).Error("failed to sum stored bytes")
+		return 0, errors.NewInternalError("database error", err)
+	}
+	return total, nil
+}
+
+// adjust usage moves the storage counters of the users owning the rows that match cond by sign
+// times their size: -1 for live rows about to be deleted, +1 for deleted rows about to be restored.
+// it runs in the transaction making that change, so the counters always match the live content.
+func (r *ContentRepository) adjustUsage(ctx context.Context, tx *sql.Tx, sign int, cond string, args ...any) error {
+	state := "deleted_at IS NULL"
+	if sign > 0 {
+		state = "deleted_at IS NOT NULL"
+	}
+	match := "(" + cond + ") AND " + state
+	query := r.dialect.Rebind(`
+		UPDATE users SET
+			storage_bytes = storage_bytes + ? * (SELECT COALESCE(SUM(filesize), 0) FROM content WHERE content.user_id = users.id AND ` + match + `),
+			storage_items = storage_items + ? * (SELECT COUNT(*) FROM content WHERE content.user_id = users.id AND content.bundle_id IS NULL AND ` + match + `)
+		WHERE id IN (SELECT user_id FROM content WHERE user_id IS NOT NULL AND ` + match + `)
+	`)
+
+	params := []any{sign}
+	params = append(params, args...)
+	params = append(params, sign)
+	params = append(params, args...)
+	params = append(params, args...)
+	_, err := tx.ExecContext(ctx, query, params...)
+	return err
+}
+
+// find any by id retrieves content whatever its state, expired or soft-deleted
+func (r *ContentRepository) FindAnyByID(ctx context.Context, id string) (*models.Content, error) {
+	query := r.dialect.Rebind(`
+		SELECT ` + contentColumns + `
+		FROM content
+		WHERE id = ?
+	`)
+
+	content, err := scanContent(r.db.QueryRowContext(ctx, query, id))
+
+	if err == sql.ErrNoRows {
+		return nil, errors.NewNotFoundError("content not found")
+	}
+	if err != nil {
+		r.logger.WithError(err).WithField("content_id", id).Error("failed to find content")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return content, nil
+}
+
+// find all bundle files retrieves every file of a bundle whatever its state
+func (r *ContentRepository) FindAllBundleFiles(ctx context.Context, bundleID string) ([]*models.Content, error) {
+	query := r.dialect.Rebind(`
+		SELECT ` + contentColumns + `
+		FROM content
+		WHERE bundle_id = ?
+		ORDER BY created_at ASC
+	`)
+
+	rows, err := r.db.QueryContext(ctx, query, bundleID)
+	if err != nil {
+		r.logger.WithError(err).WithField("bundle_id", bundleID).Error("failed to find bundle files")
+		return nil, errors.NewInternalError("database error", err)
+	}
+	defer rows.Close()
+
+	var contents []*models.Content
+	for rows.Next() {
+		content, err := scanContent(rows)
+		if err != nil {
+			r.logger.WithError(err).Error("failed to scan bundle file row")
+			continue
+		}
+		contents = append(contents, content)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithError(err).WithField("bundle_id", bundleID).Error("error iterating bundle files")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return contents, nil
+}
+
+// set deleted soft-deletes or restores content together with the files of a bundle.
+// blobs are left alone so a soft delete can be undone.
+func (r *ContentRepository) SetDeleted(ctx context.Context, id string, deleted bool) error {
+	query := "UPDATE content SET deleted_at = NULL WHERE (id = ? OR bundle_id = ?) AND deleted_at IS NOT NULL"
+	if deleted {
+		query = "UPDATE content SET deleted_at = CURRENT_TIMESTAMP WHERE (id = ? OR bundle_id = ?) AND deleted_at IS NULL"
+	}
+
+	sign := 1
+	if deleted {
+		sign = -1
+	}
+
+	var rows int64
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		if err := r.adjustUsage(ctx, tx, sign, "id = ? OR bundle_id = ?", id, id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, r.dialect.Rebind(query), id, id)
+		if err != nil {
+			return err
+		}
+		rows, _ = result.RowsAffected()
+		return nil
+	})
+	if err != nil {
+		r.logger.WithError(err).WithField("content_id", id).Error("failed to update content deletion")
+		return errors.NewInternalError("failed to update content", err)
+	}
+
+	if rows == 0 {
+		return errors.NewNotFoundError("content not found")
+	}
+	return nil
+}
+
+// purge permanently removes content and the files of a bundle, whatever their state,
+// and returns the storage keys of their blobs so the caller can remove them
+func (r *ContentRepository) Purge(ctx context.Context, id string) ([]string, error) {
+	var keys []string
+	found := false
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := r.dialect.Rebind("SELECT filepath FROM content WHERE id = ? OR bundle_id = ?")
+		rows, err := tx.QueryContext(ctx, query, id, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var key *string
+			if err := rows.Scan(&key); err != nil {
+				return err
+			}
+			found = true
+			if key != nil {
+				keys = append(keys, *key)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if err := r.adjustUsage(ctx, tx, -1, "id = ? OR bundle_id = ?", id, id); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, r.dialect.Rebind("DELETE FROM content WHERE id = ? OR bundle_id = ?"), id, id)
+		return err
+	})
+	if err != nil {
+		r.logger.WithError(err).WithField("content_id", id).Error("failed to purge content")
+		return nil, errors.NewInternalError("failed to delete content", err)
+	}
+	if !found {
+		return nil, errors.NewNotFoundError("content not found")
+	}
+
+	r.logger.WithFields(logrus.Fields{"content_id": id, "blobs": len(keys)}).Info("content purged")
+	return keys, nil
+}
+
 // delete expired permanently removes expired records
 func (r *ContentRepository) DeleteExpired(ctx context.Context) (int64, error) {
-	query := fmt.Sprintf("DELETE FROM content WHERE expires_at < %s", r.nowFunc())
-	result, err := r.db.ExecContext(ctx, query)
+	cond := "expires_at < CURRENT_TIMESTAMP OR " + exhaustedCondition
+	var count int64
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		if err := r.adjustUsage(ctx, tx, -1, cond); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, r.dialect.Rebind("DELETE FROM content WHERE "+cond))
+		if err != nil {
+			return err
+		}
+		count, err = result.RowsAffected()
+		return err
+	})
 	if err != nil {
 		r.logger.WithError(err).Error("failed to delete expired content")
 		return 0, errors.NewInternalError("failed to delete expired content", err)
 	}
+	r.logger.WithField("deleted_count", count).Info("expired content deleted")
+	return count, nil
+}
+
+// delete by user permanently removes every record a user owns, bundle files included,
+// and returns the storage keys of their blobs so the caller can remove them
+func (r *ContentRepository) DeleteByUser(ctx context.Context, userID string) ([]string, error) {
+	var keys []string
+	err := r.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := r.dialect.Rebind("SELECT filepath FROM content WHERE user_id = ? AND filepath IS NOT NULL")
+		rows, err := tx.QueryContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
 
-	count, err := result.RowsAffected()
+		_, err = tx.ExecContext(ctx, r.dialect.Rebind("DELETE FROM content WHERE user_id = ?"), userID)
+		return err
+	})
 	if err != nil {
-		r.logger.WithError(err).Error("failed to get affected rows after delete expired")
-		return 0, errors.NewInternalError("failed to count deleted rows", err)
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to delete user content")
+		return nil, errors.NewInternalError("failed to delete content", err)
 	}
-	r.logger.WithField("deleted_count", count).Info("expired content deleted")
-	return count, nil
+
+	r.logger.WithFields(logrus.Fields{"user_id": userID, "blobs": len(keys)}).Info("user content deleted")
+	return keys, nil
 }
 
 // find bundle files retrieves all active files belonging to a bundle
 func (r *ContentRepository) FindBundleFiles(ctx context.Context, bundleID string) ([]*models.Content, error) {
-	query := r.convertQuery(fmt.Sprintf(`
-		SELECT id, code, bundle_id, type, title, filename, filepath, filesize, content, passcode_hash, created_at, expires_at, view_count, deleted_at
+	query := r.dialect.Rebind(`
+		SELECT ` + contentColumns + `
 		FROM content
-		WHERE bundle_id = ? AND type = ? AND expires_at > %s AND deleted_at IS NULL
+		WHERE bundle_id = ? AND type = ? AND expires_at > CURRENT_TIMESTAMP AND deleted_at IS NULL
 		ORDER BY created_at ASC
-	`, r.nowFunc()))
+	`)
 
 	rows, err := r.db.QueryContext(ctx, query, bundleID, models.ContentTypeFile)
 	if err != nil {
@@ -297,23 +726,7 @@ func (r *ContentRepository) FindBundleFiles(ctx context.Context, bundleID string
 
 	var contents []*models.Content
 	for rows.Next() {
-		content := &models.Content{}
-		err := rows.Scan(
-			&content.ID,
-			&content.Code,
-			&content.BundleID,
-			&content.Type,
-			&content.Title,
-			&content.Filename,
-			&content.Filepath,
-			&content.Filesize,
-			&content.Content,
-			&content.PasscodeHash,
-			&content.CreatedAt,
-			&content.ExpiresAt,
-			&content.ViewCount,
-			&content.DeletedAt,
-		)
+		content, err := scanContent(rows)
 		if err != nil {
 			r.logger.WithError(err).Error("failed to scan bundle file row")
 			continue
@@ -359,4 +772,4 @@ func (r *ContentRepository) WithTransaction(ctx context.Context, fn func(*sql.Tx
 	}
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,428 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"konbi/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestContentRepositoryLookups(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewContentRepository(tdb.db, tdb.dialect, testLogger())
+		user := createTestUser(t, tdb, "owner@example.com")
+
+		live := createTestContent(t, tdb, &models.Content{
+			Code:                ptr("LIVE01"),
+			UserID:              &user.ID,
+			Filename:            ptr("live.txt"),
+			Filepath:            ptr("live-key"),
+			Filesize:            ptr(int64(10)),
+			ContentHash:         ptr("abc"),
+			MimeType:            ptr("text/plain; charset=utf-8"),
+			ManagementTokenHash: ptr("mgmt"),
+			MaxViews:            ptr(2),
+		})
+		expired := createTestContent(t, tdb, &models.Content{
+			Code:      ptr("OLD001"),
+			Filepath:  ptr("old-key"),
+			Filesize:  ptr(int64(5)),
+			ExpiresAt: time.Now().UTC().Add(-time.Hour),
+		})
+
+		found, err := repo.FindActiveByID(ctx, live.ID)
+		if err != nil {
+			t.Fatalf("find active: %v", err)
+		}
+		if *found.Code != "LIVE01" || *found.UserID != user.ID || *found.Filesize != 10 || *found.ContentHash != "abc" ||
+			*found.MimeType != "text/plain; charset=utf-8" || *found.ManagementTokenHash != "mgmt" || *found.MaxViews != 2 || found.ViewCount != 0 {
+			t.Errorf("found content = %+v", found)
+		}
+		if found, err := repo.FindActiveByCode(ctx, "LIVE01"); err != nil || found.ID != live.ID {
+			t.Errorf("find by code = %+v, %v", found, err)
+		}
+		if found, err := repo.FindByID(ctx, live.ID); err != nil || found.ID != live.ID {
+			t.Errorf("find by id = %+v, %v", found, err)
+		}
+
+		// expired content is only found by the lookups that ignore expiry
+		if _, err := repo.FindActiveByID(ctx, expired.ID); statusCode(err) != 404 {
+			t.Errorf("find expired by id = %v, want not found", err)
+		}
+		if _, err := repo.FindActiveByCode(ctx, "OLD001"); statusCode(err) != 404 {
+			t.Errorf("find expired by code = %v, want not found", err)
+		}
+		if found, err := repo.FindByID(ctx, expired.ID); err != nil || found.ID != expired.ID {
+			t.Errorf("find expired with find by id = %+v, %v", found, err)
+		}
+		if found, err := repo.FindAnyByID(ctx, expired.ID); err != nil || found.ID != expired.ID {
+			t.Errorf("find any = %+v, %v", found, err)
+		}
+		if _, err := repo.FindAnyByID(ctx, "missing"); statusCode(err) != 404 {
+			t.Errorf("find any unknown = %v, want not found", err)
+		}
+
+		exists := []struct {
+			name string
+			fn   func(context.Context, string) (bool, error)
+			arg  string
+			want bool
+		}{
+			{"id", repo.IDExists, live.ID, true},
+			{"expired id", repo.IDExists, expired.ID, true},
+			{"unknown id", repo.IDExists, "missing", false},
+			{"code", repo.CodeExists, "LIVE01", true},
+			{"expired code", repo.CodeExists, "OLD001", true},
+			{"unknown code", repo.CodeExists, "NOPE00", false},
+		}
+		for _, e := range exists {
+			if got, err := e.fn(ctx, e.arg); got != e.want || err != nil {
+				t.Errorf("%s exists = %v, %v; want %v", e.name, got, err, e.want)
+			}
+		}
+
+		// a taken code can't be reused
+		if err := repo.Create(ctx, &models.Content{ID: testID("cont"), Code: ptr("LIVE01"), Type: models.ContentTypeNote, ExpiresAt: live.ExpiresAt}); err == nil {
+			t.Error("create with a taken code succeeded")
+		}
+
+		for i, want := range []bool{true, true, false} {
+			if ok, err := repo.ConsumeView(ctx, live.ID); ok != want || err != nil {
+				t.Errorf("view %d = %v, %v; want %v", i+1, ok, err, want)
+			}
+		}
+		if ok, err := repo.ConsumeView(ctx, expired.ID); ok || err != nil {
+			t.Errorf("view expired = %v, %v; want false", ok, err)
+		}
+
+		// both the expired file and the one out of views are up for cleanup
+		gone, err := repo.FindExpiredContent(ctx)
+		if err != nil || !slices.Equal(contentIDs(gone), sortedIDs(live.ID, expired.ID)) {
+			t.Errorf("find expired = %v, %v; want %s and %s", contentIDs(gone), err, live.ID, expired.ID)
+		}
+	})
+}
+
+func TestContentRepositoryUpdate(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewContentRepository(tdb.db, tdb.dialect, testLogger())
+
+		bundle := createTestContent(t, tdb, &models.Content{Type: models.ContentTypeBundle})
+		file := createTestContent(t, tdb, &models.Content{BundleID: &bundle.ID, Filename: ptr("a.txt"), Filepath: ptr("a-key"), Filesize: ptr(int64(1))})
+
+		bundle.Title = ptr("holiday")
+		bundle.PasscodeHash = ptr("hash")
+		bundle.ExpiresAt = time.Now().UTC().Add(48 * time.Hour)
+		if err := repo.Update(ctx, bundle); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+
+		found, err := repo.FindActiveByID(ctx, bundle.ID)
+		if err != nil || found.Title == nil || *found.Title != "holiday" || found.PasscodeHash == nil || found.ExpiresAt.Sub(bundle.ExpiresAt).Abs() > time.Second {
+			t.Errorf("updated bundle = %+v, %v", found, err)
+		}
+		files, err := repo.FindBundleFiles(ctx, bundle.ID)
+		if err != nil || len(files) != 1 || files[0].ID != file.ID {
+			t.Fatalf("bundle files = %v, %v", files, err)
+		}
+		if files[0].ExpiresAt.Sub(bundle.ExpiresAt).Abs() > time.Second {
+			t.Errorf("bundle file expires at %v, want the bundle's %v", files[0].ExpiresAt, bundle.ExpiresAt)
+		}
+
+		if err := repo.Update(ctx, &models.Content{ID: "missing", ExpiresAt: bundle.ExpiresAt}); statusCode(err) != 404 {
+			t.Errorf("update unknown content = %v, want not found", err)
+		}
+	})
+}
+
+func TestContentRepositoryDeletion(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewContentRepository(tdb.db, tdb.dialect, testLogger())
+		users := NewUserRepository(tdb.db, tdb.dialect, testLogger())
+		user := createTestUser(t, tdb, "owner@example.com")
+
+		bundle := createTestContent(t, tdb, &models.Content{Type: models.ContentTypeBundle, UserID: &user.ID})
+		first := createTestContent(t, tdb, &models.Content{BundleID: &bundle.ID, UserID: &user.ID, Filepath: ptr("first-key"), Filesize: ptr(int64(3))})
+		second := createTestContent(t, tdb, &models.Content{BundleID: &bundle.ID, UserID: &user.ID, Filepath: ptr("second-key"), Filesize: ptr(int64(4))})
+		if _, err := users.ChargeStorage(ctx, user.ID, 7, 1, 0, 0); err != nil {
+			t.Fatalf("charge: %v", err)
+		}
+
+		usage := func(wantBytes int64, wantItems int) {
+			t.Helper()
+			found, err := users.GetByID(ctx, user.ID)
+			if err != nil || found.StorageBytes != wantBytes || found.StorageItems != wantItems {
+				t.Errorf("usage = %d bytes, %d items, %v; want %d, %d", found.StorageBytes, found.StorageItems, err, wantBytes, wantItems)
+			}
+		}
+
+		if err := repo.SetDeleted(ctx, bundle.ID, true); err != nil {
+			t.Fatalf("delete bundle: %v", err)
+		}
+		usage(0, 0)
+		if _, err := repo.FindActiveByID(ctx, bundle.ID); statusCode(err) != 404 {
+			t.Errorf("find deleted bundle = %v, want not found", err)
+		}
+		if files, err := repo.FindBundleFiles(ctx, bundle.ID); err != nil || len(files) != 0 {
+			t.Errorf("files of a deleted bundle = %v, %v; want none", files, err)
+		}
+		if files, err := repo.FindAllBundleFiles(ctx, bundle.ID); err != nil || !slices.Equal(contentIDs(files), sortedIDs(first.ID, second.ID)) {
+			t.Errorf("all files of a deleted bundle = %v, %v", contentIDs(files), err)
+		}
+		if err := repo.SetDeleted(ctx, bundle.ID, true); statusCode(err) != 404 {
+			t.Errorf("delete twice = %v, want not found", err)
+		}
+
+		if err := repo.SetDeleted(ctx, bundle.ID, false); err != nil {
+			t.Fatalf("restore bundle: %v", err)
+		}
+		usage(7, 1)
+
+		if err := repo.SoftDelete(ctx, first.ID); err != nil {
+			t.Fatalf("soft delete: %v", err)
+		}
+		usage(4, 1)
+		if err := repo.SoftDelete(ctx, "missing"); statusCode(err) != 404 {
+			t.Errorf("soft delete unknown content = %v, want not found", err)
+		}
+
+		keys, err := repo.Purge(ctx, bundle.ID)
+		if err != nil {
+			t.Fatalf("purge: %v", err)
+		}
+		slices.Sort(keys)
+		if !slices.Equal(keys, []string{"first-key", "second-key"}) {
+			t.Errorf("purged keys = %v", keys)
+		}
+		usage(0, 0)
+		if exists, err := repo.IDExists(ctx, first.ID); exists || err != nil {
+			t.Errorf("purged file exists = %v, %v", exists, err)
+		}
+		if _, err := repo.Purge(ctx, bundle.ID); statusCode(err) != 404 {
+			t.Errorf("purge twice = %v, want not found", err)
+		}
+	})
+}
+
+func TestContentRepositoryCleanup(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewContentRepository(tdb.db, tdb.dialect, testLogger())
+		users := NewUserRepository(tdb.db, tdb.dialect, testLogger())
+		user := createTestUser(t, tdb, "owner@example.com")
+		leaving := createTestUser(t, tdb, "leaving@example.com")
+		past := time.Now().UTC().Add(-time.Hour)
+
+		live := createTestContent(t, tdb, &models.Content{UserID: &user.ID, Filepath: ptr("live-key"), Filesize: ptr(int64(10))})
+		expired := createTestContent(t, tdb, &models.Content{UserID: &user.ID, Filepath: ptr("expired-key"), Filesize: ptr(int64(20)), ExpiresAt: past})
+		createTestContent(t, tdb, &models.Content{Type: models.ContentTypeNote, Content: ptr("hi"), ExpiresAt: past})
+		if _, err := users.ChargeStorage(ctx, user.ID, 30, 2, 0, 0); err != nil {
+			t.Fatalf("charge: %v", err)
+		}
+		createTestContent(t, tdb, &models.Content{UserID: &leaving.ID, Filepath: ptr("leaving-key"), Filesize: ptr(int64(1))})
+		createTestContent(t, tdb, &models.Content{UserID: &leaving.ID, Type: models.ContentTypeNote, Content: ptr("bye")})
+
+		if total, err := repo.TotalStoredBytes(ctx); total != 31 || err != nil {
+			t.Errorf("total stored = %d, %v; want 31", total, err)
+		}
+
+		if removed, err := repo.DeleteExpired(ctx); removed != 2 || err != nil {
+			t.Errorf("delete expired = %d, %v; want 2", removed, err)
+		}
+		if exists, err := repo.IDExists(ctx, expired.ID); exists || err != nil {
+			t.Errorf("expired content exists = %v, %v", exists, err)
+		}
+		found, err := users.GetByID(ctx, user.ID)
+		if err != nil || found.StorageBytes != 10 || found.StorageItems != 1 {
+			t.Errorf("usage after cleanup = %d bytes, %d items, %v; want 10, 1", found.StorageBytes, found.StorageItems, err)
+		}
+
+		keys, err := repo.DeleteByUser(ctx, leaving.ID)
+		if err != nil || !slices.Equal(keys, []string{"leaving-key"}) {
+			t.Errorf("delete by user = %v, %v; want [leaving-key]", keys, err)
+		}
+		if contents, total, err := repo.ListByUser(ctx, leaving.ID, 10, 0); len(contents) != 0 || total != 0 || err != nil {
+			t.Errorf("content of a deleted user = %d, %d, %v", len(contents), total, err)
+		}
+		if exists, err := repo.IDExists(ctx, live.ID); !exists || err != nil {
+			t.Errorf("another user's content was removed: %v, %v", exists, err)
+		}
+	})
+}
+
+func TestContentRepositoryUsage(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewContentRepository(tdb.db, tdb.dialect, testLogger())
+		user := createTestUser(t, tdb, "owner@example.com")
+		ip := ptr("203.0.113.7")
+
+		bundle := createTestContent(t, tdb, &models.Content{Type: models.ContentTypeBundle, UploaderIP: ip})
+		createTestContent(t, tdb, &models.Content{BundleID: &bundle.ID, UploaderIP: ip, Filesize: ptr(int64(3))})
+		createTestContent(t, tdb, &models.Content{BundleID: &bundle.ID, UploaderIP: ip, Filesize: ptr(int64(4))})
+		createTestContent(t, tdb, &models.Content{UploaderIP: ip, Filesize: ptr(int64(10))})
+		deleted := createTestContent(t, tdb, &models.Content{UploaderIP: ip, Filesize: ptr(int64(100))})
+		createTestContent(t, tdb, &models.Content{UploaderIP: ptr("203.0.113.8"), Filesize: ptr(int64(1000))})
+		// an account's uploads count against the account, not the address
+		createTestContent(t, tdb, &models.Content{UserID: &user.ID, UploaderIP: ip, Filesize: ptr(int64(10000))})
+		if err := repo.SoftDelete(ctx, deleted.ID); err != nil {
+			t.Fatalf("soft delete: %v", err)
+		}
+
+		usage, err := repo.UsageByAddress(ctx, *ip)
+		if err != nil || usage.Items != 2 || usage.Bytes != 17 {
+			t.Errorf("usage = %+v, %v; want 2 items, 17 bytes", usage, err)
+		}
+		if usage, err := repo.UsageByAddress(ctx, "198.51.100.1"); err != nil || usage.Items != 0 || usage.Bytes != 0 {
+			t.Errorf("usage of an unknown address = %+v, %v", usage, err)
+		}
+	})
+}
+
+func TestContentRepositoryListByUser(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewContentRepository(tdb.db, tdb.dialect, testLogger())
+		user := createTestUser(t, tdb, "owner@example.com")
+
+		var top []string
+		for range 3 {
+			top = append(top, createTestContent(t, tdb, &models.Content{UserID: &user.ID}).ID)
+		}
+		bundle := createTestContent(t, tdb, &models.Content{Type: models.ContentTypeBundle, UserID: &user.ID})
+		top = append(top, bundle.ID)
+		createTestContent(t, tdb, &models.Content{BundleID: &bundle.ID, UserID: &user.ID})
+		createTestContent(t, tdb, &models.Content{UserID: &user.ID, ExpiresAt: time.Now().UTC().Add(-time.Hour)})
+
+		var listed []*models.Content
+		for offset := 0; offset < 6; offset += 2 {
+			page, total, err := repo.ListByUser(ctx, user.ID, 2, offset)
+			if err != nil || total != 4 {
+				t.Fatalf("list at %d = %d, %v; want a total of 4", offset, total, err)
+			}
+			listed = append(listed, page...)
+		}
+		if !slices.Equal(contentIDs(listed), sortedIDs(top...)) {
+			t.Errorf("listed = %v, want %v", contentIDs(listed), sortedIDs(top...))
+		}
+	})
+}
+
+func TestContentRepositorySearch(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewContentRepository(tdb.db, tdb.dialect, testLogger())
+		user := createTestUser(t, tdb, "owner@example.com")
+
+		sale := createTestContent(t, tdb, &models.Content{Type: models.ContentTypeNote, Title: ptr("Sale: 50% off"), Content: ptr("x")})
+		decoy := createTestContent(t, tdb, &models.Content{Type: models.ContentTypeNote, Title: ptr("500 items"), Content: ptr("x")})
+		report := createTestContent(t, tdb, &models.Content{UserID: &user.ID, Filename: ptr("Report.pdf"), Filesize: ptr(int64(100)), PasscodeHash: ptr("hash")})
+		old := createTestContent(t, tdb, &models.Content{UserID: &user.ID, Filename: ptr("old.log"), Filesize: ptr(int64(5)), ExpiresAt: time.Now().UTC().Add(-time.Hour)})
+		used := createTestContent(t, tdb, &models.Content{Filename: ptr("once.txt"), Filesize: ptr(int64(1)), MaxViews: ptr(1)})
+		removed := createTestContent(t, tdb, &models.Content{Filename: ptr("removed.txt"), Filesize: ptr(int64(1))})
+		if _, err := repo.ConsumeView(ctx, used.ID); err != nil {
+			t.Fatalf("consume view: %v", err)
+		}
+		if err := repo.SoftDelete(ctx, removed.ID); err != nil {
+			t.Fatalf("soft delete: %v", err)
+		}
+
+		all := []string{sale.ID, decoy.ID, report.ID, old.ID, used.ID, removed.ID}
+		tests := []struct {
+			name   string
+			filter models.ContentFilter
+			want   []string
+		}{
+			{"everything", models.ContentFilter{}, all},
+			{"live only", models.ContentFilter{Deleted: ptr(false)}, []string{sale.ID, decoy.ID, report.ID, old.ID, used.ID}},
+			{"deleted", models.ContentFilter{Deleted: ptr(true)}, []string{removed.ID}},
+			{"type", models.ContentFilter{Type: models.ContentTypeNote}, []string{sale.ID, decoy.ID}},
+			{"owner", models.ContentFilter{OwnerID: user.ID}, []string{report.ID, old.ID}},
+			{"anonymous", models.ContentFilter{OwnerID: models.OwnerAnonymous}, []string{sale.ID, decoy.ID, used.ID, removed.ID}},
+			{"wildcards are literal", models.ContentFilter{Search: "50%"}, []string{sale.ID}},
+			{"search is case-insensitive", models.ContentFilter{Search: "report"}, []string{report.ID}},
+			{"size range", models.ContentFilter{MinSize: ptr(int64(2)), MaxSize: ptr(int64(50))}, []string{old.ID}},
+			{"passcode", models.ContentFilter{HasPasscode: ptr(true)}, []string{report.ID}},
+			{"expired or used up", models.ContentFilter{Expired: ptr(true)}, []string{old.ID, used.ID}},
+			{"not expired", models.ContentFilter{Expired: ptr(false), Deleted: ptr(false)}, []string{sale.ID, decoy.ID, report.ID}},
+			{"created after", models.ContentFilter{CreatedAfter: ptr(testEpoch)}, all},
+			{"created before", models.ContentFilter{CreatedBefore: ptr(testEpoch)}, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				tt.filter.Limit = 100
+				got, err := repo.Search(ctx, &tt.filter, nil)
+				if err != nil {
+					t.Fatalf("search: %v", err)
+				}
+				if !slices.Equal(contentIDs(got), sortedIDs(tt.want...)) {
+					t.Errorf("search = %v, want %v", contentIDs(got), sortedIDs(tt.want...))
+				}
+			})
+		}
+
+		// walking the pages with the cursor visits every row once
+		var seen []string
+		var cursor *models.ContentCursor
+		for page := 0; ; page++ {
+			if page > len(all) {
+				t.Fatal("paging doesn't end")
+			}
+			got, err := repo.Search(ctx, &models.ContentFilter{Limit: 4}, cursor)
+			if err != nil {
+				t.Fatalf("search page %d: %v", page, err)
+			}
+			for _, c := range got {
+				seen = append(seen, c.ID)
+			}
+			if len(got) < 4 {
+				break
+			}
+			last := got[len(got)-1]
+			cursor = &models.ContentCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		}
+		if !slices.Equal(sortedIDs(seen...), sortedIDs(all...)) {
+			t.Errorf("paged through %v, want %v", seen, all)
+		}
+	})
+}
+
+func TestContentRepositoryTransaction(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewContentRepository(tdb.db, tdb.dialect, testLogger())
+		insert := tdb.dialect.Rebind("INSERT INTO content (id, type, expires_at) VALUES (?, ?, ?)")
+		expiresAt := time.Now().UTC().Add(time.Hour)
+
+		failure := errors.New("give up")
+		err := repo.WithTransaction(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, insert, "rolled", models.ContentTypeNote, expiresAt); err != nil {
+				return err
+			}
+			return failure
+		})
+		if err != failure {
+			t.Errorf("transaction error = %v, want %v", err, failure)
+		}
+		if exists, err := repo.IDExists(ctx, "rolled"); exists || err != nil {
+			t.Errorf("rolled back row exists = %v, %v", exists, err)
+		}
+
+		err = repo.WithTransaction(ctx, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, insert, "kept", models.ContentTypeNote, expiresAt)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("transaction: %v", err)
+		}
+		if exists, err := repo.IDExists(ctx, "kept"); !exists || err != nil {
+			t.Errorf("committed row exists = %v, %v", exists, err)
+		}
+	})
+}
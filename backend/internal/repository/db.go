@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -13,8 +12,9 @@ import (
 
 // db manager handles database connection and initialization
 type DBManager struct {
-	db     *sql.DB
-	logger *logrus.Logger
+	db      *sql.DB
+	dialect Dialect
+	logger  *logrus.Logger
 }
 
 // create new db manager
@@ -24,8 +24,8 @@ func NewDBManager(logger *logrus.Logger) *DBManager {
 	}
 }
 
-// initialize database connection
-func (m *DBManager) Initialize(ctx context.Context, databaseURL string) (*sql.DB, error) {
+// initialize database connection; the returned dialect is handed to the repositories
+func (m *DBManager) Initialize(ctx context.Context, databaseURL string) (*sql.DB, Dialect, error) {
 	var err error
 
 	if databaseURL != "" {
@@ -34,15 +34,16 @@ func (m *DBManager) Initialize(ctx context.Context, databaseURL string) (*sql.DB
 		m.db, err = sql.Open("postgres", databaseURL)
 		if err != nil {
 			m.logger.WithError(err).Error("failed to connect to postgresql")
-			return nil, fmt.Errorf("failed to connect to postgresql: %w", err)
+			return nil, nil, fmt.Errorf("failed to connect to postgresql: %w", err)
 		}
 
 		// test connection
 		if err = m.db.PingContext(ctx); err != nil {
 			m.logger.WithError(err).Error("failed to ping postgresql")
-			return nil, fmt.Errorf("failed to ping postgresql: %w", err)
+			return nil, nil, fmt.Errorf("failed to ping postgresql: %w", err)
 		}
 
+		m.dialect = PostgresDialect{}
 		m.logger.Info("successfully connected to postgresql")
 	} else {
 		// use sqlite (development)
@@ -55,134 +56,37 @@ func (m *DBManager) Initialize(ctx context.Context, databaseURL string) (*sql.DB
 		m.db, err = sql.Open("sqlite3", dbPath)
 		if err != nil {
 			m.logger.WithError(err).Error("failed to open sqlite")
-			return nil, fmt.Errorf("failed to open sqlite: %w", err)
+			return nil, nil, fmt.Errorf("failed to open sqlite: %w", err)
 		}
 
+		m.dialect = SQLiteDialect{}
 		m.logger.WithField("db_path", dbPath).Info("successfully opened sqlite database")
 	}
 
-	return m.db, nil
+	return m.db, m.dialect, nil
 }
 
-// run migrations creates tables and indexes
+// new migrator returns a migrator for the connected database
+func (m *DBManager) NewMigrator() (*Migrator, error) {
+	return NewMigrator(m.db, m.dialect, m.logger)
+}
+
+// run migrations applies pending schema migrations; any failure is rolled back and returned
 func (m *DBManager) RunMigrations(ctx context.Context) error {
 	m.logger.Info("running database migrations")
 
-	// determine if using postgresql or sqlite
-	isPostgres := os.Getenv("DATABASE_URL") != ""
-
-	var schema string
-	if isPostgres {
-		schema = `
-		CREATE TABLE IF NOT EXISTS users (
-			id TEXT PRIMARY KEY,
-			email TEXT UNIQUE NOT NULL,
-			password_hash TEXT NOT NULL,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		);
-		
-		CREATE TABLE IF NOT EXISTS content (
-			id TEXT PRIMARY KEY,
-			code TEXT UNIQUE,
-			bundle_id TEXT,
-			user_id TEXT,
-			type TEXT NOT NULL,
-			title TEXT,
-			filename TEXT,
-			filepath TEXT,
-			filesize BIGINT,
-			content TEXT,
-			passcode_hash TEXT,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			expires_at TIMESTAMP NOT NULL,
-			view_count INTEGER DEFAULT 0,
-			deleted_at TIMESTAMP,
-			FOREIGN KEY (user_id) REFERENCES users(id)
-		);
-		`
-
-		// add columns if they don't exist (for existing databases)
-		m.db.ExecContext(ctx, "ALTER TABLE content ADD COLUMN deleted_at TIMESTAMP")
-		m.db.ExecContext(ctx, "ALTER TABLE content ADD COLUMN code TEXT")
-		m.db.ExecContext(ctx, "ALTER TABLE content ADD COLUMN passcode_hash TEXT")
-		m.db.ExecContext(ctx, "ALTER TABLE content ADD COLUMN bundle_id TEXT")
-		m.db.ExecContext(ctx, "ALTER TABLE content ADD COLUMN user_id TEXT")
-
-		schema += `
-		CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
-		CREATE INDEX IF NOT EXISTS idx_content_expires_at ON content(expires_at);
-		CREATE INDEX IF NOT EXISTS idx_content_deleted_at ON content(deleted_at);
-		CREATE INDEX IF NOT EXISTS idx_content_type ON content(type);
-		CREATE INDEX IF NOT EXISTS idx_content_created_at ON content(created_at DESC);
-		CREATE INDEX IF NOT EXISTS idx_content_bundle_id ON content(bundle_id);
-		CREATE INDEX IF NOT EXISTS idx_content_user_id ON content(user_id);
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_content_code ON content(code) WHERE code IS NOT NULL;
-		`
-	} else {
-		schema = `
-		CREATE TABLE IF NOT EXISTS users (
-			id TEXT PRIMARY KEY,
-			email TEXT UNIQUE NOT NULL,
-			password_hash TEXT NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);
-		
-		CREATE TABLE IF NOT EXISTS content (
-			id TEXT PRIMARY KEY,
-			code TEXT UNIQUE,
-			bundle_id TEXT,
-			user_id TEXT,
-			type TEXT NOT NULL,
-			title TEXT,
-			filename TEXT,
-			filepath TEXT,
-			filesize INTEGER,
-			content TEXT,
-			passcode_hash TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			expires_at DATETIME NOT NULL,
-			view_count INTEGER DEFAULT 0,
-			deleted_at DATETIME,
-			FOREIGN KEY (user_id) REFERENCES users(id)
-		);
-		`
-
-		// add columns if they don't exist (for existing databases)
-		m.db.ExecContext(ctx, "ALTER TABLE content ADD COLUMN deleted_at DATETIME")
-		m.db.ExecContext(ctx, "ALTER TABLE content ADD COLUMN code TEXT")
-		m.db.ExecContext(ctx, "ALTER TABLE content ADD COLUMN passcode_hash TEXT")
-		m.db.ExecContext(ctx, "ALTER TABLE content ADD COLUMN bundle_id TEXT")
-		m.db.ExecContext(ctx, "ALTER TABLE content ADD COLUMN user_id TEXT")
-
-		schema += `
-		CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
-		CREATE INDEX IF NOT EXISTS idx_content_expires_at ON content(expires_at);
-		CREATE INDEX IF NOT EXISTS idx_content_deleted_at ON content(deleted_at);
-		CREATE INDEX IF NOT EXISTS idx_content_type ON content(type);
-		CREATE INDEX IF NOT EXISTS idx_content_created_at ON content(created_at DESC);
-		CREATE INDEX IF NOT EXISTS idx_content_bundle_id ON content(bundle_id);
-		CREATE INDEX IF NOT EXISTS idx_content_user_id ON content(user_id);
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_content_code ON content(code) WHERE code IS NOT NULL;
-		`
+	migrator, err := m.NewMigrator()
+	if err != nil {
+		return err
 	}
 
-	// split and execute each statement
-	statements := strings.Split(schema, ";")
-	for _, stmt := range statements {
-		stmt = strings.TrimSpace(stmt)
-		if stmt == "" {
-			continue
-		}
-
-		if _, err := m.db.ExecContext(ctx, stmt); err != nil {
-			m.logger.WithError(err).WithField("statement", stmt).Error("failed to execute migration")
-			return fmt.Errorf("failed to execute migration: %w", err)
-		}
+	count, err := migrator.Up(ctx)
+	if err != nil {
+		m.logger.WithError(err).Error("failed to run migrations")
+		return err
 	}
 
-	m.logger.Info("database migrations completed successfully")
+	m.logger.WithField("applied", count).Info("database migrations completed successfully")
 	return nil
 }
 
@@ -205,24 +109,6 @@ func (m *DBManager) ConfigurePool(maxConns, maxIdle int, maxLifetime int) {
 	}).Info("database connection pool configured")
 }
 
-// convertQuery converts ? placeholders to $1, $2, ... for PostgreSQL
-func convertQuery(isPostgres bool, query string) string {
-	if !isPostgres {
-		return query
-	}
-	result := ""
-	paramCount := 1
-	for _, char := range query {
-		if char == '?' {
-			result += fmt.Sprintf("$%d", paramCount)
-			paramCount++
-		} else {
-			result += string(char)
-		}
-	}
-	return result
-}
-
 // close database connection
 func (m *DBManager) Close() error {
 	if m.db != nil {
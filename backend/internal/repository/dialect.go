@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// dialect hides the SQL differences between the supported databases.
+// repositories write queries with ? placeholders and CURRENT_TIMESTAMP,
+// and run them through Rebind before executing.
+type Dialect interface {
+	// name identifies the dialect ("postgres" or "sqlite"), also used to pick migration variants
+	Name() string
+	// rebind rewrites ? placeholders and CURRENT_TIMESTAMP for this database.
+	// quoted strings and identifiers are left untouched.
+	Rebind(query string) string
+	// now returns an expression for the current UTC time, comparable with stored timestamps
+	Now() string
+	// is unique violation reports whether err came from a unique or primary key constraint
+	IsUniqueViolation(err error) bool
+	// upsert builds an insert of columns into table that updates the update columns
+	// when a row with the same conflict columns exists; no update columns means do nothing.
+	// the result still uses ? placeholders and goes through Rebind like any other query.
+	Upsert(table string, columns, conflict, update []string) string
+
+	// migration lock returns a statement that serializes migrators, or "" if none is needed
+	migrationLock() string
+	// table columns returns a query listing the column names of the table bound to its one placeholder
+	tableColumns() string
+}
+
+// dialect for returns the dialect registered under name
+func DialectFor(name string) (Dialect, error) {
+	switch name {
+	case "postgres":
+		return PostgresDialect{}, nil
+	case "sqlite":
+		return SQLiteDialect{}, nil
+	default:
+		return nil, fmt.Errorf("unknown database dialect %q", name)
+	}
+}
+
+// postgres dialect uses numbered placeholders and stores timestamps without time zone in UTC
+type PostgresDialect struct{}
+
+func (PostgresDialect) Name() string { return "postgres" }
+
+// postgres NOW() is zoned; stored timestamps are naive UTC, so convert before comparing
+func (PostgresDialect) Now() string { return "(NOW() AT TIME ZONE 'UTC')" }
+
+func (d PostgresDialect) Rebind(query string) string {
+	n := 0
+	return rewriteQuery(query, d.Now(), func() string {
+		n++
+		return fmt.Sprintf("$%d", n)
+	})
+}
+
+func (PostgresDialect) IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (PostgresDialect) Upsert(table string, columns, conflict, update []string) string {
+	return buildUpsert(table, columns, conflict, update)
+}
+
+// migration lock is an advisory lock released when the migration's transaction ends
+func (PostgresDialect) migrationLock() string {
+	return "SELECT pg_advisory_xact_lock(7265627301)"
+}
+
+func (PostgresDialect) tableColumns() string {
+	return "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?"
+}
+
+// sqlite dialect keeps ? placeholders and compares timestamps as UTC text
+type SQLiteDialect struct{}
+
+func (SQLiteDialect) Name() string { return "sqlite" }
+
+func (SQLiteDialect) Now() string { return "datetime('now')" }
+
+func (d SQLiteDialect) Rebind(query string) string {
+	return rewriteQuery(query, d.Now(), func() string { return "?" })
+}
+
+func (SQLiteDialect) IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+func (SQLiteDialect) Upsert(table string, columns, conflict, update []string) string {
+	return buildUpsert(table, columns, conflict, update)
+}
+
+// sqlite has a single writer, so migrations need no extra lock
+func (SQLiteDialect) migrationLock() string { return "" }
+
+func (SQLiteDialect) tableColumns() string { return "SELECT name FROM pragma_table_info(?)" }
+
+// build upsert renders INSERT ... ON CONFLICT, which postgres and sqlite (3.24+) both accept
+func buildUpsert(table string, columns, conflict, update []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s)",
+		table, strings.Join(columns, ", "), placeholders, strings.Join(conflict, ", "))
+
+	if len(update) == 0 {
+		return query + " DO NOTHING"
+	}
+	sets := make([]string, len(update))
+	for i, col := range update {
+		sets[i] = fmt.Sprintf("%s = excluded.%s", col, col)
+	}
+	return query + " DO UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// rewrite query replaces ? with placeholder() and CURRENT_TIMESTAMP with now,
+// skipping anything inside '...' literals and "..." identifiers
+func rewriteQuery(query, now string, placeholder func() string) string {
+	const currentTimestamp = "CURRENT_TIMESTAMP"
+
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+
+		if quote != 0 {
+			b.WriteByte(c)
+			// a doubled quote is an escaped quote and keeps the literal open
+			if c == quote {
+				if i+1 < len(query) && query[i+1] == quote {
+					b.WriteByte(query[i+1])
+					i++
+				} else {
+					quote = 0
+				}
+			}
+			continue
+		}
+
+		switch {
+		case c == '\'' || c == '"':
+			quote = c
+			b.WriteByte(c)
+		case c == '?':
+			b.WriteString(placeholder())
+		case strings.HasPrefix(query[i:], currentTimestamp) &&
+			(i == 0 || !isIdentChar(query[i-1])) &&
+			(i+len(currentTimestamp) == len(query) || !isIdentChar(query[i+len(currentTimestamp)])):
+			b.WriteString(now)
+			i += len(currentTimestamp) - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// timestamp param formats t like the CURRENT_TIMESTAMP column defaults (naive UTC), so a bound
+// value compares correctly with defaulted columns; go's own time binding adds a zone that sqlite
+// then compares as text
+func timestampParam(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.999999")
+}
+
+// is ident char reports whether c can be part of an unquoted SQL identifier
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
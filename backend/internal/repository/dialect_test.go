@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		postgres string
+		sqlite   string
+	}{
+		{
+			name:     "placeholders",
+			query:    "SELECT id FROM content WHERE id = ? AND type = ?",
+			postgres: "SELECT id FROM content WHERE id = $1 AND type = $2",
+			sqlite:   "SELECT id FROM content WHERE id = ? AND type = ?",
+		},
+		{
+			name:     "quoted question marks",
+			query:    `SELECT '?', "odd?name" FROM content WHERE id = ?`,
+			postgres: `SELECT '?', "odd?name" FROM content WHERE id = $1`,
+			sqlite:   `SELECT '?', "odd?name" FROM content WHERE id = ?`,
+		},
+		{
+			name:     "escaped quote keeps the literal open",
+			query:    "SELECT 'it''s ?' WHERE a = ?",
+			postgres: "SELECT 'it''s ?' WHERE a = $1",
+			sqlite:   "SELECT 'it''s ?' WHERE a = ?",
+		},
+		{
+			name:     "current timestamp",
+			query:    "SELECT id FROM content WHERE expires_at > CURRENT_TIMESTAMP AND id = ?",
+			postgres: "SELECT id FROM content WHERE expires_at > (NOW() AT TIME ZONE 'UTC') AND id = $1",
+			sqlite:   "SELECT id FROM content WHERE expires_at > datetime('now') AND id = ?",
+		},
+		{
+			name:     "current timestamp inside identifiers and literals",
+			query:    "SELECT MY_CURRENT_TIMESTAMP, CURRENT_TIMESTAMPS, 'CURRENT_TIMESTAMP'",
+			postgres: "SELECT MY_CURRENT_TIMESTAMP, CURRENT_TIMESTAMPS, 'CURRENT_TIMESTAMP'",
+			sqlite:   "SELECT MY_CURRENT_TIMESTAMP, CURRENT_TIMESTAMPS, 'CURRENT_TIMESTAMP'",
+		},
+		{
+			name:     "many placeholders",
+			query:    "VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			postgres: "VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+			sqlite:   "VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (PostgresDialect{}).Rebind(tt.query); got != tt.postgres {
+				t.Errorf("postgres:\n got %s\nwant %s", got, tt.postgres)
+			}
+			if got := (SQLiteDialect{}).Rebind(tt.query); got != tt.sqlite {
+				t.Errorf("sqlite:\n got %s\nwant %s", got, tt.sqlite)
+			}
+		})
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    string
+		columns  []string
+		conflict []string
+		update   []string
+		want     string
+	}{
+		{
+			name:     "do nothing",
+			table:    "revoked_tokens",
+			columns:  []string{"jti", "expires_at"},
+			conflict: []string{"jti"},
+			want:     "INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?) ON CONFLICT (jti) DO NOTHING",
+		},
+		{
+			name:     "do update",
+			table:    "pairs",
+			columns:  []string{"a", "b", "c"},
+			conflict: []string{"a", "b"},
+			update:   []string{"c"},
+			want:     "INSERT INTO pairs (a, b, c) VALUES (?, ?, ?) ON CONFLICT (a, b) DO UPDATE SET c = excluded.c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, d := range []Dialect{PostgresDialect{}, SQLiteDialect{}} {
+				if got := d.Upsert(tt.table, tt.columns, tt.conflict, tt.update); got != tt.want {
+					t.Errorf("%s:\n got %s\nwant %s", d.Name(), got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNow(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		want    string
+	}{
+		{PostgresDialect{}, "(NOW() AT TIME ZONE 'UTC')"},
+		{SQLiteDialect{}, "datetime('now')"},
+	}
+	for _, tt := range tests {
+		if got := tt.dialect.Now(); got != tt.want {
+			t.Errorf("%s Now() = %s, want %s", tt.dialect.Name(), got, tt.want)
+		}
+	}
+}
+
+// the generated SQL has to be accepted by the database itself, not just look right
+func TestDialectSQLRuns(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		d := tdb.dialect
+
+		if _, err := tdb.db.ExecContext(ctx, "CREATE TABLE dialect_pairs (a TEXT, b TEXT, c TEXT, PRIMARY KEY (a, b))"); err != nil {
+			t.Fatalf("create table: %v", err)
+		}
+
+		upsert := d.Rebind(d.Upsert("dialect_pairs", []string{"a", "b", "c"}, []string{"a", "b"}, []string{"c"}))
+		for _, c := range []string{"first", "second"} {
+			if _, err := tdb.db.ExecContext(ctx, upsert, "x", "y", c); err != nil {
+				t.Fatalf("upsert: %v", err)
+			}
+		}
+		ignore := d.Rebind(d.Upsert("dialect_pairs", []string{"a", "b", "c"}, []string{"a", "b"}, nil))
+		if _, err := tdb.db.ExecContext(ctx, ignore, "x", "y", "third"); err != nil {
+			t.Fatalf("upsert do nothing: %v", err)
+		}
+
+		var c string
+		if err := tdb.db.QueryRowContext(ctx, d.Rebind("SELECT c FROM dialect_pairs WHERE a = ? AND b = ?"), "x", "y").Scan(&c); err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		if c != "second" {
+			t.Errorf("c = %q, want second", c)
+		}
+
+		var later bool
+		query := d.Rebind("SELECT CURRENT_TIMESTAMP > ?")
+		if err := tdb.db.QueryRowContext(ctx, query, timestampParam(testEpoch)).Scan(&later); err != nil {
+			t.Fatalf("compare now: %v", err)
+		}
+		if !later {
+			t.Error("CURRENT_TIMESTAMP is not after 2000-01-01")
+		}
+
+		_, err := tdb.db.ExecContext(ctx, d.Rebind("INSERT INTO dialect_pairs (a, b, c) VALUES (?, ?, ?)"), "x", "y", "dup")
+		if !d.IsUniqueViolation(err) {
+			t.Errorf("duplicate insert error %v is not a unique violation", err)
+		}
+	})
+}
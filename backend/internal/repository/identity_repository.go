@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// identity repository handles external identities linked to users
+type IdentityRepository struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
+}
+
+// create new identity repository
+func NewIdentityRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *IdentityRepository {
+	return &IdentityRepository{
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// create links a new identity; linking the same provider subject twice is a conflict
+func (r *IdentityRepository) Create(ctx context.Context, identity *models.UserIdentity) error {
+	query := r.dialect.Rebind(`
+		INSERT INTO user_identities (id, user_id, provider, subject, email, created_at, last_login_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+
+	_, err := r.db.ExecContext(ctx, query,
+		identity.ID,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+		identity.CreatedAt,
+		identity.LastLoginAt,
+	)
+	if err != nil {
+		r.logger.WithError(err).WithFields(logrus.Fields{
+			"user_id":  identity.UserID,
+			"provider": identity.Provider,
+		}).Error("failed to create user identity")
+		if r.dialect.IsUniqueViolation(err) {
+			return errors.NewConflictError("identity already linked")
+		}
+		return errors.NewInternalError("failed to link identity", err)
+	}
+
+	return nil
+}
+
+// find by subject retrieves the identity a provider knows by subject; returns nil when none is linked
+func (r *IdentityRepository) FindBySubject(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	query := r.dialect.Rebind(`
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM user_identities
+		WHERE provider = ? AND subject = ?
+	`)
+
+	identity := &models.UserIdentity{}
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		r.logger.WithError(err).WithField("provider", provider).Error("failed to get user identity")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return identity, nil
+}
+
+// touch records a login through the identity and the email the provider last reported
+func (r *IdentityRepository) Touch(ctx context.Context, id, email string, at time.Time) error {
+	query := r.dialect.Rebind("UPDATE user_identities SET last_login_at = ?, email = ? WHERE id = ?")
+	if _, err := r.db.ExecContext(ctx, query, at, email, id); err != nil {
+		r.logger.WithError(err).WithField("identity_id", id).Error("failed to update user identity")
+		return errors.NewInternalError("failed to update identity", err)
+	}
+	return nil
+}
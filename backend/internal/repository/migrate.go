@@ -0,0 +1,391 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// migration files are named <version>_<name>.<up|down>[.<dialect>].sql.
+// a dialect-specific file replaces the generic one for that database only.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is one numbered schema change with its up and down scripts per dialect
+type Migration struct {
+	Version int
+	Name    string
+	up      map[string]string // keyed by dialect, "" for the generic script
+	down    map[string]string
+}
+
+// script returns the variant for dialect, falling back to the generic script
+func (mg *Migration) script(scripts map[string]string, dialect string) (string, bool) {
+	if s, ok := scripts[dialect]; ok {
+		return s, true
+	}
+	s, ok := scripts[""]
+	return s, ok
+}
+
+// migration status reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// migrator applies and reverts embedded migrations, recording them in schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []*Migration
+	logger     *logrus.Logger
+}
+
+// create new migrator for the given dialect
+func NewMigrator(db *sql.DB, dialect Dialect, logger *logrus.Logger) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, dialect.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+		logger:     logger,
+	}, nil
+}
+
+// load migrations parses the embedded files and checks every migration can run on dialect
+func loadMigrations(fsys fs.FS, dialect string) ([]*Migration, error) {
+	paths, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, path := range paths {
+		base := strings.TrimSuffix(strings.TrimPrefix(path, "migrations/"), ".sql")
+		parts := strings.Split(base, ".")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid migration filename %q", path)
+		}
+
+		versionStr, name, ok := strings.Cut(parts[0], "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration filename %q", path)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", path)
+		}
+
+		variant := ""
+		if len(parts) == 3 {
+			variant = parts[2]
+			if _, err := DialectFor(variant); err != nil {
+				return nil, fmt.Errorf("unknown dialect %q in %q", variant, path)
+			}
+		}
+
+		body, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", path, err)
+		}
+
+		mg, exists := byVersion[version]
+		if !exists {
+			mg = &Migration{Version: version, Name: name, up: map[string]string{}, down: map[string]string{}}
+			byVersion[version] = mg
+		} else if mg.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, mg.Name, name)
+		}
+
+		switch parts[1] {
+		case "up":
+			mg.up[variant] = string(body)
+		case "down":
+			mg.down[variant] = string(body)
+		default:
+			return nil, fmt.Errorf("invalid migration direction in %q", path)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if _, ok := mg.script(mg.up, dialect); !ok {
+			return nil, fmt.Errorf("migration %d_%s has no up script for %s", mg.Version, mg.Name, dialect)
+		}
+		migrations = append(migrations, mg)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// ensure table creates the schema_migrations bookkeeping table
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// applied returns the applied versions and when each ran
+func (m *Migrator) applied(ctx context.Context) (map[int]time.Time, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// status lists every known migration and when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		status := MigrationStatus{Version: mg.Version, Name: mg.Name}
+		if at, ok := applied[mg.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// legacy columns are the content columns the startup code before numbered migrations added
+// with ALTER TABLE as features arrived; a database it created may lack any of them
+var legacyColumns = []struct {
+	name     string
+	sqlite   string
+	postgres string
+}{
+	{"code", "TEXT", "TEXT"},
+	{"bundle_id", "TEXT", "TEXT"},
+	{"user_id", "TEXT", "TEXT"},
+	{"passcode_hash", "TEXT", "TEXT"},
+	{"deleted_at", "DATETIME", "TIMESTAMP"},
+	{"content_hash", "TEXT", "TEXT"},
+	{"management_token_hash", "TEXT", "TEXT"},
+	{"max_views", "INTEGER", "INTEGER"},
+}
+
+// adopt legacy schema adds the legacy columns missing from an existing content table.
+// it runs before any migration, since 0001 only creates tables that don't exist yet and
+// indexes some of these columns, and on every start, so databases that were migrated
+// without it are repaired too. a fresh or complete database is left alone.
+func (m *Migrator) adoptLegacySchema(ctx context.Context) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin schema adoption: %w", err)
+	}
+	defer tx.Rollback()
+
+	if lock := m.dialect.migrationLock(); lock != "" {
+		if _, err := tx.ExecContext(ctx, lock); err != nil {
+			return fmt.Errorf("failed to lock migrations: %w", err)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, m.dialect.Rebind(m.dialect.tableColumns()), "content")
+	if err != nil {
+		return fmt.Errorf("failed to read content columns: %w", err)
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read content columns: %w", err)
+		}
+		existing[strings.ToLower(name)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read content columns: %w", err)
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+
+	var added []string
+	for _, col := range legacyColumns {
+		if existing[col.name] {
+			continue
+		}
+		colType := col.sqlite
+		if m.dialect.Name() == "postgres" {
+			colType = col.postgres
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE content ADD COLUMN %s %s", col.name, colType)); err != nil {
+			return fmt.Errorf("failed to add legacy column content.%s: %w", col.name, err)
+		}
+		added = append(added, col.name)
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit schema adoption: %w", err)
+	}
+	m.logger.WithField("columns", added).Info("added missing columns to legacy content table")
+	return nil
+}
+
+// up applies every pending migration in order, each in its own transaction.
+// returns how many were applied; the first failure stops the run.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+	if err := m.adoptLegacySchema(ctx); err != nil {
+		return 0, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, mg := range m.migrations {
+		if _, ok := applied[mg.Version]; ok {
+			continue
+		}
+		script, _ := mg.script(mg.up, m.dialect.Name())
+		ran, err := m.run(ctx, mg, script, true)
+		if err != nil {
+			return count, err
+		}
+		if ran {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// down reverts the latest steps applied migrations, newest first
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		mg := m.migrations[i]
+		if _, ok := applied[mg.Version]; !ok {
+			continue
+		}
+		script, ok := mg.script(mg.down, m.dialect.Name())
+		if !ok {
+			return count, fmt.Errorf("migration %d_%s cannot be reverted: no down script", mg.Version, mg.Name)
+		}
+		ran, err := m.run(ctx, mg, script, false)
+		if err != nil {
+			return count, err
+		}
+		if ran {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// run executes one migration script and its bookkeeping row in a single transaction.
+// reports false when another instance got there first.
+func (m *Migrator) run(ctx context.Context, mg *Migration, script string, up bool) (bool, error) {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+	log := m.logger.WithFields(logrus.Fields{
+		"version":   mg.Version,
+		"name":      mg.Name,
+		"direction": direction,
+	})
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin migration %d: %w", mg.Version, err)
+	}
+	defer tx.Rollback()
+
+	if lock := m.dialect.migrationLock(); lock != "" {
+		if _, err := tx.ExecContext(ctx, lock); err != nil {
+			return false, fmt.Errorf("failed to lock migrations: %w", err)
+		}
+	}
+
+	// re-check under the lock so concurrent starts don't apply a migration twice
+	var exists bool
+	query := m.dialect.Rebind("SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = ?)")
+	if err := tx.QueryRowContext(ctx, query, mg.Version).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check migration %d: %w", mg.Version, err)
+	}
+	if exists == up {
+		return false, nil
+	}
+
+	// scripts hold several statements; both drivers execute them in one call
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		log.WithError(err).Error("migration failed")
+		return false, fmt.Errorf("migration %d_%s %s failed: %w", mg.Version, mg.Name, direction, err)
+	}
+
+	if up {
+		query = m.dialect.Rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)")
+		_, err = tx.ExecContext(ctx, query, mg.Version, mg.Name)
+	} else {
+		query = m.dialect.Rebind("DELETE FROM schema_migrations WHERE version = ?")
+		_, err = tx.ExecContext(ctx, query, mg.Version)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record migration %d: %w", mg.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit migration %d: %w", mg.Version, err)
+	}
+
+	log.Info("migration applied")
+	return true, nil
+}
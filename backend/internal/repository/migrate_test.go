@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"konbi/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// baseline schema is what the startup code created before numbered migrations existed
+const baselineSchema = `
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE content (
+	id TEXT PRIMARY KEY,
+	code TEXT UNIQUE,
+	bundle_id TEXT,
+	user_id TEXT,
+	type TEXT NOT NULL,
+	title TEXT,
+	filename TEXT,
+	filepath TEXT,
+	filesize INTEGER,
+	content TEXT,
+	passcode_hash TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	expires_at DATETIME NOT NULL,
+	view_count INTEGER DEFAULT 0,
+	deleted_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_content_expires_at ON content(expires_at);
+`
+
+// early schema predates share codes, bundles, owners, passcodes and soft deletes
+const earlySchema = `
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE content (
+	id TEXT PRIMARY KEY,
+	type TEXT NOT NULL,
+	title TEXT,
+	filename TEXT,
+	filepath TEXT,
+	filesize INTEGER,
+	content TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	expires_at DATETIME NOT NULL,
+	view_count INTEGER DEFAULT 0
+);
+`
+
+// open test db opens an empty sqlite database in a temporary directory
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// test logger discards output
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestMigrateUpgradesLegacyDatabase(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{"baseline", baselineSchema},
+		{"early", earlySchema},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := openTestDB(t)
+			if _, err := db.ExecContext(ctx, tt.schema); err != nil {
+				t.Fatalf("create legacy schema: %v", err)
+			}
+			if _, err := db.ExecContext(ctx,
+				`INSERT INTO content (id, type, filename, filepath, filesize, expires_at) VALUES ('legacy01', 'file', 'old.txt', 'legacy01.txt', 3, datetime('now', '+1 day'))`); err != nil {
+				t.Fatalf("insert legacy row: %v", err)
+			}
+
+			logger := testLogger()
+			migrator, err := NewMigrator(db, SQLiteDialect{}, logger)
+			if err != nil {
+				t.Fatalf("new migrator: %v", err)
+			}
+			if _, err := migrator.Up(ctx); err != nil {
+				t.Fatalf("migrate up: %v", err)
+			}
+
+			repo := NewContentRepository(db, SQLiteDialect{}, logger)
+			old, err := repo.FindActiveByID(ctx, "legacy01")
+			if err != nil {
+				t.Fatalf("find legacy row: %v", err)
+			}
+			if old.Filename == nil || *old.Filename != "old.txt" {
+				t.Errorf("legacy filename = %v, want old.txt", old.Filename)
+			}
+
+			code := "ABC123"
+			maxViews := 2
+			hash := "deadbeef"
+			created := &models.Content{
+				ID:          "fresh001",
+				Code:        &code,
+				Type:        models.ContentTypeNote,
+				ContentHash: &hash,
+				ExpiresAt:   time.Now().UTC().Add(time.Hour),
+				MaxViews:    &maxViews,
+			}
+			if err := repo.Create(ctx, created); err != nil {
+				t.Fatalf("create after upgrade: %v", err)
+			}
+			found, err := repo.FindActiveByCode(ctx, code)
+			if err != nil {
+				t.Fatalf("find by code after upgrade: %v", err)
+			}
+			if found.MaxViews == nil || *found.MaxViews != maxViews {
+				t.Errorf("max views = %v, want %d", found.MaxViews, maxViews)
+			}
+
+			// a second start finds nothing left to do
+			count, err := migrator.Up(ctx)
+			if err != nil || count != 0 {
+				t.Fatalf("second migrate up = %d, %v; want 0, nil", count, err)
+			}
+		})
+	}
+}
+
+func TestMigrateDownAndUpAgain(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrator, err := NewMigrator(db, SQLiteDialect{}, testLogger())
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	reverted, err := migrator.Down(ctx, applied)
+	if err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if reverted != applied {
+		t.Errorf("reverted %d migrations, want %d", reverted, applied)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate up again: %v", err)
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS upload_chunks;
+DROP TABLE IF EXISTS upload_sessions;
+DROP TABLE IF EXISTS content;
+DROP TABLE IF EXISTS users;
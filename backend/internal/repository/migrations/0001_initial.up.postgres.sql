@@ -0,0 +1,63 @@
+-- initial schema. every statement is idempotent so databases created by the
+-- old ad-hoc migration code can be adopted; the content columns that code added
+-- later are filled in by the migrator (adoptLegacySchema) before this runs.
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS content (
+	id TEXT PRIMARY KEY,
+	code TEXT UNIQUE,
+	bundle_id TEXT,
+	user_id TEXT,
+	type TEXT NOT NULL,
+	title TEXT,
+	filename TEXT,
+	filepath TEXT,
+	filesize BIGINT,
+	content_hash TEXT,
+	content TEXT,
+	passcode_hash TEXT,
+	management_token_hash TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	view_count INTEGER DEFAULT 0,
+	max_views INTEGER,
+	deleted_at TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS upload_sessions (
+	id TEXT PRIMARY KEY,
+	filename TEXT NOT NULL,
+	total_size BIGINT,
+	upload_offset BIGINT NOT NULL DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'active',
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS upload_chunks (
+	session_id TEXT NOT NULL,
+	start_offset BIGINT NOT NULL,
+	size BIGINT NOT NULL,
+	storage_key TEXT NOT NULL,
+	PRIMARY KEY (session_id, start_offset),
+	FOREIGN KEY (session_id) REFERENCES upload_sessions(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_content_expires_at ON content(expires_at);
+CREATE INDEX IF NOT EXISTS idx_content_deleted_at ON content(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_content_type ON content(type);
+CREATE INDEX IF NOT EXISTS idx_content_created_at ON content(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_content_bundle_id ON content(bundle_id);
+CREATE INDEX IF NOT EXISTS idx_content_user_id ON content(user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_content_code ON content(code) WHERE code IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions(expires_at);
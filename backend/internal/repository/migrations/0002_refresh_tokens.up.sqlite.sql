@@ -0,0 +1,20 @@
+-- refresh tokens are stored hashed; every rotation adds a row to the same family,
+-- and a family is one login session.
+CREATE TABLE refresh_tokens (
+	id TEXT PRIMARY KEY,
+	family_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	user_agent TEXT,
+	ip_address TEXT,
+	session_started_at DATETIME NOT NULL,
+	created_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL,
+	rotated_at DATETIME,
+	revoked_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
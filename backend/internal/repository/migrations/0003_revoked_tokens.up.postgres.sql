@@ -0,0 +1,7 @@
+-- access tokens revoked before they expire, by jti. rows can be pruned once expires_at passes.
+CREATE TABLE revoked_tokens (
+	jti TEXT PRIMARY KEY,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
@@ -0,0 +1,18 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+-- single-use tokens mailed to users (email verification, password reset), stored hashed.
+-- email is the address a verification token confirms.
+CREATE TABLE user_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	purpose TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	email TEXT,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_user_tokens_user_id ON user_tokens(user_id);
+CREATE INDEX idx_user_tokens_expires_at ON user_tokens(expires_at);
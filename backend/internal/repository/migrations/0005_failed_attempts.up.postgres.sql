@@ -0,0 +1,10 @@
+-- failed login and passcode attempts per key ("login:<email>", "passcode:<content id>").
+-- the count starts over once expires_at passes without another failure.
+CREATE TABLE failed_attempts (
+	attempt_key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL,
+	last_failure_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_failed_attempts_expires_at ON failed_attempts(expires_at);
@@ -0,0 +1,17 @@
+-- totp two-factor authentication. a secret without totp_enabled_at is an enrollment
+-- that hasn't been confirmed yet; totp_last_step stops a code from being used twice.
+ALTER TABLE users ADD COLUMN totp_secret TEXT;
+ALTER TABLE users ADD COLUMN totp_enabled_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT;
+
+-- single-use recovery codes, stored hashed
+CREATE TABLE recovery_codes (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	code_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
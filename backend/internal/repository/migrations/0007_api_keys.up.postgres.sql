@@ -0,0 +1,17 @@
+-- personal api keys ("konbi_<prefix>_<secret>"). the prefix identifies the key and is
+-- kept in clear; only a hash of the secret is stored. scopes is a space-separated list.
+CREATE TABLE api_keys (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL UNIQUE,
+	secret_hash TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP,
+	last_used_at TIMESTAMP,
+	revoked_at TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
@@ -0,0 +1,26 @@
+-- external identities linked to konbi users; one per (provider, subject)
+CREATE TABLE user_identities (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	email TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	last_login_at TIMESTAMP,
+	UNIQUE (provider, subject),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+-- pending authorization requests; a state is consumed by the callback that completes it
+CREATE TABLE oidc_states (
+	state TEXT PRIMARY KEY,
+	provider TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_oidc_states_expires_at ON oidc_states(expires_at);
@@ -0,0 +1,2 @@
+-- account roles: user, moderator or admin. moderators and admins may use /api/admin.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
@@ -0,0 +1,2 @@
+-- disabled accounts can't sign in or use existing tokens
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;
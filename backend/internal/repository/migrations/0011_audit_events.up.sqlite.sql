@@ -0,0 +1,19 @@
+-- security-relevant events: who (actor), did what (action) to what (target), and how it went (outcome)
+CREATE TABLE audit_events (
+	id TEXT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	request_id TEXT NOT NULL DEFAULT '',
+	actor_type TEXT NOT NULL,
+	actor_id TEXT,
+	actor_role TEXT,
+	actor_ip TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	target_type TEXT,
+	target_id TEXT,
+	outcome TEXT NOT NULL,
+	detail TEXT
+);
+
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at);
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX idx_audit_events_target_id ON audit_events(target_id);
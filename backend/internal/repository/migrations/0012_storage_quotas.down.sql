@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_content_uploader_ip;
+ALTER TABLE content DROP COLUMN uploader_ip;
+ALTER TABLE users DROP COLUMN quota_items;
+ALTER TABLE users DROP COLUMN quota_bytes;
+ALTER TABLE users DROP COLUMN storage_items;
+ALTER TABLE users DROP COLUMN storage_bytes;
@@ -0,0 +1,14 @@
+-- storage a user's live shares take up, kept up to date as content is created and removed,
+-- and per-user overrides of the default quota (NULL uses the default)
+ALTER TABLE users ADD COLUMN storage_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN storage_items INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN quota_bytes INTEGER;
+ALTER TABLE users ADD COLUMN quota_items INTEGER;
+
+UPDATE users SET
+	storage_bytes = (SELECT COALESCE(SUM(filesize), 0) FROM content WHERE content.user_id = users.id AND content.deleted_at IS NULL),
+	storage_items = (SELECT COUNT(*) FROM content WHERE content.user_id = users.id AND content.deleted_at IS NULL AND content.bundle_id IS NULL);
+
+-- anonymous uploads are counted against the quota of the address they came from
+ALTER TABLE content ADD COLUMN uploader_ip TEXT;
+CREATE INDEX IF NOT EXISTS idx_content_uploader_ip ON content(uploader_ip);
@@ -0,0 +1,3 @@
+-- type sniffed from a file's first bytes at upload, served as its Content-Type; NULL for
+-- notes, bundles and files uploaded before sniffing
+ALTER TABLE content ADD COLUMN mime_type TEXT;
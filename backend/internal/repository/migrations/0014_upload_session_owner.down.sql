@@ -0,0 +1,2 @@
+ALTER TABLE upload_sessions DROP COLUMN token_hash;
+ALTER TABLE upload_sessions DROP COLUMN user_id;
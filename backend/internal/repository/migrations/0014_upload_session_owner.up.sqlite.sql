@@ -0,0 +1,4 @@
+-- an upload session belongs to whoever started it: the share is created for that user, and
+-- every later request has to present the session's upload token (stored as a sha-256 hash)
+ALTER TABLE upload_sessions ADD COLUMN user_id TEXT;
+ALTER TABLE upload_sessions ADD COLUMN token_hash TEXT;
@@ -0,0 +1,2 @@
+-- access tokens issued up to this time are refused, e.g. after a forced password reset
+ALTER TABLE users ADD COLUMN tokens_valid_after DATETIME;
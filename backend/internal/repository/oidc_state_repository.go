@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// oidc state repository handles pending OIDC authorization requests
+type OIDCStateRepository struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
+}
+
+// create new oidc state repository
+func NewOIDCStateRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *OIDCStateRepository {
+	return &OIDCStateRepository{
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// create stores a pending authorization request
+func (r *OIDCStateRepository) Create(ctx context.Context, state *models.OIDCState) error {
+	query := r.dialect.Rebind(`
+		INSERT INTO oidc_states (state, provider, code_verifier, nonce, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`)
+
+	_, err := r.db.ExecContext(ctx, query,
+		state.State,
+		state.Provider,
+		state.CodeVerifier,
+		state.Nonce,
+		state.CreatedAt,
+		state.ExpiresAt,
+	)
+	if err != nil {
+		r.logger.WithError(err).WithField("provider", state.Provider).Error("failed to create oidc state")
+		return errors.NewInternalError("failed to start login", err)
+	}
+
+	return nil
+}
+
+// consume deletes an unexpired state and returns it.
+// the delete is the check, so a state can only complete one callback even under concurrent requests.
+// returns nil when no usable state matches.
+func (r *OIDCStateRepository) Consume(ctx context.Context, state string) (*models.OIDCState, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to begin transaction")
+		return nil, errors.NewInternalError("database error", err)
+	}
+	defer tx.Rollback()
+
+	query := r.dialect.Rebind(`
+		SELECT state, provider, code_verifier, nonce, created_at, expires_at
+		FROM oidc_states
+		WHERE state = ? AND expires_at > CURRENT_TIMESTAMP
+	`)
+	record := &models.OIDCState{}
+	err = tx.QueryRowContext(ctx, query, state).Scan(
+		&record.State,
+		&record.Provider,
+		&record.CodeVerifier,
+		&record.Nonce,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		r.logger.WithError(err).Error("failed to read oidc state")
+		return nil, errors.NewInternalError("failed to complete login", err)
+	}
+
+	result, err := tx.ExecContext(ctx, r.dialect.Rebind("DELETE FROM oidc_states WHERE state = ?"), state)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to consume oidc state")
+		return nil, errors.NewInternalError("failed to complete login", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.WithError(err).Error("failed to commit transaction")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return record, nil
+}
+
+// delete expired removes authorization requests that were never completed
+func (r *OIDCStateRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := r.dialect.Rebind("DELETE FROM oidc_states WHERE expires_at < CURRENT_TIMESTAMP")
+	result, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to delete expired oidc states")
+		return 0, errors.NewInternalError("failed to delete expired states", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recovery code repository handles the two-factor recovery codes of users
+type RecoveryCodeRepository struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
+}
+
+// create new recovery code repository
+func NewRecoveryCodeRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// replace for user swaps a user's recovery codes for a new set, so old codes stop working
+func (r *RecoveryCodeRepository) ReplaceForUser(ctx context.Context, userID string, codes []*models.RecoveryCode) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to begin transaction")
+		return errors.NewInternalError("database error", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, r.dialect.Rebind("DELETE FROM recovery_codes WHERE user_id = ?"), userID); err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to delete recovery codes")
+		return errors.NewInternalError("failed to save recovery codes", err)
+	}
+
+	insert := r.dialect.Rebind(`
+		INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+		VALUES (?, ?, ?, ?)
+	`)
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx, insert, code.ID, code.UserID, code.CodeHash, code.CreatedAt); err != nil {
+			r.logger.WithError(err).WithField("user_id", userID).Error("failed to insert recovery code")
+			return errors.NewInternalError("failed to save recovery codes", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.WithError(err).Error("failed to commit transaction")
+		return errors.NewInternalError("database error", err)
+	}
+	return nil
+}
+
+// consume marks an unused recovery code as used; returns false if no unused code matches
+func (r *RecoveryCodeRepository) Consume(ctx context.Context, userID, hash string) (bool, error) {
+	query := r.dialect.Rebind(`
+		UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`)
+	result, err := r.db.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to consume recovery code")
+		return false, errors.NewInternalError("database error", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// delete for user removes all recovery codes of a user
+func (r *RecoveryCodeRepository) DeleteForUser(ctx context.Context, userID string) error {
+	query := r.dialect.Rebind("DELETE FROM recovery_codes WHERE user_id = ?")
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to delete recovery codes")
+		return errors.NewInternalError("database error", err)
+	}
+	return nil
+}
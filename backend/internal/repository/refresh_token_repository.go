@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// refresh token repository handles database operations for refresh tokens and sessions
+type RefreshTokenRepository struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
+}
+
+// create new refresh token repository
+func NewRefreshTokenRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// refresh token columns is the full column list scanned by scanRefreshToken
+const refreshTokenColumns = `id, family_id, user_id, token_hash, user_agent, ip_address, session_started_at, created_at, expires_at, rotated_at, revoked_at`
+
+// scan refresh token reads one row selected with refreshTokenColumns
+func scanRefreshToken(row rowScanner) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{}
+	err := row.Scan(
+		&token.ID,
+		&token.FamilyID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.UserAgent,
+		&token.IPAddress,
+		&token.SessionStartedAt,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.RotatedAt,
+		&token.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// create inserts a new refresh token record
+func (r *RefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	query := r.dialect.Rebind(`
+		INSERT INTO refresh_tokens (id, family_id, user_id, token_hash, user_agent, ip_address, session_started_at, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+
+	_, err := r.db.ExecContext(ctx, query,
+		token.ID,
+		token.FamilyID,
+		token.UserID,
+		token.TokenHash,
+		token.UserAgent,
+		token.IPAddress,
+		token.SessionStartedAt,
+		token.CreatedAt,
+		token.ExpiresAt,
+	)
+	if err != nil {
+		r.logger.WithError(err).WithField("family_id", token.FamilyID).Error("failed to create refresh token")
+		return errors.NewInternalError("failed to save refresh token", err)
+	}
+
+	return nil
+}
+
+// find by hash retrieves a refresh token record by the hash of the token, whatever its state
+func (r *RefreshTokenRepository) FindByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	query := r.dialect.Rebind(`
+		SELECT ` + refreshTokenColumns + `
+		FROM refresh_tokens
+		WHERE token_hash = ?
+	`)
+
+	token, err := scanRefreshToken(r.db.QueryRowContext(ctx, query, hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		r.logger.WithError(err).Error("failed to find refresh token")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return token, nil
+}
+
+// mark rotated records that a token has been exchanged for a new one.
+// only an unused, unrevoked token can be rotated, so two concurrent refreshes
+// with the same token cannot both succeed; returns false if it was already used.
+func (r *RefreshTokenRepository) MarkRotated(ctx context.Context, id string) (bool, error) {
+	query := r.dialect.Rebind(`
+		UPDATE refresh_tokens SET rotated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND rotated_at IS NULL AND revoked_at IS NULL
+	`)
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		r.logger.WithError(err).WithField("token_id", id).Error("failed to rotate refresh token")
+		return false, errors.NewInternalError("failed to rotate refresh token", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// revoke family revokes every token of a session; scoped to the user so one user can't end another's session.
+// returns false if the user has no live tokens in that family.
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, userID, familyID string) (bool, error) {
+	query := r.dialect.Rebind(`
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND family_id = ? AND revoked_at IS NULL
+	`)
+	result, err := r.db.ExecContext(ctx, query, userID, familyID)
+	if err != nil {
+		r.logger.WithError(err).WithField("family_id", familyID).Error("failed to revoke refresh token family")
+		return false, errors.NewInternalError("failed to revoke session", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// revoke all for user revokes every session of a user and returns how many tokens were revoked
+func (r *RefreshTokenRepository) RevokeAllForUser(ctx context.Context, userID string) (int64, error) {
+	query := r.dialect.Rebind(`
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND revoked_at IS NULL
+	`)
+	result, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to revoke user sessions")
+		return 0, errors.NewInternalError("failed to revoke sessions", err)
+	}
+	return result.RowsAffected()
+}
+
+// revoke others for user revokes every session of a user except keepFamilyID
+func (r *RefreshTokenRepository) RevokeOthersForUser(ctx context.Context, userID, keepFamilyID string) (int64, error) {
+	query := r.dialect.Rebind(`
+		UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND family_id <> ? AND revoked_at IS NULL
+	`)
+	result, err := r.db.ExecContext(ctx, query, userID, keepFamilyID)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to revoke other sessions")
+		return 0, errors.NewInternalError("failed to revoke sessions", err)
+	}
+	return result.RowsAffected()
+}
+
+// list active by user returns the current token of each live session, newest activity first
+func (r *RefreshTokenRepository) ListActiveByUser(ctx context.Context, userID string) ([]*models.RefreshToken, error) {
+	query := r.dialect.Rebind(`
+		SELECT ` + refreshTokenColumns + `
+		FROM refresh_tokens
+		WHERE user_id = ? AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC
+	`)
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to list sessions")
+		return nil, errors.NewInternalError("database error", err)
+	}
+	defer rows.Close()
+
+	var tokens []*models.RefreshToken
+	for rows.Next() {
+		token, err := scanRefreshToken(rows)
+		if err != nil {
+			r.logger.WithError(err).Error("failed to scan refresh token row")
+			return nil, errors.NewInternalError("database error", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("error iterating sessions")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return tokens, nil
+}
+
+// delete expired removes tokens past their expiry. rotated tokens are kept until then
+// so that replaying one is still recognised as reuse.
+func (r *RefreshTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := r.dialect.Rebind("DELETE FROM refresh_tokens WHERE expires_at < CURRENT_TIMESTAMP")
+	result, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to delete expired refresh tokens")
+		return 0, errors.NewInternalError("failed to delete expired refresh tokens", err)
+	}
+	return result.RowsAffected()
+}
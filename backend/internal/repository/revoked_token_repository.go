@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"konbi/internal/errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// revoked token repository is the database-backed store of revoked access token ids,
+// shared by every instance pointing at the same database
+type RevokedTokenRepository struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
+}
+
+// create new revoked token repository
+func NewRevokedTokenRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *RevokedTokenRepository {
+	return &RevokedTokenRepository{
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// revoke records jti as revoked until expiresAt; revoking it again is a no-op
+func (r *RevokedTokenRepository) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	query := r.dialect.Rebind(r.dialect.Upsert("revoked_tokens", []string{"jti", "expires_at"}, []string{"jti"}, nil))
+	if _, err := r.db.ExecContext(ctx, query, jti, expiresAt.UTC()); err != nil {
+		r.logger.WithError(err).WithField("jti", jti).Error("failed to revoke token")
+		return errors.NewInternalError("failed to revoke token", err)
+	}
+	return nil
+}
+
+// is revoked reports whether jti has been revoked
+func (r *RevokedTokenRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var exists bool
+	query := r.dialect.Rebind("SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ?)")
+	if err := r.db.QueryRowContext(ctx, query, jti).Scan(&exists); err != nil {
+		r.logger.WithError(err).WithField("jti", jti).Error("failed to check token revocation")
+		return false, errors.NewInternalError("database error", err)
+	}
+	return exists, nil
+}
+
+// prune forgets revocations of tokens that have expired anyway
+func (r *RevokedTokenRepository) Prune(ctx context.Context) (int64, error) {
+	query := r.dialect.Rebind("DELETE FROM revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP")
+	result, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to prune revoked tokens")
+		return 0, errors.NewInternalError("failed to prune revoked tokens", err)
+	}
+	return result.RowsAffected()
+}
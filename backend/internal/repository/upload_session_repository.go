@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// upload session repository handles database operations for resumable uploads
+type UploadSessionRepository struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
+}
+
+// create new upload session repository
+func NewUploadSessionRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *UploadSessionRepository {
+	return &UploadSessionRepository{
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// create inserts a new upload session
+func (r *UploadSessionRepository) Create(ctx context.Context, session *models.UploadSession) error {
+	query := r.dialect.Rebind(`
+		INSERT INTO upload_sessions (id, filename, total_size, upload_offset, status, created_at, updated_at, expires_at, user_id, token_hash)
+		VALUES (?, ?, ?, 0, ?, ?, ?, ?, ?, ?)
+	`)
+
+	_, err := r.db.ExecContext(ctx, query,
+		session.ID,
+		session.Filename,
+		session.TotalSize,
+		session.Status,
+		session.CreatedAt,
+		session.UpdatedAt,
+		session.ExpiresAt,
+		session.UserID,
+		session.TokenHash,
+	)
+	if err != nil {
+		r.logger.WithError(err).WithField("session_id", session.ID).Error("failed to create upload session")
+		return errors.NewInternalError("failed to create upload session", err)
+	}
+
+	return nil
+}
+
+// find active by id retrieves a non-expired upload session
+func (r *UploadSessionRepository) FindActiveByID(ctx context.Context, id string) (*models.UploadSession, error) {
+	query := r.dialect.Rebind(`
+		SELECT id, filename, total_size, upload_offset, status, created_at, updated_at, expires_at, user_id, token_hash
+		FROM upload_sessions
+		WHERE id = ? AND expires_at > CURRENT_TIMESTAMP
+	`)
+
+	session := &models.UploadSession{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&session.ID,
+		&session.Filename,
+		&session.TotalSize,
+		&session.Offset,
+		&session.Status,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+		&session.ExpiresAt,
+		&session.UserID,
+		&session.TokenHash,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.NewNotFoundError("upload session not found or expired")
+	}
+	if err != nil {
+		r.logger.WithError(err).WithField("session_id", id).Error("failed to find upload session")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return session, nil
+}
+
+// append chunk records a stored chunk and advances the session offset.
+// the offset only moves if it still equals chunk.StartOffset, so concurrent
+// writers to the same offset cannot both succeed; returns false on conflict.
+func (r *UploadSessionRepository) AppendChunk(ctx context.Context, chunk *models.UploadChunk, expiresAt time.Time) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to begin transaction")
+		return false, errors.NewInternalError("failed to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	update := r.dialect.Rebind(`
+		UPDATE upload_sessions
+		SET upload_offset = upload_offset + ?, updated_at = CURRENT_TIMESTAMP, expires_at = ?
+		WHERE id = ? AND upload_offset = ? AND status = ?
+	`)
+	result, err := tx.ExecContext(ctx, update, chunk.Size, expiresAt, chunk.SessionID, chunk.StartOffset, models.UploadSessionActive)
+	if err != nil {
+		r.logger.WithError(err).WithField("session_id", chunk.SessionID).Error("failed to advance upload offset")
+		return false, errors.NewInternalError("failed to update upload session", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return false, nil
+	}
+
+	insert := r.dialect.Rebind(`
+		INSERT INTO upload_chunks (session_id, start_offset, size, storage_key)
+		VALUES (?, ?, ?, ?)
+	`)
+	if _, err := tx.ExecContext(ctx, insert, chunk.SessionID, chunk.StartOffset, chunk.Size, chunk.StorageKey); err != nil {
+		r.logger.WithError(err).WithField("session_id", chunk.SessionID).Error("failed to record upload chunk")
+		return false, errors.NewInternalError("failed to update upload session", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.WithError(err).Error("failed to commit transaction")
+		return false, errors.NewInternalError("failed to commit transaction", err)
+	}
+
+	return true, nil
+}
+
+// find chunks returns the chunks of a session in offset order
+func (r *UploadSessionRepository) FindChunks(ctx context.Context, sessionID string) ([]*models.UploadChunk, error) {
+	query := r.dialect.Rebind(`
+		SELECT session_id, start_offset, size, storage_key
+		FROM upload_chunks
+		WHERE session_id = ?
+		ORDER BY start_offset ASC
+	`)
+
+	rows, err := r.db.QueryContext(ctx, query, sessionID)
+	if err != nil {
+		r.logger.WithError(err).WithField("session_id", sessionID).Error("failed to find upload chunks")
+		return nil, errors.NewInternalError("database error", err)
+	}
+	defer rows.Close()
+
+	var chunks []*models.UploadChunk
+	for rows.Next() {
+		chunk := &models.UploadChunk{}
+		if err := rows.Scan(&chunk.SessionID, &chunk.StartOffset, &chunk.Size, &chunk.StorageKey); err != nil {
+			r.logger.WithError(err).Error("failed to scan upload chunk row")
+			return nil, errors.NewInternalError("database error", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithError(err).WithField("session_id", sessionID).Error("error iterating upload chunks")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return chunks, nil
+}
+
+// set status moves a session from one status to another; returns false if it was not in the expected status
+func (r *UploadSessionRepository) SetStatus(ctx context.Context, id, from, to string) (bool, error) {
+	query := r.dialect.Rebind(`
+		UPDATE upload_sessions SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?
+	`)
+	result, err := r.db.ExecContext(ctx, query, to, id, from)
+	if err != nil {
+		r.logger.WithError(err).WithField("session_id", id).Error("failed to update upload session status")
+		return false, errors.NewInternalError("failed to update upload session", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// delete removes a session and its chunk records
+func (r *UploadSessionRepository) Delete(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to begin transaction")
+		return errors.NewInternalError("failed to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	// sqlite doesn't enforce ON DELETE CASCADE unless foreign keys are enabled, so delete chunks explicitly
+	if _, err := tx.ExecContext(ctx, r.dialect.Rebind("DELETE FROM upload_chunks WHERE session_id = ?"), id); err != nil {
+		r.logger.WithError(err).WithField("session_id", id).Error("failed to delete upload chunks")
+		return errors.NewInternalError("failed to delete upload session", err)
+	}
+	if _, err := tx.ExecContext(ctx, r.dialect.Rebind("DELETE FROM upload_sessions WHERE id = ?"), id); err != nil {
+		r.logger.WithError(err).WithField("session_id", id).Error("failed to delete upload session")
+		return errors.NewInternalError("failed to delete upload session", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.WithError(err).Error("failed to commit transaction")
+		return errors.NewInternalError("failed to commit transaction", err)
+	}
+
+	return nil
+}
+
+// find expired returns ids of sessions that have been abandoned
+func (r *UploadSessionRepository) FindExpired(ctx context.Context) ([]string, error) {
+	query := r.dialect.Rebind("SELECT id FROM upload_sessions WHERE expires_at < CURRENT_TIMESTAMP")
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to find expired upload sessions")
+		return nil, errors.NewInternalError("database error", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			r.logger.WithError(err).Error("failed to scan expired upload session")
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -5,38 +5,72 @@ import (
 	"database/sql"
 	"konbi/internal/errors"
 	"konbi/internal/models"
-	"os"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 // user repository handles user database operations
 type UserRepository struct {
-	db         *sql.DB
-	logger     *logrus.Logger
-	isPostgres bool
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
 }
 
 // create new user repository
-func NewUserRepository(db *sql.DB, logger *logrus.Logger) *UserRepository {
+func NewUserRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *UserRepository {
 	return &UserRepository{
-		db:         db,
-		logger:     logger,
-		isPostgres: os.Getenv("DATABASE_URL") != "",
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
 	}
 }
 
+// user columns is the full column list scanned by scanUser
+const userColumns = `id, email, password_hash, email_verified_at, totp_secret, totp_enabled_at, totp_last_step, role, disabled_at, storage_bytes, storage_items, quota_bytes, quota_items, tokens_valid_after, created_at, updated_at`
+
+// scan user reads one row selected with userColumns
+func scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.EmailVerifiedAt,
+		&user.TOTPSecret,
+		&user.TOTPEnabledAt,
+		&user.TOTPLastStep,
+		&user.Role,
+		&user.DisabledAt,
+		&user.StorageBytes,
+		&user.StorageItems,
+		&user.QuotaBytes,
+		&user.QuotaItems,
+		&user.TokensValidAfter,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 // create inserts new user
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
-	query := convertQuery(r.isPostgres, `
-		INSERT INTO users (id, email, password_hash, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?)
+	query := r.dialect.Rebind(`
+		INSERT INTO users (id, email, password_hash, email_verified_at, role, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`)
 
-	_, err := r.db.ExecContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.CreatedAt, user.UpdatedAt)
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	_, err := r.db.ExecContext(ctx, query, user.ID, user.Email, user.PasswordHash, user.EmailVerifiedAt, user.Role, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
 		r.logger.WithError(err).WithField("email", user.Email).Error("failed to create user")
-		if err.Error() == "UNIQUE constraint failed: users.email" || err.Error() == "duplicate key value violates unique constraint \"users_email_key\"" {
+		if r.dialect.IsUniqueViolation(err) {
 			return errors.NewConflictError("email already exists")
 		}
 		return errors.NewInternalError("failed to create user", err)
@@ -47,20 +81,13 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 
 // get by id retrieves user by id
 func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
-	query := convertQuery(r.isPostgres, `
-		SELECT id, email, password_hash, created_at, updated_at
+	query := r.dialect.Rebind(`
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = ?
 	`)
 
-	var user models.User
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -71,25 +98,18 @@ func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User,
 		return nil, errors.NewInternalError("failed to get user", err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 // get by email retrieves user by email
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
-	query := convertQuery(r.isPostgres, `
-		SELECT id, email, password_hash, created_at, updated_at
+	query := r.dialect.Rebind(`
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = ?
 	`)
 
-	var user models.User
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, email))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -100,5 +120,312 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 		return nil, errors.NewInternalError("failed to get user", err)
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// mark email verified records that the user confirmed their email, but only while it is still their address.
+// returns false if the address changed since the token was issued.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id, email string) (bool, error) {
+	query := r.dialect.Rebind(`
+		UPDATE users SET email_verified_at = ?, updated_at = ?
+		WHERE id = ? AND email = ?
+	`)
+	now := time.Now().UTC()
+	result, err := r.db.ExecContext(ctx, query, now, now, id, email)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to mark email verified")
+		return false, errors.NewInternalError("failed to update user", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// update password replaces the user's password hash
+func (r *UserRepository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	query := r.dialect.Rebind(`
+		UPDATE users SET password_hash = ?, updated_at = ?
+		WHERE id = ?
+	`)
+	result, err := r.db.ExecContext(ctx, query, passwordHash, time.Now().UTC(), id)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to update password")
+		return errors.NewInternalError("failed to update user", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.NewNotFoundError("user not found")
+	}
+	return nil
+}
+
+// update email changes the user's address and clears its verification
+func (r *UserRepository) UpdateEmail(ctx context.Context, id, email string) error {
+	query := r.dialect.Rebind(`
+		UPDATE users SET email = ?, email_verified_at = NULL, updated_at = ?
+		WHERE id = ?
+	`)
+	result, err := r.db.ExecContext(ctx, query, email, time.Now().UTC(), id)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to update email")
+		if r.dialect.IsUniqueViolation(err) {
+			return errors.NewConflictError("email already registered")
+		}
+		return errors.NewInternalError("failed to update user", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.NewNotFoundError("user not found")
+	}
+	return nil
+}
+
+// delete removes a user together with their refresh and mailed tokens.
+// content must be removed first, since it references the user.
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to begin transaction")
+		return errors.NewInternalError("database error", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"user_tokens", "refresh_tokens", "recovery_codes", "api_keys", "user_identities"} {
+		if _, err := tx.ExecContext(ctx, r.dialect.Rebind("DELETE FROM "+table+" WHERE user_id = ?"), id); err != nil {
+			r.logger.WithError(err).WithFields(logrus.Fields{"user_id": id, "table": table}).Error("failed to delete user rows")
+			return errors.NewInternalError("failed to delete user", err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, r.dialect.Rebind("DELETE FROM users WHERE id = ?"), id)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to delete user")
+		return errors.NewInternalError("failed to delete user", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.NewNotFoundError("user not found")
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.WithError(err).Error("failed to commit transaction")
+		return errors.NewInternalError("database error", err)
+	}
+
+	r.logger.WithField("user_id", id).Info("user deleted")
+	return nil
+}
+
+// set totp secret starts (or restarts) a totp enrollment; fails once totp is enabled
+func (r *UserRepository) SetTOTPSecret(ctx context.Context, id, secret string) error {
+	query := r.dialect.Rebind(`
+		UPDATE users SET totp_secret = ?, totp_last_step = NULL, updated_at = ?
+		WHERE id = ? AND totp_enabled_at IS NULL
+	`)
+	result, err := r.db.ExecContext(ctx, query, secret, time.Now().UTC(), id)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to set totp secret")
+		return errors.NewInternalError("failed to update user", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.NewConflictError("two-factor authentication is already enabled")
+	}
+	return nil
+}
+
+// enable totp confirms a pending enrollment; step is the time step of the code that confirmed it
+func (r *UserRepository) EnableTOTP(ctx context.Context, id string, step int64) error {
+	query := r.dialect.Rebind(`
+		UPDATE users SET totp_enabled_at = ?, totp_last_step = ?, updated_at = ?
+		WHERE id = ? AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+	`)
+	now := time.Now().UTC()
+	result, err := r.db.ExecContext(ctx, query, now, step, now, id)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to enable totp")
+		return errors.NewInternalError("failed to update user", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.NewConflictError("no pending two-factor enrollment")
+	}
+	return nil
+}
+
+// update role changes the account's role
+func (r *UserRepository) UpdateRole(ctx context.Context, id, role string) error {
+	query := r.dialect.Rebind("UPDATE users SET role = ?, updated_at = ? WHERE id = ?")
+	result, err := r.db.ExecContext(ctx, query, role, time.Now().UTC(), id)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to update role")
+		return errors.NewInternalError("failed to update user", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.NewNotFoundError("user not found")
+	}
+	return nil
+}
+
+// set disabled disables or re-enables an account
+func (r *UserRepository) SetDisabled(ctx context.Context, id string, disabled bool) error {
+	var disabledAt *time.Time
+	now := time.Now().UTC()
+	if disabled {
+		disabledAt = &now
+	}
+
+	query := r.dialect.Rebind("UPDATE users SET disabled_at = ?, updated_at = ? WHERE id = ?")
+	result, err := r.db.ExecContext(ctx, query, disabledAt, now, id)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to update disabled state")
+		return errors.NewInternalError("failed to update user", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.NewNotFoundError("user not found")
+	}
+	return nil
+}
+
+// invalidate tokens refuses the user's access tokens issued up to at, which outlive their
+// refresh tokens until they expire
+func (r *UserRepository) InvalidateTokens(ctx context.Context, id string, at time.Time) error {
+	query := r.dialect.Rebind("UPDATE users SET tokens_valid_after = ?, updated_at = ? WHERE id = ?")
+	result, err := r.db.ExecContext(ctx, query, at.UTC(), time.Now().UTC(), id)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to invalidate tokens")
+		return errors.NewInternalError("failed to update user", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.NewNotFoundError("user not found")
+	}
+	return nil
+}
+
+// charge storage adds bytes and items to the user's usage if the result stays within their quota,
+// their own or else the given default (0 is unlimited), and returns false if it wouldn't.
+// the check and the update are one statement, so concurrent uploads can't overshoot together.
+func (r *UserRepository) ChargeStorage(ctx context.Context, id string, bytes int64, items int, defaultBytes int64, defaultItems int) (bool, error) {
+	query := r.dialect.Rebind(`
+		UPDATE users SET storage_bytes = storage_bytes + ?, storage_items = storage_items + ?
+		WHERE id = ?
+			AND (COALESCE(quota_bytes, ?) = 0 OR storage_bytes + ? <= COALESCE(quota_bytes, ?))
+			AND (COALESCE(quota_items, ?) = 0 OR storage_items + ? <= COALESCE(quota_items, ?))
+	`)
+	result, err := r.db.ExecContext(ctx, query,
+		bytes, items, id,
+		defaultBytes, bytes, defaultBytes,
+		defaultItems, items, defaultItems,
+	)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to charge storage")
+		return false, errors.NewInternalError("failed to update user", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// add storage adjusts the user's usage without a quota check, e.g. to give back a charge
+// for content that was never saved
+func (r *UserRepository) AddStorage(ctx context.Context, id string, bytes int64, items int) error {
+	query := r.dialect.Rebind("UPDATE users SET storage_bytes = storage_bytes + ?, storage_items = storage_items + ? WHERE id = ?")
+	if _, err := r.db.ExecContext(ctx, query, bytes, items, id); err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to adjust storage")
+		return errors.NewInternalError("failed to update user", err)
+	}
+	return nil
+}
+
+// set quota overrides the user's quota; nil goes back to the default
+func (r *UserRepository) SetQuota(ctx context.Context, id string, bytes *int64, items *int) error {
+	query := r.dialect.Rebind("UPDATE users SET quota_bytes = ?, quota_items = ?, updated_at = ? WHERE id = ?")
+	result, err := r.db.ExecContext(ctx, query, bytes, items, time.Now().UTC(), id)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to set quota")
+		return errors.NewInternalError("failed to update user", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errors.NewNotFoundError("user not found")
+	}
+	return nil
+}
+
+// search returns a page of users matching filter, newest first, with the total count
+func (r *UserRepository) Search(ctx context.Context, filter *models.UserFilter) ([]*models.User, int, error) {
+	var conditions []string
+	var args []any
+	if filter.Search != "" {
+		conditions = append(conditions, "LOWER(email) LIKE ? ESCAPE '!'")
+		args = append(args, "%"+likeEscaper.Replace(strings.ToLower(filter.Search))+"%")
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, "role = ?")
+		args = append(args, filter.Role)
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			conditions = append(conditions, "disabled_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "disabled_at IS NULL")
+		}
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	countQuery := r.dialect.Rebind("SELECT COUNT(*) FROM users" + where)
+	if err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		r.logger.WithError(err).Error("failed to count users")
+		return nil, 0, errors.NewInternalError("database error", err)
+	}
+
+	query := r.dialect.Rebind("SELECT " + userColumns + " FROM users" + where + " ORDER BY created_at DESC, id ASC LIMIT ? OFFSET ?")
+	rows, err := r.db.QueryContext(ctx, query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to search users")
+		return nil, 0, errors.NewInternalError("database error", err)
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			r.logger.WithError(err).Error("failed to scan user row")
+			continue
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		r.logger.WithError(err).Error("error iterating users")
+		return nil, 0, errors.NewInternalError("database error", err)
+	}
+
+	return users, total, nil
+}
+
+// disable totp removes the secret and turns two-factor authentication off
+func (r *UserRepository) DisableTOTP(ctx context.Context, id string) error {
+	query := r.dialect.Rebind(`
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = ?
+		WHERE id = ?
+	`)
+	if _, err := r.db.ExecContext(ctx, query, time.Now().UTC(), id); err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to disable totp")
+		return errors.NewInternalError("failed to update user", err)
+	}
+	return nil
+}
+
+// use totp step records that the code for step was used. it only moves forward,
+// so a code (or an older one) can't be replayed; returns false if it was already used.
+func (r *UserRepository) UseTOTPStep(ctx context.Context, id string, step int64) (bool, error) {
+	query := r.dialect.Rebind(`
+		UPDATE users SET totp_last_step = ?
+		WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)
+	`)
+	result, err := r.db.ExecContext(ctx, query, step, id, step)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", id).Error("failed to record totp step")
+		return false, errors.NewInternalError("failed to update user", err)
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
 }
@@ -0,0 +1,314 @@
+package repository
+
+import (
+	"context"
+	"konbi/internal/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestUserRepositoryAccount(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewUserRepository(tdb.db, tdb.dialect, testLogger())
+		user := createTestUser(t, tdb, "alice@example.com")
+		other := createTestUser(t, tdb, "bob@example.com")
+
+		if user.Role != models.RoleUser {
+			t.Errorf("default role = %q, want %q", user.Role, models.RoleUser)
+		}
+		dup := *user
+		dup.ID = testID("user")
+		if err := repo.Create(ctx, &dup); statusCode(err) != 409 {
+			t.Errorf("create with a taken email = %v, want a conflict", err)
+		}
+
+		found, err := repo.GetByID(ctx, user.ID)
+		if err != nil || found == nil || found.Email != user.Email || found.Role != models.RoleUser || found.EmailVerifiedAt != nil {
+			t.Fatalf("get by id = %+v, %v", found, err)
+		}
+		if found, err := repo.GetByEmail(ctx, "alice@example.com"); err != nil || found == nil || found.ID != user.ID {
+			t.Errorf("get by email = %+v, %v", found, err)
+		}
+		if found, err := repo.GetByID(ctx, "missing"); found != nil || err != nil {
+			t.Errorf("get unknown id = %v, %v; want nil, nil", found, err)
+		}
+		if found, err := repo.GetByEmail(ctx, "nobody@example.com"); found != nil || err != nil {
+			t.Errorf("get unknown email = %v, %v; want nil, nil", found, err)
+		}
+
+		if ok, err := repo.MarkEmailVerified(ctx, user.ID, "old@example.com"); ok || err != nil {
+			t.Errorf("verify a stale address = %v, %v; want false", ok, err)
+		}
+		if ok, err := repo.MarkEmailVerified(ctx, user.ID, user.Email); !ok || err != nil {
+			t.Errorf("verify = %v, %v; want true", ok, err)
+		}
+
+		if err := repo.UpdatePassword(ctx, user.ID, "new-hash"); err != nil {
+			t.Fatalf("update password: %v", err)
+		}
+		if err := repo.UpdatePassword(ctx, "missing", "new-hash"); statusCode(err) != 404 {
+			t.Errorf("update password of unknown user = %v, want not found", err)
+		}
+
+		if err := repo.UpdateEmail(ctx, user.ID, other.Email); statusCode(err) != 409 {
+			t.Errorf("update to a taken email = %v, want a conflict", err)
+		}
+		if err := repo.UpdateEmail(ctx, user.ID, "alice@example.org"); err != nil {
+			t.Fatalf("update email: %v", err)
+		}
+		if err := repo.UpdateEmail(ctx, "missing", "x@example.com"); statusCode(err) != 404 {
+			t.Errorf("update email of unknown user = %v, want not found", err)
+		}
+		found, err = repo.GetByID(ctx, user.ID)
+		if err != nil || found.Email != "alice@example.org" || found.PasswordHash != "new-hash" || found.EmailVerifiedAt != nil {
+			t.Errorf("updated user = %+v, %v; want new email and password, unverified", found, err)
+		}
+
+		if err := repo.UpdateRole(ctx, user.ID, models.RoleAdmin); err != nil {
+			t.Fatalf("update role: %v", err)
+		}
+		if err := repo.UpdateRole(ctx, "missing", models.RoleAdmin); statusCode(err) != 404 {
+			t.Errorf("update role of unknown user = %v, want not found", err)
+		}
+		if err := repo.SetDisabled(ctx, user.ID, true); err != nil {
+			t.Fatalf("disable: %v", err)
+		}
+		if found, err := repo.GetByID(ctx, user.ID); err != nil || found.Role != models.RoleAdmin || found.DisabledAt == nil {
+			t.Errorf("user after role and disable = %+v, %v", found, err)
+		}
+		if err := repo.SetDisabled(ctx, user.ID, false); err != nil {
+			t.Fatalf("enable: %v", err)
+		}
+		if found, err := repo.GetByID(ctx, user.ID); err != nil || found.DisabledAt != nil {
+			t.Errorf("enabled user = %+v, %v", found, err)
+		}
+		if err := repo.SetDisabled(ctx, "missing", true); statusCode(err) != 404 {
+			t.Errorf("disable unknown user = %v, want not found", err)
+		}
+
+		cutoff := time.Now().UTC().Truncate(time.Second)
+		if err := repo.InvalidateTokens(ctx, user.ID, cutoff); err != nil {
+			t.Fatalf("invalidate tokens: %v", err)
+		}
+		if found, err := repo.GetByID(ctx, user.ID); err != nil || found.TokensValidAfter == nil || !found.TokensValidAfter.Equal(cutoff) {
+			t.Errorf("tokens valid after = %v, %v; want %v", found.TokensValidAfter, err, cutoff)
+		}
+		if err := repo.InvalidateTokens(ctx, "missing", cutoff); statusCode(err) != 404 {
+			t.Errorf("invalidate tokens of unknown user = %v, want not found", err)
+		}
+	})
+}
+
+func TestUserRepositoryTOTP(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewUserRepository(tdb.db, tdb.dialect, testLogger())
+		user := createTestUser(t, tdb, "totp@example.com")
+
+		if err := repo.EnableTOTP(ctx, user.ID, 100); statusCode(err) != 409 {
+			t.Errorf("enable without a secret = %v, want a conflict", err)
+		}
+		if err := repo.SetTOTPSecret(ctx, user.ID, "SECRET"); err != nil {
+			t.Fatalf("set secret: %v", err)
+		}
+		if err := repo.EnableTOTP(ctx, user.ID, 100); err != nil {
+			t.Fatalf("enable: %v", err)
+		}
+		if err := repo.SetTOTPSecret(ctx, user.ID, "OTHER"); statusCode(err) != 409 {
+			t.Errorf("set secret once enabled = %v, want a conflict", err)
+		}
+
+		found, err := repo.GetByID(ctx, user.ID)
+		if err != nil || found.TOTPSecret == nil || *found.TOTPSecret != "SECRET" || found.TOTPEnabledAt == nil || found.TOTPLastStep == nil || *found.TOTPLastStep != 100 {
+			t.Fatalf("enrolled user = %+v, %v", found, err)
+		}
+
+		steps := []struct {
+			step int64
+			want bool
+		}{
+			{100, false}, // the code that enabled totp
+			{99, false},
+			{101, true},
+			{101, false},
+		}
+		for _, s := range steps {
+			if ok, err := repo.UseTOTPStep(ctx, user.ID, s.step); ok != s.want || err != nil {
+				t.Errorf("use step %d = %v, %v; want %v", s.step, ok, err, s.want)
+			}
+		}
+
+		if err := repo.DisableTOTP(ctx, user.ID); err != nil {
+			t.Fatalf("disable: %v", err)
+		}
+		found, err = repo.GetByID(ctx, user.ID)
+		if err != nil || found.TOTPSecret != nil || found.TOTPEnabledAt != nil || found.TOTPLastStep != nil {
+			t.Errorf("user after disabling totp = %+v, %v", found, err)
+		}
+	})
+}
+
+func TestUserRepositoryStorage(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewUserRepository(tdb.db, tdb.dialect, testLogger())
+		user := createTestUser(t, tdb, "quota@example.com")
+
+		charges := []struct {
+			name         string
+			bytes        int64
+			items        int
+			defaultBytes int64
+			defaultItems int
+			want         bool
+		}{
+			{"within the default", 60, 1, 100, 2, true},
+			{"over the default bytes", 50, 1, 100, 2, false},
+			{"up to the default items", 40, 1, 100, 2, true},
+			{"over the default items", 0, 1, 100, 2, false},
+			{"unlimited default", 1000, 5, 0, 0, true},
+		}
+		for _, c := range charges {
+			if ok, err := repo.ChargeStorage(ctx, user.ID, c.bytes, c.items, c.defaultBytes, c.defaultItems); ok != c.want || err != nil {
+				t.Errorf("%s: charge = %v, %v; want %v", c.name, ok, err, c.want)
+			}
+		}
+
+		if err := repo.AddStorage(ctx, user.ID, -1000, -5); err != nil {
+			t.Fatalf("add storage: %v", err)
+		}
+		found, err := repo.GetByID(ctx, user.ID)
+		if err != nil || found.StorageBytes != 100 || found.StorageItems != 2 {
+			t.Fatalf("usage = %d bytes, %d items, %v; want 100, 2", found.StorageBytes, found.StorageItems, err)
+		}
+
+		// the user's own quota overrides the default
+		if err := repo.SetQuota(ctx, user.ID, ptr(int64(150)), ptr(0)); err != nil {
+			t.Fatalf("set quota: %v", err)
+		}
+		if ok, err := repo.ChargeStorage(ctx, user.ID, 50, 3, 100, 2); !ok || err != nil {
+			t.Errorf("charge within the own quota = %v, %v; want true", ok, err)
+		}
+		if ok, err := repo.ChargeStorage(ctx, user.ID, 1, 0, 0, 0); ok || err != nil {
+			t.Errorf("charge over the own quota = %v, %v; want false", ok, err)
+		}
+		found, err = repo.GetByID(ctx, user.ID)
+		if err != nil || found.QuotaBytes == nil || *found.QuotaBytes != 150 || found.QuotaItems == nil || *found.QuotaItems != 0 {
+			t.Errorf("quota = %v, %v, %v", found.QuotaBytes, found.QuotaItems, err)
+		}
+		if err := repo.SetQuota(ctx, user.ID, nil, nil); err != nil {
+			t.Fatalf("reset quota: %v", err)
+		}
+		if err := repo.SetQuota(ctx, "missing", nil, nil); statusCode(err) != 404 {
+			t.Errorf("set quota of unknown user = %v, want not found", err)
+		}
+	})
+}
+
+func TestUserRepositorySearch(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewUserRepository(tdb.db, tdb.dialect, testLogger())
+
+		admin := createTestUser(t, tdb, "Admin@Example.com")
+		plain := createTestUser(t, tdb, "plain@example.com")
+		under := createTestUser(t, tdb, "under_score@example.com")
+		off := createTestUser(t, tdb, "off@example.com")
+		if err := repo.UpdateRole(ctx, admin.ID, models.RoleAdmin); err != nil {
+			t.Fatalf("update role: %v", err)
+		}
+		if err := repo.SetDisabled(ctx, off.ID, true); err != nil {
+			t.Fatalf("disable: %v", err)
+		}
+
+		tests := []struct {
+			name   string
+			filter models.UserFilter
+			want   []string
+			total  int
+		}{
+			{"everyone", models.UserFilter{Limit: 10}, []string{admin.ID, plain.ID, under.ID, off.ID}, 4},
+			{"email is case-insensitive", models.UserFilter{Search: "admin@", Limit: 10}, []string{admin.ID}, 1},
+			{"underscore is literal", models.UserFilter{Search: "r_s", Limit: 10}, []string{under.ID}, 1},
+			{"role", models.UserFilter{Role: models.RoleUser, Limit: 10}, []string{plain.ID, under.ID, off.ID}, 3},
+			{"disabled", models.UserFilter{Disabled: ptr(true), Limit: 10}, []string{off.ID}, 1},
+			{"enabled", models.UserFilter{Disabled: ptr(false), Limit: 10}, []string{admin.ID, plain.ID, under.ID}, 3},
+			{"page", models.UserFilter{Limit: 2, Offset: 1}, nil, 4},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				users, total, err := repo.Search(ctx, &tt.filter)
+				if err != nil {
+					t.Fatalf("search: %v", err)
+				}
+				if total != tt.total {
+					t.Errorf("total = %d, want %d", total, tt.total)
+				}
+				var ids []string
+				for _, u := range users {
+					ids = append(ids, u.ID)
+				}
+				if tt.want == nil {
+					if len(ids) != tt.filter.Limit {
+						t.Errorf("page has %d users, want %d", len(ids), tt.filter.Limit)
+					}
+					return
+				}
+				if !slices.Equal(sortedIDs(ids...), sortedIDs(tt.want...)) {
+					t.Errorf("users = %v, want %v", ids, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestUserRepositoryDelete(t *testing.T) {
+	eachDatabase(t, func(t *testing.T, tdb testDatabase) {
+		ctx := context.Background()
+		repo := NewUserRepository(tdb.db, tdb.dialect, testLogger())
+		user := createTestUser(t, tdb, "leaving@example.com")
+		now := time.Now().UTC()
+
+		// a row in every table that references the user
+		if err := NewUserTokenRepository(tdb.db, tdb.dialect, testLogger()).Create(ctx, &models.UserToken{
+			ID: testID("ut"), UserID: user.ID, Purpose: models.UserTokenResetPassword, TokenHash: "h1", CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+		}); err != nil {
+			t.Fatalf("create user token: %v", err)
+		}
+		if err := NewRefreshTokenRepository(tdb.db, tdb.dialect, testLogger()).Create(ctx, &models.RefreshToken{
+			ID: testID("rt"), FamilyID: "fam", UserID: user.ID, TokenHash: "h2", SessionStartedAt: now, CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+		}); err != nil {
+			t.Fatalf("create refresh token: %v", err)
+		}
+		if err := NewRecoveryCodeRepository(tdb.db, tdb.dialect, testLogger()).ReplaceForUser(ctx, user.ID, []*models.RecoveryCode{
+			{ID: testID("rc"), UserID: user.ID, CodeHash: "h3", CreatedAt: now},
+		}); err != nil {
+			t.Fatalf("create recovery code: %v", err)
+		}
+		if err := NewAPIKeyRepository(tdb.db, tdb.dialect, testLogger()).Create(ctx, &models.APIKey{
+			ID: testID("key"), UserID: user.ID, Name: "k", Prefix: "kb_leaving", SecretHash: "h4", CreatedAt: now,
+		}); err != nil {
+			t.Fatalf("create api key: %v", err)
+		}
+		if err := NewIdentityRepository(tdb.db, tdb.dialect, testLogger()).Create(ctx, &models.UserIdentity{
+			ID: testID("idn"), UserID: user.ID, Provider: "google", Subject: "leaving", Email: user.Email, CreatedAt: now,
+		}); err != nil {
+			t.Fatalf("create identity: %v", err)
+		}
+
+		if err := repo.Delete(ctx, user.ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if found, err := repo.GetByID(ctx, user.ID); found != nil || err != nil {
+			t.Errorf("deleted user = %v, %v; want nil, nil", found, err)
+		}
+		if key, err := NewAPIKeyRepository(tdb.db, tdb.dialect, testLogger()).FindByPrefix(ctx, "kb_leaving"); key != nil || err != nil {
+			t.Errorf("api key of deleted user = %v, %v; want nil, nil", key, err)
+		}
+		if err := repo.Delete(ctx, user.ID); statusCode(err) != 404 {
+			t.Errorf("delete twice = %v, want not found", err)
+		}
+	})
+}
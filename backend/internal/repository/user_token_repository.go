@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+
+	"github.com/sirupsen/logrus"
+)
+
+// user token repository handles the single-use tokens mailed to users
+type UserTokenRepository struct {
+	db      *sql.DB
+	logger  *logrus.Logger
+	dialect Dialect
+}
+
+// create new user token repository
+func NewUserTokenRepository(db *sql.DB, dialect Dialect, logger *logrus.Logger) *UserTokenRepository {
+	return &UserTokenRepository{
+		db:      db,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// create inserts a new user token
+func (r *UserTokenRepository) Create(ctx context.Context, token *models.UserToken) error {
+	query := r.dialect.Rebind(`
+		INSERT INTO user_tokens (id, user_id, purpose, token_hash, email, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+
+	_, err := r.db.ExecContext(ctx, query,
+		token.ID,
+		token.UserID,
+		token.Purpose,
+		token.TokenHash,
+		token.Email,
+		token.CreatedAt,
+		token.ExpiresAt,
+	)
+	if err != nil {
+		r.logger.WithError(err).WithField("user_id", token.UserID).Error("failed to create user token")
+		return errors.NewInternalError("failed to save token", err)
+	}
+
+	return nil
+}
+
+// consume marks an unused, unexpired token as used and returns it.
+// the update is the check, so a token can only be consumed once even under concurrent requests.
+// returns nil when no usable token matches.
+func (r *UserTokenRepository) Consume(ctx context.Context, purpose, hash string) (*models.UserToken, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to begin transaction")
+		return nil, errors.NewInternalError("database error", err)
+	}
+	defer tx.Rollback()
+
+	update := r.dialect.Rebind(`
+		UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	`)
+	result, err := tx.ExecContext(ctx, update, hash, purpose)
+	if err != nil {
+		r.logger.WithError(err).WithField("purpose", purpose).Error("failed to consume user token")
+		return nil, errors.NewInternalError("failed to use token", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, nil
+	}
+
+	query := r.dialect.Rebind(`
+		SELECT id, user_id, purpose, token_hash, email, created_at, expires_at, used_at
+		FROM user_tokens
+		WHERE token_hash = ?
+	`)
+	token := &models.UserToken{}
+	err = tx.QueryRowContext(ctx, query, hash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Purpose,
+		&token.TokenHash,
+		&token.Email,
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.UsedAt,
+	)
+	if err != nil {
+		r.logger.WithError(err).WithField("purpose", purpose).Error("failed to read consumed user token")
+		return nil, errors.NewInternalError("failed to use token", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.logger.WithError(err).Error("failed to commit transaction")
+		return nil, errors.NewInternalError("database error", err)
+	}
+
+	return token, nil
+}
+
+// invalidate for user marks every outstanding token of a purpose as used,
+// so an older link stops working once a newer one is sent or one is used
+func (r *UserTokenRepository) InvalidateForUser(ctx context.Context, userID, purpose string) error {
+	query := r.dialect.Rebind(`
+		UPDATE user_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND purpose = ? AND used_at IS NULL
+	`)
+	if _, err := r.db.ExecContext(ctx, query, userID, purpose); err != nil {
+		r.logger.WithError(err).WithField("user_id", userID).Error("failed to invalidate user tokens")
+		return errors.NewInternalError("failed to invalidate tokens", err)
+	}
+	return nil
+}
+
+// delete expired removes tokens past their expiry, used or not
+func (r *UserTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := r.dialect.Rebind("DELETE FROM user_tokens WHERE expires_at < CURRENT_TIMESTAMP")
+	result, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		r.logger.WithError(err).Error("failed to delete expired user tokens")
+		return 0, errors.NewInternalError("failed to delete expired tokens", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"konbi/internal/errors"
+	"konbi/internal/mail"
+	"konbi/internal/models"
+	"konbi/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// account service lets a signed-in user change their credentials or delete their account
+type AccountService struct {
+	userRepo       *repository.UserRepository
+	refreshRepo    *repository.RefreshTokenRepository
+	authService    *AuthService
+	contentService *ContentService
+	logger         *logrus.Logger
+}
+
+// create new account service
+func NewAccountService(userRepo *repository.UserRepository, refreshRepo *repository.RefreshTokenRepository, authService *AuthService, contentService *ContentService, logger *logrus.Logger) *AccountService {
+	return &AccountService{
+		userRepo:       userRepo,
+		refreshRepo:    refreshRepo,
+		authService:    authService,
+		contentService: contentService,
+		logger:         logger,
+	}
+}
+
+// change password replaces the password after checking the current one.
+// every other session is ended; the session making the request stays signed in.
+func (s *AccountService) ChangePassword(ctx context.Context, claims *models.TokenClaims, req *models.ChangePasswordRequest) error {
+	user, err := s.authenticate(ctx, claims.UserID, req.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to hash password")
+		return errors.NewInternalError("password hashing failed", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, string(hash)); err != nil {
+		return err
+	}
+
+	count, err := s.refreshRepo.RevokeOthersForUser(ctx, user.ID, claims.SessionID)
+	if err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{"user_id": user.ID, "revoked_tokens": count}).Info("password changed")
+	s.authService.sendMail(ctx, user, mail.Message{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body:    "The password of your account was just changed and your other sessions were signed out.\nIf this wasn't you, reset your password right away.\n",
+	})
+	return nil
+}
+
+// change email moves the account to a new address, which has to be verified again.
+// the old address is told about the change.
+func (s *AccountService) ChangeEmail(ctx context.Context, claims *models.TokenClaims, req *models.ChangeEmailRequest) (*models.User, error) {
+	user, err := s.authenticate(ctx, claims.UserID, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(user.Email, req.Email) {
+		return nil, errors.NewBadRequestError("new email is the same as the current one", nil)
+	}
+
+	existing, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, errors.NewConflictError("email already registered")
+	}
+
+	oldEmail := user.Email
+	if err := s.userRepo.UpdateEmail(ctx, user.ID, req.Email); err != nil {
+		return nil, err
+	}
+	user.Email = req.Email
+	user.EmailVerifiedAt = nil
+
+	s.logger.WithField("user_id", user.ID).Info("email changed")
+	s.authService.sendVerification(ctx, user)
+	s.authService.sendMail(ctx, user, mail.Message{
+		To:      oldEmail,
+		Subject: "Your email address was changed",
+		Body:    "The email address of your account was changed to " + req.Email + ".\nIf this wasn't you, contact support.\n",
+	})
+
+	return s.userRepo.GetByID(ctx, user.ID)
+}
+
+// delete account removes the user, everything they shared and all their sessions.
+// the access token making the request is revoked; other access tokens die with their short expiry.
+func (s *AccountService) DeleteAccount(ctx context.Context, claims *models.TokenClaims, password string) error {
+	user, err := s.authenticate(ctx, claims.UserID, password)
+	if err != nil {
+		return err
+	}
+
+	if err := s.deleteUser(ctx, user.ID); err != nil {
+		return err
+	}
+	return s.authService.revokeAccessToken(ctx, claims)
+}
+
+// delete user removes an account with everything it shared; also used by the admin api
+func (s *AccountService) deleteUser(ctx context.Context, userID string) error {
+	blobs, err := s.contentService.DeleteUserContent(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{"user_id": userID, "deleted_blobs": blobs}).Info("account deleted")
+	return nil
+}
+
+// enroll totp starts two-factor setup and returns the secret for the authenticator app.
+// nothing changes at login until the enrollment is activated with a code.
+func (s *AccountService) EnrollTOTP(ctx context.Context, claims *models.TokenClaims, password string) (*models.TOTPEnrollment, error) {
+	user, err := s.authenticate(ctx, claims.UserID, password)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, errors.NewConflictError("two-factor authentication is already enabled")
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, errors.NewInternalError("secret generation failed", err)
+	}
+	if err := s.userRepo.SetTOTPSecret(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithField("user_id", user.ID).Info("totp enrollment started")
+	return &models.TOTPEnrollment{
+		Secret: secret,
+		URI:    totpURI(s.authService.config.Security.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// activate totp turns two-factor authentication on once the user proves their app
+// produces valid codes, and returns the first set of recovery codes
+func (s *AccountService) ActivateTOTP(ctx context.Context, claims *models.TokenClaims, code string) (*models.RecoveryCodesResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NewNotFoundError("user not found")
+	}
+	if user.TOTPEnabledAt != nil {
+		return nil, errors.NewConflictError("two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == nil {
+		return nil, errors.NewBadRequestError("no pending two-factor enrollment", nil)
+	}
+
+	key := mfaAttemptKey(user.ID)
+	if err := s.authService.throttle.Attempt(ctx, key); err != nil {
+		return nil, err
+	}
+	step, ok := verifyTOTP(*user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, errors.NewBadRequestError("invalid code", nil)
+	}
+	s.authService.throttle.Succeed(ctx, key)
+
+	if err := s.userRepo.EnableTOTP(ctx, user.ID, step); err != nil {
+		return nil, err
+	}
+	codes, err := s.authService.issueRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithField("user_id", user.ID).Info("totp enabled")
+	s.authService.sendMail(ctx, user, mail.Message{
+		To:      user.Email,
+		Subject: "Two-factor authentication enabled",
+		Body:    "Two-factor authentication was turned on for your account.\nIf this wasn't you, reset your password right away.\n",
+	})
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// disable totp turns two-factor authentication off; needs the password and a current code
+func (s *AccountService) DisableTOTP(ctx context.Context, claims *models.TokenClaims, req *models.TOTPDisableRequest) error {
+	user, err := s.authenticate(ctx, claims.UserID, req.Password)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return errors.NewBadRequestError("two-factor authentication is not enabled", nil)
+	}
+	if err := s.authService.verifySecondFactor(ctx, user, req.Code); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.DisableTOTP(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := s.authService.recoveryRepo.DeleteForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.logger.WithField("user_id", user.ID).Info("totp disabled")
+	s.authService.sendMail(ctx, user, mail.Message{
+		To:      user.Email,
+		Subject: "Two-factor authentication disabled",
+		Body:    "Two-factor authentication was turned off for your account.\nIf this wasn't you, reset your password right away.\n",
+	})
+	return nil
+}
+
+// regenerate recovery codes replaces the user's recovery codes, invalidating the old ones
+func (s *AccountService) RegenerateRecoveryCodes(ctx context.Context, claims *models.TokenClaims, password string) (*models.RecoveryCodesResponse, error) {
+	user, err := s.authenticate(ctx, claims.UserID, password)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, errors.NewBadRequestError("two-factor authentication is not enabled", nil)
+	}
+
+	codes, err := s.authService.issueRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithField("user_id", user.ID).Info("recovery codes regenerated")
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// authenticate loads the user and checks their password before a sensitive change.
+// it shares the login throttle, so a stolen access token can't be used to guess the password.
+func (s *AccountService) authenticate(ctx context.Context, userID, password string) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NewNotFoundError("user not found")
+	}
+
+	key := loginAttemptKey(user.Email)
+	if err := s.authService.throttle.Attempt(ctx, key); err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		s.logger.WithField("user_id", user.ID).Warn("account change attempted with incorrect password")
+		return nil, errors.NewUnauthorizedError("invalid credentials")
+	}
+	s.authService.throttle.Succeed(ctx, key)
+	return user, nil
+}
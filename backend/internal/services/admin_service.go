@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/repository"
+
+	"github.com/sirupsen/logrus"
+)
+
+// admin service backs the moderation and user management endpoints of the admin api
+type AdminService struct {
+	contentRepo    *repository.ContentRepository
+	userRepo       *repository.UserRepository
+	refreshRepo    *repository.RefreshTokenRepository
+	contentService *ContentService
+	quota          *Quota
+	authService    *AuthService
+	accountService *AccountService
+	audit          *AuditLogger
+	logger         *logrus.Logger
+}
+
+// create new admin service
+func NewAdminService(contentRepo *repository.ContentRepository, userRepo *repository.UserRepository, refreshRepo *repository.RefreshTokenRepository, contentService *ContentService, quota *Quota, authService *AuthService, accountService *AccountService, audit *AuditLogger, logger *logrus.Logger) *AdminService {
+	return &AdminService{
+		contentRepo:    contentRepo,
+		userRepo:       userRepo,
+		refreshRepo:    refreshRepo,
+		contentService: contentService,
+		quota:          quota,
+		authService:    authService,
+		accountService: accountService,
+		audit:          audit,
+		logger:         logger,
+	}
+}
+
+// list content returns one page of content matching filter and the cursor of the next page,
+// empty on the last one
+func (s *AdminService) ListContent(ctx context.Context, filter *models.ContentFilter) ([]*models.Content, string, error) {
+	var cursor *models.ContentCursor
+	if filter.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(filter.Cursor)
+		if err == nil {
+			cursor = &models.ContentCursor{}
+			err = json.Unmarshal(raw, cursor)
+		}
+		if err != nil || cursor.ID == "" {
+			return nil, "", errors.NewBadRequestError("invalid cursor", err)
+		}
+	}
+
+	// one extra row tells whether another page follows
+	page := *filter
+	page.Limit = filter.Limit + 1
+	contents, err := s.contentRepo.Search(ctx, &page, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(contents) <= filter.Limit {
+		return contents, "", nil
+	}
+
+	contents = contents[:filter.Limit]
+	last := contents[len(contents)-1]
+	raw, err := json.Marshal(models.ContentCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	if err != nil {
+		return nil, "", errors.NewInternalError("failed to build cursor", err)
+	}
+	return contents, base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// delete content soft-deletes content, a bundle with its files. blobs are kept until the content
+// expires or is purged, so the deletion can be undone with RestoreContent.
+func (s *AdminService) DeleteContent(ctx context.Context, id string) (err error) {
+	defer func() { s.audit.RecordResult(ctx, models.AuditAdminContentDelete, models.AuditTargetContent, id, err) }()
+	content, err := s.contentRepo.FindAnyByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if content.DeletedAt != nil {
+		return errors.NewConflictError("content is already deleted")
+	}
+
+	if err := s.contentRepo.SetDeleted(ctx, id, true); err != nil {
+		return err
+	}
+
+	s.logger.WithField("content_id", id).Info("content deleted by admin")
+	return nil
+}
+
+// restore content undoes a soft delete. content whose owner deleted it can't come back,
+// since its blobs were removed at the time.
+func (s *AdminService) RestoreContent(ctx context.Context, id string) (err error) {
+	defer func() { s.audit.RecordResult(ctx, models.AuditAdminContentRestore, models.AuditTargetContent, id, err) }()
+	content, err := s.contentRepo.FindAnyByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if content.DeletedAt == nil {
+		return errors.NewConflictError("content is not deleted")
+	}
+
+	files := []*models.Content{content}
+	if content.Type == models.ContentTypeBundle {
+		files, err = s.contentRepo.FindAllBundleFiles(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		if f.Type != models.ContentTypeFile {
+			continue
+		}
+		exists, err := s.contentService.FileExists(ctx, f)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.NewGoneError("the stored file is gone, the content can't be restored")
+		}
+	}
+
+	if err := s.contentRepo.SetDeleted(ctx, id, false); err != nil {
+		return err
+	}
+
+	s.logger.WithField("content_id", id).Info("content restored by admin")
+	return nil
+}
+
+// purge content permanently removes content, a bundle with its files, and their blobs
+func (s *AdminService) PurgeContent(ctx context.Context, id string) (err error) {
+	defer func() { s.audit.RecordResult(ctx, models.AuditAdminContentPurge, models.AuditTargetContent, id, err) }()
+	keys, err := s.contentRepo.Purge(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		s.contentService.deleteBlob(key)
+	}
+
+	s.logger.WithField("content_id", id).Info("content purged by admin")
+	return nil
+}
+
+// list users returns a page of accounts matching filter with the total count
+func (s *AdminService) ListUsers(ctx context.Context, filter *models.UserFilter) ([]*models.User, int, error) {
+	return s.userRepo.Search(ctx, filter)
+}
+
+// get user returns an account and the storage its live shares take up, with its quota
+func (s *AdminService) GetUser(ctx context.Context, id string) (*models.User, *models.StorageUsage, error) {
+	user, err := s.authService.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, s.quota.Usage(user), nil
+}
+
+// set quota overrides an account's quota; it applies to new uploads, existing shares stay
+func (s *AdminService) SetQuota(ctx context.Context, actorID, id string, req *models.QuotaRequest) (usage *models.StorageUsage, err error) {
+	defer func() { s.audit.RecordResult(ctx, models.AuditAdminUserQuota, models.AuditTargetUser, id, err) }()
+	if err := s.userRepo.SetQuota(ctx, id, req.Bytes, req.Items); err != nil {
+		return nil, err
+	}
+	user, err := s.authService.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{"user_id": id, "actor_id": actorID}).Info("quota set by admin")
+	return s.quota.Usage(user), nil
+}
+
+// disable user blocks sign-in and every token and api key of the account; its shares stay up
+func (s *AdminService) DisableUser(ctx context.Context, actorID, id string) (err error) {
+	defer func() { s.audit.RecordResult(ctx, models.AuditAdminUserDisable, models.AuditTargetUser, id, err) }()
+	if id == actorID {
+		return errors.NewBadRequestError("you can't disable your own account", nil)
+	}
+	if err := s.userRepo.SetDisabled(ctx, id, true); err != nil {
+		return err
+	}
+	// access tokens and api keys are refused by the middleware; ending the sessions
+	// makes sure re-enabling doesn't bring them back
+	if _, err := s.refreshRepo.RevokeAllForUser(ctx, id); err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{"user_id": id, "actor_id": actorID}).Info("account disabled by admin")
+	return nil
+}
+
+// enable user lifts a disable; the user has to sign in again
+func (s *AdminService) EnableUser(ctx context.Context, actorID, id string) (err error) {
+	defer func() { s.audit.RecordResult(ctx, models.AuditAdminUserEnable, models.AuditTargetUser, id, err) }()
+	if err := s.userRepo.SetDisabled(ctx, id, false); err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{"user_id": id, "actor_id": actorID}).Info("account enabled by admin")
+	return nil
+}
+
+// force password reset invalidates the password, ends all sessions and mails a reset link
+func (s *AdminService) ForcePasswordReset(ctx context.Context, actorID, id string) (err error) {
+	defer func() { s.audit.RecordResult(ctx, models.AuditAdminUserReset, models.AuditTargetUser, id, err) }()
+	if err := s.authService.ForcePasswordReset(ctx, id); err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{"user_id": id, "actor_id": actorID}).Info("password reset forced by admin")
+	return nil
+}
+
+// delete user removes an account with everything it shared
+func (s *AdminService) DeleteUser(ctx context.Context, actorID, id string) (err error) {
+	defer func() { s.audit.RecordResult(ctx, models.AuditAdminUserDelete, models.AuditTargetUser, id, err) }()
+	if id == actorID {
+		return errors.NewBadRequestError("delete your own account through /api/account", nil)
+	}
+	if _, err := s.authService.GetUserByID(ctx, id); err != nil {
+		return err
+	}
+	if err := s.accountService.deleteUser(ctx, id); err != nil {
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{"user_id": id, "actor_id": actorID}).Info("account deleted by admin")
+	return nil
+}
+
+// list audit returns a page of audit events matching filter, newest first, with the total count
+func (s *AdminService) ListAudit(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, int, error) {
+	return s.audit.Search(ctx, filter)
+}
+
+// bulk applies action to every id and reports the outcome of each; one failure doesn't stop the rest
+func (s *AdminService) Bulk(ctx context.Context, ids []string, action func(context.Context, string) error) *models.BulkResult {
+	result := &models.BulkResult{
+		Succeeded: []string{},
+		Failed:    map[string]string{},
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if err := action(ctx, id); err != nil {
+			message := "internal server error"
+			if appErr, ok := err.(*errors.AppError); ok {
+				message = appErr.Message
+			}
+			result.Failed[id] = message
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, id)
+	}
+	return result
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// api keys look like "konbi_<prefix>_<secret>"
+const apiKeyPrefix = "konbi_"
+
+// last use is recorded at most this often per key, so busy keys don't write on every request
+const apiKeyTouchInterval = time.Minute
+
+// api key service manages personal api keys and authenticates requests made with them
+type APIKeyService struct {
+	repo   *repository.APIKeyRepository
+	logger *logrus.Logger
+}
+
+// create new api key service
+func NewAPIKeyService(repo *repository.APIKeyRepository, logger *logrus.Logger) *APIKeyService {
+	return &APIKeyService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// is api key reports whether a bearer token is an api key rather than a jwt
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// create generates a new key for a user and returns it in full, the only time it is available
+func (s *APIKeyService) Create(ctx context.Context, userID string, req *models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixBytes := make([]byte, 6)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return nil, errors.NewInternalError("key generation failed", err)
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, errors.NewInternalError("key generation failed", err)
+	}
+	prefix := hex.EncodeToString(prefixBytes)
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	now := time.Now().UTC()
+	key := &models.APIKey{
+		ID:         generateID(),
+		UserID:     userID,
+		Name:       strings.TrimSpace(req.Name),
+		Prefix:     prefix,
+		SecretHash: hashToken(secret),
+		Scopes:     scopes,
+		CreatedAt:  now,
+	}
+	if req.ExpiresInDays != nil {
+		expiresAt := now.Add(time.Duration(*req.ExpiresInDays) * 24 * time.Hour)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.Create(ctx, key); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{"user_id": userID, "api_key_id": key.ID}).Info("api key created")
+	return &models.CreateAPIKeyResponse{
+		Key:    apiKeyPrefix + prefix + "_" + secret,
+		APIKey: key,
+	}, nil
+}
+
+// list returns a user's live keys
+func (s *APIKeyService) List(ctx context.Context, userID string) ([]*models.APIKey, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+// revoke disables one of a user's keys immediately
+func (s *APIKeyService) Revoke(ctx context.Context, userID, id string) error {
+	revoked, err := s.repo.Revoke(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errors.NewNotFoundError("api key not found")
+	}
+	s.logger.WithFields(logrus.Fields{"user_id": userID, "api_key_id": id}).Info("api key revoked")
+	return nil
+}
+
+// authenticate checks an api key and returns it if it is live
+func (s *APIKeyService) Authenticate(ctx context.Context, token string) (*models.APIKey, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(token, apiKeyPrefix), "_")
+	if !ok || prefix == "" || secret == "" {
+		return nil, errors.NewUnauthorizedError("invalid api key")
+	}
+
+	key, err := s.repo.FindByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, errors.NewUnauthorizedError("invalid api key")
+	}
+	if key.RevokedAt != nil {
+		return nil, errors.NewUnauthorizedError("api key has been revoked")
+	}
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
+		return nil, errors.NewUnauthorizedError("api key has expired")
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.repo.Touch(ctx, key.ID); err != nil {
+			s.logger.WithError(err).WithField("api_key_id", key.ID).Warn("failed to record api key use")
+		}
+	}
+
+	return key, nil
+}
+
+// normalize scopes validates requested scopes, dropping duplicates; none means all
+func normalizeScopes(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return append([]string(nil), models.APIKeyScopes...), nil
+	}
+
+	seen := map[string]bool{}
+	var scopes []string
+	for _, scope := range requested {
+		known := false
+		for _, s := range models.APIKeyScopes {
+			if s == scope {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, errors.NewBadRequestError("unknown scope: "+scope, nil)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
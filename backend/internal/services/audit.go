@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"konbi/internal/config"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/repository"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// request info key is the context key of the *models.RequestInfo attached by the logger middleware
+type requestInfoKey struct{}
+
+// with request info returns a copy of ctx carrying info
+func WithRequestInfo(ctx context.Context, info *models.RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// request info from returns the request info attached to ctx, or nil outside a request
+func RequestInfoFrom(ctx context.Context) *models.RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*models.RequestInfo)
+	return info
+}
+
+// audit logger records security-relevant events. the actor is taken from the request
+// info in the context, so callers only describe what happened and to what.
+type AuditLogger struct {
+	repo   *repository.AuditRepository
+	config *config.Config
+	logger *logrus.Logger
+}
+
+// create new audit logger
+func NewAuditLogger(repo *repository.AuditRepository, cfg *config.Config, logger *logrus.Logger) *AuditLogger {
+	return &AuditLogger{
+		repo:   repo,
+		config: cfg,
+		logger: logger,
+	}
+}
+
+// record writes an event. a failed write is logged rather than returned: losing an audit
+// entry must not fail the request it describes.
+func (a *AuditLogger) Record(ctx context.Context, action, outcome, targetType, targetID, detail string) {
+	event := &models.AuditEvent{
+		ID:         generateID(),
+		CreatedAt:  time.Now().UTC(),
+		ActorType:  models.AuditActorSystem,
+		Action:     action,
+		TargetType: optionalString(targetType),
+		TargetID:   optionalString(targetID),
+		Outcome:    outcome,
+		Detail:     optionalString(detail),
+	}
+	if info := RequestInfoFrom(ctx); info != nil {
+		event.RequestID = info.RequestID
+		event.ActorType = info.ActorType
+		event.ActorID = optionalString(info.UserID)
+		event.ActorRole = optionalString(info.Role)
+		event.ActorIP = info.IP
+	}
+
+	// the request may already be cancelled or timed out; the entry is still wanted
+	if err := a.repo.Create(context.WithoutCancel(ctx), event); err != nil {
+		a.logger.WithError(err).WithFields(logrus.Fields{
+			"action":     action,
+			"outcome":    outcome,
+			"request_id": event.RequestID,
+		}).Error("failed to record audit event")
+	}
+}
+
+// record result records action with the outcome err implies, and its message as detail
+func (a *AuditLogger) RecordResult(ctx context.Context, action, targetType, targetID string, err error) {
+	if err == nil {
+		a.Record(ctx, action, models.AuditSuccess, targetType, targetID, "")
+		return
+	}
+	a.Record(ctx, action, auditOutcome(err), targetType, targetID, auditDetail(err))
+}
+
+// search returns one page of events matching filter and the total number of matches
+func (a *AuditLogger) Search(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, int, error) {
+	return a.repo.Search(ctx, filter)
+}
+
+// prune removes events older than the retention period; a retention of zero keeps everything
+func (a *AuditLogger) Prune(ctx context.Context) (int64, error) {
+	if a.config.Security.AuditRetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -a.config.Security.AuditRetentionDays)
+	return a.repo.DeleteBefore(ctx, cutoff)
+}
+
+// audit outcome classifies err: refusals by policy are denied, everything else failed
+func auditOutcome(err error) string {
+	if appErr, ok := err.(*errors.AppError); ok {
+		switch appErr.StatusCode {
+		case http.StatusForbidden, http.StatusTooManyRequests:
+			return models.AuditDenied
+		}
+	}
+	return models.AuditFailure
+}
+
+// audit detail is the client-facing message of err; internal errors stay out of the log table
+func auditDetail(err error) string {
+	if appErr, ok := err.(*errors.AppError); ok && appErr.StatusCode < http.StatusInternalServerError {
+		return appErr.Message
+	}
+	return "internal error"
+}
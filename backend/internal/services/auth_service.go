@@ -3,12 +3,17 @@ package services
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"konbi/internal/config"
 	"konbi/internal/errors"
+	"konbi/internal/mail"
 	"konbi/internal/models"
 	"konbi/internal/repository"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -18,22 +23,38 @@ import (
 
 // auth service handles authentication operations
 type AuthService struct {
-	userRepo *repository.UserRepository
-	config   *config.Config
-	logger   *logrus.Logger
+	userRepo      *repository.UserRepository
+	refreshRepo   *repository.RefreshTokenRepository
+	userTokenRepo *repository.UserTokenRepository
+	recoveryRepo  *repository.RecoveryCodeRepository
+	revocations   RevocationStore
+	keys          *SigningKeys
+	throttle      *Throttle
+	mailer        mail.Mailer
+	audit         *AuditLogger
+	config        *config.Config
+	logger        *logrus.Logger
 }
 
 // create new auth service
-func NewAuthService(userRepo *repository.UserRepository, cfg *config.Config, logger *logrus.Logger) *AuthService {
+func NewAuthService(userRepo *repository.UserRepository, refreshRepo *repository.RefreshTokenRepository, userTokenRepo *repository.UserTokenRepository, recoveryRepo *repository.RecoveryCodeRepository, revocations RevocationStore, keys *SigningKeys, throttle *Throttle, mailer mail.Mailer, audit *AuditLogger, cfg *config.Config, logger *logrus.Logger) *AuthService {
 	return &AuthService{
-		userRepo: userRepo,
-		config:   cfg,
-		logger:   logger,
+		userRepo:      userRepo,
+		refreshRepo:   refreshRepo,
+		userTokenRepo: userTokenRepo,
+		recoveryRepo:  recoveryRepo,
+		revocations:   revocations,
+		keys:          keys,
+		throttle:      throttle,
+		mailer:        mailer,
+		audit:         audit,
+		config:        cfg,
+		logger:        logger,
 	}
 }
 
 // register creates new user account
-func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest) (*models.AuthResponse, error) {
+func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest, client models.ClientInfo) (*models.AuthResponse, error) {
 	// check if email already exists
 	existing, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err == nil && existing != nil {
@@ -66,13 +87,35 @@ func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest)
 	}
 
 	s.logger.WithField("user_id", id).Info("user registered successfully")
+	s.audit.Record(ctx, models.AuditRegister, models.AuditSuccess, models.AuditTargetUser, id, "")
+
+	s.sendVerification(ctx, user)
+
+	// when verification is required the account can't be used until the link is followed
+	if s.config.Security.RequireEmailVerification {
+		return &models.AuthResponse{
+			User: &models.User{
+				ID:        user.ID,
+				Email:     user.Email,
+				Role:      user.Role,
+				CreatedAt: user.CreatedAt,
+			},
+		}, nil
+	}
 
-	// generate tokens
-	return s.generateAuthResponse(user)
+	// start a new session
+	return s.startSession(ctx, user, client)
 }
 
-// login authenticates user and returns tokens
-func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest) (*models.AuthResponse, error) {
+// login authenticates user and returns tokens.
+// failures are throttled per email, whether or not the account exists.
+func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest, client models.ClientInfo) (*models.AuthResponse, error) {
+	key := loginAttemptKey(req.Email)
+	if err := s.throttle.Attempt(ctx, key); err != nil {
+		s.audit.Record(ctx, models.AuditLogin, models.AuditDenied, "", "", "locked out: "+req.Email)
+		return nil, err
+	}
+
 	// get user by email
 	user, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
@@ -82,97 +125,476 @@ func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest) (*mod
 
 	if user == nil {
 		s.logger.WithField("email", req.Email).Warn("login attempted with non-existent email")
+		s.audit.Record(ctx, models.AuditLogin, models.AuditFailure, "", "", "unknown email: "+req.Email)
 		return nil, errors.NewUnauthorizedError("invalid credentials")
 	}
 
 	// verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 		s.logger.WithField("user_id", user.ID).Warn("login failed with incorrect password")
+		s.audit.Record(ctx, models.AuditLogin, models.AuditFailure, models.AuditTargetUser, user.ID, "incorrect password")
 		return nil, errors.NewUnauthorizedError("invalid credentials")
 	}
+	s.throttle.Succeed(ctx, key)
+
+	if err := s.checkActive(user); err != nil {
+		s.audit.RecordResult(ctx, models.AuditLogin, models.AuditTargetUser, user.ID, err)
+		return nil, err
+	}
+
+	if s.config.Security.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		s.logger.WithField("user_id", user.ID).Warn("login attempted before email verification")
+		err := errors.NewForbiddenError("email not verified")
+		s.audit.RecordResult(ctx, models.AuditLogin, models.AuditTargetUser, user.ID, err)
+		return nil, err
+	}
+
+	// with two-factor authentication the password only earns a challenge
+	if user.TOTPEnabledAt != nil {
+		s.logger.WithField("user_id", user.ID).Info("password accepted, second factor required")
+		s.audit.Record(ctx, models.AuditLogin, models.AuditSuccess, models.AuditTargetUser, user.ID, "second factor required")
+		return s.mfaChallenge(user)
+	}
 
 	s.logger.WithField("user_id", user.ID).Info("user logged in successfully")
+	s.audit.Record(ctx, models.AuditLogin, models.AuditSuccess, models.AuditTargetUser, user.ID, "")
 
-	// generate tokens
-	return s.generateAuthResponse(user)
+	// start a new session
+	return s.startSession(ctx, user, client)
 }
 
-// verify access token and extract claims
-func (s *AuthService) VerifyAccessToken(tokenString string) (*models.TokenClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.config.Server.JWTSecret), nil
+// complete mfa login exchanges a login challenge and a TOTP or recovery code for tokens.
+// a challenge works once; it is revoked as soon as a session is started with it.
+func (s *AuthService) CompleteMFALogin(ctx context.Context, req *models.MFALoginRequest, client models.ClientInfo) (*models.AuthResponse, error) {
+	claims, err := s.parseToken(s.keys.Access, req.MFAToken, models.TokenTypeMFA)
+	if err != nil {
+		return nil, errors.NewUnauthorizedError("invalid or expired challenge")
+	}
+	revoked, err := s.revocations.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errors.NewUnauthorizedError("invalid or expired challenge")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.TOTPEnabledAt == nil || s.checkTokenCutoff(user, claims.IssuedAt.Time) != nil {
+		return nil, errors.NewUnauthorizedError("invalid or expired challenge")
+	}
+	if err := s.checkActive(user); err != nil {
+		s.audit.RecordResult(ctx, models.AuditLoginMFA, models.AuditTargetUser, user.ID, err)
+		return nil, err
+	}
+
+	if err := s.verifySecondFactor(ctx, user, req.Code); err != nil {
+		s.audit.RecordResult(ctx, models.AuditLoginMFA, models.AuditTargetUser, user.ID, err)
+		return nil, err
+	}
+	if err := s.revocations.Revoke(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithField("user_id", user.ID).Info("user logged in successfully with second factor")
+	s.audit.Record(ctx, models.AuditLoginMFA, models.AuditSuccess, models.AuditTargetUser, user.ID, "")
+	return s.startSession(ctx, user, client)
+}
+
+// verify email consumes a verification token and marks the address it was sent to as verified
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	record, err := s.userTokenRepo.Consume(ctx, models.UserTokenVerifyEmail, hashToken(token))
+	if err != nil {
+		return err
+	}
+	if record == nil || record.Email == nil {
+		return errors.NewBadRequestError("invalid or expired token", nil)
+	}
+
+	verified, err := s.userRepo.MarkEmailVerified(ctx, record.UserID, *record.Email)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		// the account's address changed after the link was sent
+		return errors.NewBadRequestError("invalid or expired token", nil)
+	}
+
+	s.logger.WithField("user_id", record.UserID).Info("email verified")
+	return nil
+}
+
+// resend verification mails a fresh verification link.
+// it succeeds whether or not the address belongs to an unverified account, so it can't be used to probe for accounts.
+func (s *AuthService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	s.sendVerification(ctx, user)
+	return nil
+}
+
+// forgot password mails a password reset link.
+// like resend verification it reports success for unknown addresses.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		s.logger.WithField("email", email).Warn("password reset requested for non-existent email")
+		return nil
+	}
+
+	return s.sendPasswordReset(ctx, user, "Someone asked to reset the password of your account.",
+		"If you didn't ask for this, ignore this email.")
+}
+
+// force password reset is the admin variant of ForgotPassword: the current password stops
+// working and every session ends, access tokens included, so the user has to follow the
+// mailed link to get back in
+func (s *AuthService) ForcePasswordReset(ctx context.Context, userID string) error {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// no bcrypt hash matches an empty string, so password logins fail until the reset
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, ""); err != nil {
+		return err
+	}
+	if _, err := s.refreshRepo.RevokeAllForUser(ctx, user.ID); err != nil {
+		return err
+	}
+	// iat only has whole seconds, so the cutoff does too; tokens from this very second are refused with the rest
+	if err := s.userRepo.InvalidateTokens(ctx, user.ID, time.Now().UTC().Truncate(time.Second)); err != nil {
+		return err
+	}
+
+	s.logger.WithField("user_id", user.ID).Info("password reset forced")
+	return s.sendPasswordReset(ctx, user, "An administrator has reset the password of your account.",
+		"Until you do, you can't sign in with a password.")
+}
+
+// ensure active rejects requests on behalf of a deleted or disabled account, and access tokens
+// issued before the account's tokens were invalidated; the token middleware calls it so either
+// takes effect before the tokens expire. issuedAt is zero for api keys, which the cutoff spares.
+func (s *AuthService) EnsureActive(ctx context.Context, userID string, issuedAt time.Time) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return errors.NewUnauthorizedError("account not found")
+	}
+	if err := s.checkActive(user); err != nil {
+		return err
+	}
+	if !issuedAt.IsZero() {
+		return s.checkTokenCutoff(user, issuedAt)
+	}
+	return nil
+}
+
+// check active refuses disabled accounts
+func (s *AuthService) checkActive(user *models.User) error {
+	if user.DisabledAt != nil {
+		s.logger.WithField("user_id", user.ID).Warn("disabled account refused")
+		return errors.NewForbiddenError("account disabled")
+	}
+	return nil
+}
+
+// check token cutoff refuses a token issued at or before the user's tokens were invalidated
+func (s *AuthService) checkTokenCutoff(user *models.User, issuedAt time.Time) error {
+	if user.TokensValidAfter != nil && !issuedAt.After(*user.TokensValidAfter) {
+		s.logger.WithField("user_id", user.ID).Warn("token issued before invalidation refused")
+		return errors.NewUnauthorizedError("token has been revoked")
+	}
+	return nil
+}
+
+// send password reset mails a reset link; intro and outro frame it for the situation
+func (s *AuthService) sendPasswordReset(ctx context.Context, user *models.User, intro, outro string) error {
+	token, err := s.createUserToken(ctx, user, models.UserTokenResetPassword, s.config.Security.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(ctx, user, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: intro + "\n\n" +
+			"Follow this link to choose a new password:\n\n" +
+			s.appLink("/reset", token) + "\n\n" +
+			fmt.Sprintf("The link expires in %s. %s\n", s.config.Security.PasswordResetTTL, outro),
 	})
+	return nil
+}
 
+// reset password consumes a reset token and sets a new password.
+// every session of the user is ended, access tokens included, since whoever knew the old
+// password may hold one.
+func (s *AuthService) ResetPassword(ctx context.Context, token, password string) error {
+	record, err := s.userTokenRepo.Consume(ctx, models.UserTokenResetPassword, hashToken(token))
 	if err != nil {
-		return nil, errors.NewUnauthorizedError("invalid token")
+		return err
+	}
+	if record == nil {
+		s.audit.Record(ctx, models.AuditPasswordReset, models.AuditFailure, "", "", "invalid or expired token")
+		return errors.NewBadRequestError("invalid or expired token", nil)
 	}
 
-	claims, ok := token.Claims.(*jwt.MapClaims)
-	if !ok || !token.Valid {
-		return nil, errors.NewUnauthorizedError("invalid token claims")
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to hash password")
+		return errors.NewInternalError("password hashing failed", err)
 	}
 
-	userID, ok := (*claims)["user_id"].(string)
-	if !ok {
-		return nil, errors.NewUnauthorizedError("invalid user id in token")
+	if err := s.userRepo.UpdatePassword(ctx, record.UserID, string(hash)); err != nil {
+		return err
+	}
+	if err := s.userTokenRepo.InvalidateForUser(ctx, record.UserID, models.UserTokenResetPassword); err != nil {
+		return err
+	}
+	if _, err := s.refreshRepo.RevokeAllForUser(ctx, record.UserID); err != nil {
+		return err
 	}
+	// like a forced reset, the cutoff has whole seconds and refuses tokens from this second too
+	if err := s.userRepo.InvalidateTokens(ctx, record.UserID, time.Now().UTC().Truncate(time.Second)); err != nil {
+		return err
+	}
+
+	s.logger.WithField("user_id", record.UserID).Info("password reset")
+	s.audit.Record(ctx, models.AuditPasswordReset, models.AuditSuccess, models.AuditTargetUser, record.UserID, "")
+	return nil
+}
 
-	email, ok := (*claims)["email"].(string)
-	if !ok {
-		return nil, errors.NewUnauthorizedError("invalid email in token")
+// verify second factor accepts a current TOTP code or an unused recovery code.
+// failures share a throttle per user, so codes can't be guessed.
+func (s *AuthService) verifySecondFactor(ctx context.Context, user *models.User, code string) error {
+	key := mfaAttemptKey(user.ID)
+	if err := s.throttle.Attempt(ctx, key); err != nil {
+		return err
 	}
 
-	return &models.TokenClaims{
-		UserID: userID,
-		Email:  email,
-	}, nil
+	if user.TOTPSecret != nil {
+		if step, ok := verifyTOTP(*user.TOTPSecret, code, time.Now()); ok {
+			fresh, err := s.userRepo.UseTOTPStep(ctx, user.ID, step)
+			if err != nil {
+				return err
+			}
+			if fresh {
+				s.throttle.Succeed(ctx, key)
+				return nil
+			}
+			s.logger.WithField("user_id", user.ID).Warn("totp code replayed")
+		}
+	}
+
+	used, err := s.recoveryRepo.Consume(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if used {
+		s.logger.WithField("user_id", user.ID).Info("recovery code used")
+		s.throttle.Succeed(ctx, key)
+		return nil
+	}
+
+	s.logger.WithField("user_id", user.ID).Warn("invalid second factor code")
+	return errors.NewUnauthorizedError("invalid code")
 }
 
-// verify refresh token and return new access token
-func (s *AuthService) RefreshAccessToken(ctx context.Context, refreshToken string) (string, error) {
-	// parse refresh token (same verification, different purpose)
-	token, err := jwt.ParseWithClaims(refreshToken, &jwt.MapClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// issue recovery codes replaces the user's recovery codes and returns the new ones in plain text
+func (s *AuthService) issueRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	const count = 10
+
+	now := time.Now().UTC()
+	plain := make([]string, 0, count)
+	records := make([]*models.RecoveryCode, 0, count)
+	for i := 0; i < count; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, errors.NewInternalError("code generation failed", err)
 		}
-		return []byte(s.config.Server.JWTRefreshSecret), nil
-	})
+		plain = append(plain, code)
+		records = append(records, &models.RecoveryCode{
+			ID:        generateID(),
+			UserID:    userID,
+			CodeHash:  hashToken(code),
+			CreatedAt: now,
+		})
+	}
+
+	if err := s.recoveryRepo.ReplaceForUser(ctx, userID, records); err != nil {
+		return nil, err
+	}
+	return plain, nil
+}
 
+// verify access token checks signature, expiry, issuer, audience and type, and returns the claims.
+// revocation is checked separately against the revocation store.
+func (s *AuthService) VerifyAccessToken(tokenString string) (*models.TokenClaims, error) {
+	claims, err := s.parseToken(s.keys.Access, tokenString, models.TokenTypeAccess)
 	if err != nil {
-		return "", errors.NewUnauthorizedError("invalid refresh token")
+		return nil, errors.NewUnauthorizedError("invalid token")
 	}
+	return claims, nil
+}
 
-	claims, ok := token.Claims.(*jwt.MapClaims)
-	if !ok || !token.Valid {
-		return "", errors.NewUnauthorizedError("invalid refresh token claims")
+// refresh exchanges a refresh token for a new access and refresh token pair.
+// each refresh token works once; presenting one that was already rotated means it
+// leaked, so the whole session is revoked.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string, client models.ClientInfo) (*models.AuthResponse, error) {
+	claims, err := s.parseToken(s.keys.Refresh, refreshToken, models.TokenTypeRefresh)
+	if err != nil {
+		return nil, errors.NewUnauthorizedError("invalid refresh token")
 	}
 
-	userID, ok := (*claims)["user_id"].(string)
-	if !ok {
-		return "", errors.NewUnauthorizedError("invalid user id in refresh token")
+	record, err := s.refreshRepo.FindByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || record.ID != claims.ID || record.RevokedAt != nil {
+		return nil, errors.NewUnauthorizedError("refresh token revoked")
+	}
+
+	rotated, err := s.refreshRepo.MarkRotated(ctx, record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		s.logger.WithFields(logrus.Fields{
+			"user_id":    record.UserID,
+			"session_id": record.FamilyID,
+		}).Warn("refresh token reuse detected, revoking session")
+		if _, err := s.refreshRepo.RevokeFamily(ctx, record.UserID, record.FamilyID); err != nil {
+			return nil, err
+		}
+		s.audit.Record(ctx, models.AuditRefreshReuse, models.AuditDenied, models.AuditTargetUser, record.UserID, "session "+record.FamilyID+" revoked")
+		return nil, errors.NewUnauthorizedError("refresh token revoked")
 	}
 
 	// get user to ensure still exists
-	user, err := s.userRepo.GetByID(ctx, userID)
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
 	if err != nil {
 		s.logger.WithError(err).Error("failed to get user for refresh")
-		return "", errors.NewInternalError("token refresh failed", err)
+		return nil, errors.NewInternalError("token refresh failed", err)
 	}
 
 	if user == nil {
-		return "", errors.NewUnauthorizedError("user not found")
+		return nil, errors.NewUnauthorizedError("user not found")
+	}
+	if err := s.checkActive(user); err != nil {
+		return nil, err
 	}
 
-	// generate new access token
-	accessToken, err := s.generateAccessToken(user)
+	return s.issueTokens(ctx, user, record.FamilyID, record.SessionStartedAt, client)
+}
+
+// logout ends the session the access token belongs to and revokes the access token itself
+func (s *AuthService) Logout(ctx context.Context, claims *models.TokenClaims) error {
+	if _, err := s.refreshRepo.RevokeFamily(ctx, claims.UserID, claims.SessionID); err != nil {
+		return err
+	}
+	if err := s.revokeAccessToken(ctx, claims); err != nil {
+		return err
+	}
+	s.logger.WithFields(logrus.Fields{"user_id": claims.UserID, "session_id": claims.SessionID}).Info("user logged out")
+	s.audit.Record(ctx, models.AuditLogout, models.AuditSuccess, models.AuditTargetUser, claims.UserID, "")
+	return nil
+}
+
+// list sessions returns the user's live sessions, marking the one making the request
+func (s *AuthService) ListSessions(ctx context.Context, userID, currentSessionID string) ([]*models.Session, error) {
+	tokens, err := s.refreshRepo.ListActiveByUser(ctx, userID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	sessions := make([]*models.Session, 0, len(tokens))
+	for _, t := range tokens {
+		sessions = append(sessions, &models.Session{
+			ID:         t.FamilyID,
+			UserAgent:  t.UserAgent,
+			IPAddress:  t.IPAddress,
+			CreatedAt:  t.SessionStartedAt,
+			LastUsedAt: t.CreatedAt,
+			ExpiresAt:  t.ExpiresAt,
+			Current:    t.FamilyID == currentSessionID,
+		})
+	}
+	return sessions, nil
+}
+
+// revoke session ends one of the user's sessions; ending the current one also revokes the caller's access token
+func (s *AuthService) RevokeSession(ctx context.Context, claims *models.TokenClaims, sessionID string) error {
+	revoked, err := s.refreshRepo.RevokeFamily(ctx, claims.UserID, sessionID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errors.NewNotFoundError("session not found")
+	}
+	if sessionID == claims.SessionID {
+		if err := s.revokeAccessToken(ctx, claims); err != nil {
+			return err
+		}
 	}
+	s.logger.WithFields(logrus.Fields{"user_id": claims.UserID, "session_id": sessionID}).Info("session revoked")
+	return nil
+}
 
-	return accessToken, nil
+// revoke all sessions logs the user out everywhere, including the caller's access token
+func (s *AuthService) RevokeAllSessions(ctx context.Context, claims *models.TokenClaims) error {
+	count, err := s.refreshRepo.RevokeAllForUser(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.revokeAccessToken(ctx, claims); err != nil {
+		return err
+	}
+	s.logger.WithFields(logrus.Fields{"user_id": claims.UserID, "revoked_tokens": count}).Info("all sessions revoked")
+	return nil
+}
+
+// revoke access token puts the token's jti in the revocation store until it would expire anyway
+func (s *AuthService) revokeAccessToken(ctx context.Context, claims *models.TokenClaims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	return s.revocations.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// cleanup expired removes refresh tokens and mailed tokens that can no longer be used
+func (s *AuthService) CleanupExpired(ctx context.Context) (int64, error) {
+	refreshCount, err := s.refreshRepo.DeleteExpired(ctx)
+	if err != nil {
+		return 0, err
+	}
+	userTokenCount, err := s.userTokenRepo.DeleteExpired(ctx)
+	if err != nil {
+		return refreshCount, err
+	}
+	return refreshCount + userTokenCount, nil
+}
+
+// prune revocations drops revoked access token ids whose tokens have expired
+func (s *AuthService) PruneRevocations(ctx context.Context) (int64, error) {
+	return s.revocations.Prune(ctx)
+}
+
+// jwks returns the public keys other services can verify access tokens with
+func (s *AuthService) JWKS() []JWK {
+	return s.keys.Access.JWKS()
 }
 
 // get user by id retrieves full user profile from DB
@@ -187,41 +609,136 @@ func (s *AuthService) GetUserByID(ctx context.Context, id string) (*models.User,
 	return user, nil
 }
 
-// private helper to generate tokens
-func (s *AuthService) generateAuthResponse(user *models.User) (*models.AuthResponse, error) {
-	accessToken, err := s.generateAccessToken(user)
+// send verification mails a link that confirms the user's current address.
+// earlier links stop working so only the latest one can be used.
+func (s *AuthService) sendVerification(ctx context.Context, user *models.User) {
+	if err := s.userTokenRepo.InvalidateForUser(ctx, user.ID, models.UserTokenVerifyEmail); err != nil {
+		return
+	}
+	token, err := s.createUserToken(ctx, user, models.UserTokenVerifyEmail, s.config.Security.EmailVerificationTTL)
+	if err != nil {
+		return
+	}
+
+	s.sendMail(ctx, user, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Follow this link to verify your email address:\n\n" +
+			s.appLink("/verify", token) + "\n\n" +
+			fmt.Sprintf("The link expires in %s.\n", s.config.Security.EmailVerificationTTL),
+	})
+}
+
+// create user token stores the hash of a new single-use token and returns the token itself
+func (s *AuthService) createUserToken(ctx context.Context, user *models.User, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.NewInternalError("token generation failed", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now().UTC()
+	record := &models.UserToken{
+		ID:        generateID(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if purpose == models.UserTokenVerifyEmail {
+		record.Email = &user.Email
+	}
+
+	if err := s.userTokenRepo.Create(ctx, record); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// send mail delivers msg; a failure is logged but never fails the request,
+// so mail problems don't reveal whether an account exists
+func (s *AuthService) sendMail(ctx context.Context, user *models.User, msg mail.Message) {
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		s.logger.WithError(err).WithField("user_id", user.ID).Error("failed to send email")
+	}
+}
+
+// app link builds a link into the frontend carrying a token
+func (s *AuthService) appLink(path, token string) string {
+	return strings.TrimRight(s.config.Mail.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// mfa challenge signs a short-lived token that only /api/auth/login/mfa accepts
+func (s *AuthService) mfaChallenge(user *models.User) (*models.AuthResponse, error) {
+	now := time.Now().UTC()
+	claims := s.newClaims(user, models.TokenTypeMFA, "", generateID(), now, now.Add(s.config.Security.MFAChallengeTTL))
+
+	token, err := s.keys.Access.Sign(claims)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to sign mfa challenge")
+		return nil, errors.NewInternalError("token generation failed", err)
+	}
+
+	return &models.AuthResponse{
+		MFARequired: true,
+		MFAToken:    token,
+	}, nil
+}
+
+// start session issues the first token pair of a new session
+func (s *AuthService) startSession(ctx context.Context, user *models.User, client models.ClientInfo) (*models.AuthResponse, error) {
+	return s.issueTokens(ctx, user, generateID(), time.Now().UTC(), client)
+}
+
+// issue tokens creates an access token and a stored refresh token for a session
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, sessionID string, startedAt time.Time, client models.ClientInfo) (*models.AuthResponse, error) {
+	accessToken, err := s.generateAccessToken(user, sessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := s.generateRefreshToken(user)
+	now := time.Now().UTC()
+	record := &models.RefreshToken{
+		ID:               generateID(),
+		FamilyID:         sessionID,
+		UserID:           user.ID,
+		UserAgent:        optionalString(client.UserAgent),
+		IPAddress:        optionalString(client.IPAddress),
+		SessionStartedAt: startedAt,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(s.config.Server.JWTRefreshExpiry),
+	}
+
+	refreshToken, err := s.generateRefreshToken(user, record)
 	if err != nil {
 		return nil, err
 	}
 
+	record.TokenHash = hashToken(refreshToken)
+	if err := s.refreshRepo.Create(ctx, record); err != nil {
+		return nil, err
+	}
+
 	return &models.AuthResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 		ExpiresIn:    int(s.config.Server.JWTExpiry.Seconds()),
-		User: models.User{
+		User: &models.User{
 			ID:        user.ID,
 			Email:     user.Email,
+			Role:      user.Role,
 			CreatedAt: user.CreatedAt,
 		},
 	}, nil
 }
 
 // generate access token
-func (s *AuthService) generateAccessToken(user *models.User) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"exp":     time.Now().UTC().Add(s.config.Server.JWTExpiry).Unix(),
-		"iat":     time.Now().UTC().Unix(),
-	}
+func (s *AuthService) generateAccessToken(user *models.User, sessionID string) (string, error) {
+	now := time.Now().UTC()
+	claims := s.newClaims(user, models.TokenTypeAccess, sessionID, generateID(), now, now.Add(s.config.Server.JWTExpiry))
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.config.Server.JWTSecret))
+	tokenString, err := s.keys.Access.Sign(claims)
 	if err != nil {
 		s.logger.WithError(err).Error("failed to sign access token")
 		return "", errors.NewInternalError("token generation failed", err)
@@ -230,17 +747,11 @@ func (s *AuthService) generateAccessToken(user *models.User) (string, error) {
 	return tokenString, nil
 }
 
-// generate refresh token
-func (s *AuthService) generateRefreshToken(user *models.User) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"exp":     time.Now().UTC().Add(s.config.Server.JWTRefreshExpiry).Unix(),
-		"iat":     time.Now().UTC().Unix(),
-	}
+// generate refresh token signs the token for a refresh token record; its jti is the record id
+func (s *AuthService) generateRefreshToken(user *models.User, record *models.RefreshToken) (string, error) {
+	claims := s.newClaims(user, models.TokenTypeRefresh, record.FamilyID, record.ID, record.CreatedAt, record.ExpiresAt)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.config.Server.JWTRefreshSecret))
+	tokenString, err := s.keys.Refresh.Sign(claims)
 	if err != nil {
 		s.logger.WithError(err).Error("failed to sign refresh token")
 		return "", errors.NewInternalError("token generation failed", err)
@@ -249,6 +760,60 @@ func (s *AuthService) generateRefreshToken(user *models.User) (string, error) {
 	return tokenString, nil
 }
 
+// new claims builds the claims shared by access and refresh tokens
+func (s *AuthService) newClaims(user *models.User, tokenType, sessionID, jti string, issuedAt, expiresAt time.Time) *models.TokenClaims {
+	return &models.TokenClaims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		SessionID: sessionID,
+		Type:      tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   user.ID,
+			Issuer:    s.config.Server.JWTIssuer,
+			Audience:  jwt.ClaimStrings{s.config.Server.JWTAudience},
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+}
+
+// parse token verifies a token against keys and checks it is of the wanted type.
+// an access token is never accepted as a refresh token or the other way round.
+func (s *AuthService) parseToken(keys *KeySet, tokenString, tokenType string) (*models.TokenClaims, error) {
+	claims := &models.TokenClaims{}
+	err := keys.Parse(tokenString, claims,
+		jwt.WithIssuer(s.config.Server.JWTIssuer),
+		jwt.WithAudience(s.config.Server.JWTAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("expected %s token, got %q", tokenType, claims.Type)
+	}
+	if claims.ID == "" || claims.UserID == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("token is missing required claims")
+	}
+	return claims, nil
+}
+
+// hash token returns the hex sha-256 stored in place of a token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// optional string maps an empty string to nil
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
 // generate unique id
 func generateID() string {
 	b := make([]byte, 8)
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"konbi/internal/config"
+	"konbi/internal/models"
+)
+
+// mailed links point at the frontend and carry the token as the only query parameter
+var mailedLink = regexp.MustCompile(`https?://\S+\?token=(\S+)`)
+
+// mails returns the messages the file mailer has dropped, oldest first
+func mails(t *testing.T, env *testEnv) []*netmail.Message {
+	t.Helper()
+	entries, err := os.ReadDir(env.mailDir)
+	if err != nil {
+		t.Fatalf("read mail dir: %v", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	slices.Sort(names)
+
+	msgs := make([]*netmail.Message, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(env.mailDir, name))
+		if err != nil {
+			t.Fatalf("read mail: %v", err)
+		}
+		msg, err := netmail.ReadMessage(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("parse mail %s: %v", name, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// mailed token returns the token in the link of the latest mail to the address with the
+// subject, checking that the link leads to path in the frontend
+func mailedToken(t *testing.T, env *testEnv, to, subject, path string) string {
+	t.Helper()
+	msgs := mails(t, env)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		msg := msgs[i]
+		got, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		if msg.Header.Get("To") != to || got != subject {
+			continue
+		}
+
+		body, err := io.ReadAll(msg.Body)
+		if err != nil {
+			t.Fatalf("read mail body: %v", err)
+		}
+		match := mailedLink.FindStringSubmatch(string(body))
+		if match == nil {
+			t.Fatalf("mail %q has no link:\n%s", subject, body)
+		}
+		if want := env.cfg.Mail.AppURL + path + "?token="; !strings.HasPrefix(match[0], want) {
+			t.Errorf("link %s doesn't start with %s", match[0], want)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatalf("unescape token: %v", err)
+		}
+		return token
+	}
+	t.Fatalf("no mail %q to %s among %d", subject, to, len(msgs))
+	return ""
+}
+
+// the whole account email flow runs offline: links are read back from the file mailer
+func TestVerifyAndResetPasswordFlow(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.Security.RequireEmailVerification = true })
+	const email, password, newPassword = "me@example.com", "Password123!", "NewPassword456!"
+
+	registered, err := env.auth.Register(ctx, &models.RegisterRequest{Email: email, Password: password}, testClient)
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if registered.AccessToken != "" || registered.RefreshToken != "" {
+		t.Error("register issued tokens before the email was verified")
+	}
+	if _, err := env.auth.Login(ctx, &models.LoginRequest{Email: email, Password: password}, testClient); statusCode(err) != http.StatusForbidden {
+		t.Fatalf("login before verification: error = %v, want 403", err)
+	}
+
+	// verify
+	verifyToken := mailedToken(t, env, email, "Verify your email address", "/verify")
+	if err := env.auth.VerifyEmail(ctx, verifyToken); err != nil {
+		t.Fatalf("verify email: %v", err)
+	}
+	if err := env.auth.VerifyEmail(ctx, verifyToken); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("reused verification token: error = %v, want 400", err)
+	}
+	session, err := env.auth.Login(ctx, &models.LoginRequest{Email: email, Password: password}, testClient)
+	if err != nil {
+		t.Fatalf("login after verification: %v", err)
+	}
+
+	// forgot; an unknown address succeeds too but gets no mail
+	sent := len(mails(t, env))
+	if err := env.auth.ForgotPassword(ctx, "nobody@example.com"); err != nil {
+		t.Fatalf("forgot password for an unknown address: %v", err)
+	}
+	if got := len(mails(t, env)); got != sent {
+		t.Errorf("forgot password for an unknown address sent %d mails", got-sent)
+	}
+	if err := env.auth.ForgotPassword(ctx, email); err != nil {
+		t.Fatalf("forgot password: %v", err)
+	}
+
+	// reset
+	resetToken := mailedToken(t, env, email, "Reset your password", "/reset")
+	if err := env.auth.ResetPassword(ctx, resetToken, newPassword); err != nil {
+		t.Fatalf("reset password: %v", err)
+	}
+	if err := env.auth.ResetPassword(ctx, resetToken, "Another789!"); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("reused reset token: error = %v, want 400", err)
+	}
+
+	// every earlier session is over, its access token included
+	claims, err := env.auth.VerifyAccessToken(session.AccessToken)
+	if err != nil {
+		t.Fatalf("verify access token: %v", err)
+	}
+	if err := env.auth.EnsureActive(ctx, claims.UserID, claims.IssuedAt.Time); statusCode(err) != http.StatusUnauthorized {
+		t.Errorf("access token from before the reset: error = %v, want 401", err)
+	}
+	if _, err := env.auth.Refresh(ctx, session.RefreshToken, testClient); statusCode(err) != http.StatusUnauthorized {
+		t.Errorf("refresh token from before the reset: error = %v, want 401", err)
+	}
+	if _, err := env.auth.Login(ctx, &models.LoginRequest{Email: email, Password: password}, testClient); statusCode(err) != http.StatusUnauthorized {
+		t.Errorf("login with the old password: error = %v, want 401", err)
+	}
+
+	// the cutoff has whole seconds, so tokens from the second of the reset are refused too
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	fresh, err := env.auth.Login(ctx, &models.LoginRequest{Email: email, Password: newPassword}, testClient)
+	if err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+	claims, err = env.auth.VerifyAccessToken(fresh.AccessToken)
+	if err != nil {
+		t.Fatalf("verify new access token: %v", err)
+	}
+	if err := env.auth.EnsureActive(ctx, claims.UserID, claims.IssuedAt.Time); err != nil {
+		t.Errorf("access token from after the reset: %v", err)
+	}
+}
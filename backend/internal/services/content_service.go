@@ -3,15 +3,21 @@ package services
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"konbi/internal/config"
 	"konbi/internal/errors"
 	"konbi/internal/models"
 	"konbi/internal/repository"
-	"os"
-	"path/filepath"
+	"konbi/internal/storage"
+	"math/big"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
@@ -19,73 +25,46 @@ import (
 
 // content service handles business logic for content operations
 type ContentService struct {
-	repo   *repository.ContentRepository
-	config *config.Config
-	logger *logrus.Logger
-}
-
-// allowed file extensions
-var allowedExtensions = map[string]bool{
-	".txt": true, ".pdf": true, ".doc": true, ".docx": true,
-	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
-	".zip": true, ".tar": true, ".gz": true,
-	".mp4": true, ".mp3": true, ".wav": true,
-	".csv": true, ".xlsx": true, ".xls": true,
-	".json": true, ".xml": true, ".md": true,
+	repo     *repository.ContentRepository
+	storage  storage.Backend
+	throttle *Throttle
+	quota    *Quota
+	audit    *AuditLogger
+	config   *config.Config
+	logger   *logrus.Logger
 }
 
 // create new content service
-func NewContentService(repo *repository.ContentRepository, cfg *config.Config, logger *logrus.Logger) *ContentService {
+func NewContentService(repo *repository.ContentRepository, store storage.Backend, throttle *Throttle, quota *Quota, audit *AuditLogger, cfg *config.Config, logger *logrus.Logger) *ContentService {
 	return &ContentService{
-		repo:   repo,
-		config: cfg,
-		logger: logger,
+		repo:     repo,
+		storage:  store,
+		throttle: throttle,
+		quota:    quota,
+		audit:    audit,
+		config:   cfg,
+		logger:   logger,
 	}
 }
 
 // upload file handles file upload logic
 func (s *ContentService) UploadFile(ctx context.Context, req *models.UploadRequest) (*models.Content, error) {
-	// validate file size
-	if req.Size > s.config.Storage.MaxFileSize {
-		s.logger.WithFields(logrus.Fields{
-			"file_size": req.Size,
-			"max_size":  s.config.Storage.MaxFileSize,
-		}).Warn("file size exceeds limit")
-		return nil, errors.NewFileTooLargeError(s.config.Storage.MaxFileSize)
-	}
-
-	// validate file extension
-	ext := strings.ToLower(filepath.Ext(req.Filename))
-	if ext != "" && !allowedExtensions[ext] {
-		s.logger.WithField("extension", ext).Warn("file type not allowed")
-		return nil, errors.NewFileTypeNotAllowedError()
-	}
-
-	// generate unique id
-	id, err := s.generateUniqueID(ctx)
+	// detect the type from the content itself and check it against the upload policy
+	mimeType, src, err := sniff(req.File)
 	if err != nil {
 		return nil, err
 	}
-
-	// prepare file path
-	filename := id + ext
-	filePath := filepath.Join(s.config.Storage.UploadDir, filename)
-
-	// save file to disk
-	file, err := os.Create(filePath)
+	ext, err := s.checkFileType(req.Filename, mimeType)
 	if err != nil {
-		s.logger.WithError(err).WithField("filepath", filePath).Error("failed to create file")
-		return nil, errors.NewInternalError("failed to save file", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	if _, err := file.Write(req.File); err != nil {
-		os.Remove(filePath)
-		s.logger.WithError(err).WithField("filepath", filePath).Error("failed to write file")
-		return nil, errors.NewInternalError("failed to save file", err)
+	expiresAt, maxViews, err := s.resolveShareOptions(&req.ShareOptions)
+	if err != nil {
+		return nil, err
 	}
 
-	// hash passcode if provided
+	// hash passcode if provided (before touching the disk)
 	var passcodeHash *string
 	if req.Passcode != "" {
 		if err := validatePasscode(req.Passcode); err != nil {
@@ -99,33 +78,177 @@ func (s *ContentService) UploadFile(ctx context.Context, req *models.UploadReque
 		passcodeHash = &h
 	}
 
+	// refuse early when the server or the uploader is out of space
+	if err := s.quota.Check(ctx, req.UserID, 0, 1); err != nil {
+		return nil, err
+	}
+
+	// generate unique id and share code
+	id, err := s.generateUniqueID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	code, err := s.generateUniqueCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// stream file to storage, enforcing the size limit as bytes arrive
+	key := id + ext
+	size, contentHash, err := s.saveFile(ctx, key, src)
+	if err != nil {
+		return nil, err
+	}
+
+	// now that the size is known the file has to fit the quota
+	if err := s.quota.Charge(ctx, req.UserID, size, 1); err != nil {
+		s.deleteBlob(key)
+		return nil, err
+	}
+
+	// anonymous uploads get a token to manage the share later
+	token, tokenHash, err := newManagementToken(req.UserID)
+	if err != nil {
+		s.deleteBlob(key)
+		s.quota.Refund(ctx, req.UserID, size, 1)
+		return nil, err
+	}
+
 	// prepare content model
-	expiresAt := time.Now().UTC().Add(time.Duration(s.config.Storage.ExpirationDays) * 24 * time.Hour)
 	content := &models.Content{
-		ID:           id,
-		Type:         models.ContentTypeFile,
-		Filename:     &req.Filename,
-		Filepath:     &filePath,
-		Filesize:     &req.Size,
-		PasscodeHash: passcodeHash,
-		ExpiresAt:    expiresAt,
+		ID:                  id,
+		Code:                &code,
+		UserID:              ownerID(req.UserID),
+		Type:                models.ContentTypeFile,
+		Filename:            &req.Filename,
+		Filepath:            &key,
+		Filesize:            &size,
+		ContentHash:         &contentHash,
+		MimeType:            &mimeType,
+		PasscodeHash:        passcodeHash,
+		ManagementTokenHash: tokenHash,
+		ManagementToken:     token,
+		ExpiresAt:           expiresAt,
+		MaxViews:            maxViews,
+		UploaderIP:          anonymousAddress(ctx, req.UserID),
 	}
 
 	// save to database
 	if err := s.repo.Create(ctx, content); err != nil {
-		os.Remove(filePath)
+		s.deleteBlob(key)
+		s.quota.Refund(ctx, req.UserID, size, 1)
 		return nil, err
 	}
 
 	s.logger.WithFields(logrus.Fields{
 		"content_id": id,
 		"filename":   req.Filename,
-		"size":       req.Size,
+		"size":       size,
 	}).Info("file uploaded successfully")
 
 	return content, nil
 }
 
+// save file streams r into storage under key, rejecting it once the size limit is exceeded.
+// returns the stored size and the hex sha-256 of the bytes, computed on the fly.
+func (s *ContentService) saveFile(ctx context.Context, key string, r io.Reader) (int64, string, error) {
+	maxSize := s.config.Storage.MaxFileSize
+	hash := sha256.New()
+
+	// read one byte past the limit so an oversized file is detected without buffering it
+	src := io.TeeReader(io.LimitReader(r, maxSize+1), hash)
+	written, err := s.storage.Put(ctx, key, src)
+	if err != nil {
+		s.deleteBlob(key)
+		s.logger.WithError(err).WithField("key", key).Error("failed to write file")
+		return 0, "", errors.NewInternalError("failed to save file", err)
+	}
+
+	if written > maxSize {
+		s.deleteBlob(key)
+		s.logger.WithFields(logrus.Fields{
+			"key":      key,
+			"max_size": maxSize,
+		}).Warn("file size exceeds limit")
+		return 0, "", errors.NewFileTooLargeError(maxSize)
+	}
+
+	return written, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// delete blob removes a stored file, logging instead of failing since callers are already unwinding
+func (s *ContentService) deleteBlob(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.storage.Delete(ctx, key); err != nil {
+		s.logger.WithError(err).WithField("key", key).Error("failed to delete file")
+	}
+}
+
+// open file returns a reader over a file content's stored blob
+func (s *ContentService) OpenFile(ctx context.Context, content *models.Content) (io.ReadCloser, error) {
+	if content.Filepath == nil {
+		return nil, errors.NewNotFoundError("file not found")
+	}
+	r, err := s.storage.Get(context.WithoutCancel(ctx), *content.Filepath)
+	if err == storage.ErrNotFound {
+		return nil, errors.NewNotFoundError("file not found")
+	}
+	if err != nil {
+		s.logger.WithError(err).WithField("content_id", content.ID).Error("failed to open file")
+		return nil, errors.NewInternalError("failed to open file", err)
+	}
+	return r, nil
+}
+
+// open file range returns a reader over length bytes of a file content's blob starting at offset
+func (s *ContentService) OpenFileRange(ctx context.Context, content *models.Content, offset, length int64) (io.ReadCloser, error) {
+	if content.Filepath == nil {
+		return nil, errors.NewNotFoundError("file not found")
+	}
+	r, err := s.storage.GetRange(context.WithoutCancel(ctx), *content.Filepath, offset, length)
+	if err == storage.ErrNotFound {
+		return nil, errors.NewNotFoundError("file not found")
+	}
+	if err != nil {
+		s.logger.WithError(err).WithField("content_id", content.ID).Error("failed to open file range")
+		return nil, errors.NewInternalError("failed to open file", err)
+	}
+	return r, nil
+}
+
+// file size returns the stored size of a file content, asking storage for legacy rows without one
+func (s *ContentService) FileSize(ctx context.Context, content *models.Content) (int64, error) {
+	if content.Filesize != nil {
+		return *content.Filesize, nil
+	}
+	if content.Filepath == nil {
+		return 0, errors.NewNotFoundError("file not found")
+	}
+	info, err := s.storage.Stat(ctx, *content.Filepath)
+	if err == storage.ErrNotFound {
+		return 0, errors.NewNotFoundError("file not found")
+	}
+	if err != nil {
+		s.logger.WithError(err).WithField("content_id", content.ID).Error("failed to stat file")
+		return 0, errors.NewInternalError("failed to check file", err)
+	}
+	return info.Size, nil
+}
+
+// file exists reports whether a file content's blob is still in storage
+func (s *ContentService) FileExists(ctx context.Context, content *models.Content) (bool, error) {
+	if content.Filepath == nil {
+		return false, nil
+	}
+	exists, err := s.storage.Exists(ctx, *content.Filepath)
+	if err != nil {
+		s.logger.WithError(err).WithField("content_id", content.ID).Error("failed to check file")
+		return false, errors.NewInternalError("failed to check file", err)
+	}
+	return exists, nil
+}
+
 // create note handles note creation logic
 func (s *ContentService) CreateNote(ctx context.Context, req *models.NoteRequest) (*models.Content, error) {
 	// validate content length (1mb limit)
@@ -134,11 +257,20 @@ func (s *ContentService) CreateNote(ctx context.Context, req *models.NoteRequest
 		return nil, errors.NewContentTooLargeError()
 	}
 
-	// generate unique id
+	expiresAt, maxViews, err := s.resolveShareOptions(&req.ShareOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// generate unique id and share code
 	id, err := s.generateUniqueID(ctx)
 	if err != nil {
 		return nil, err
 	}
+	code, err := s.generateUniqueCode(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	// hash passcode if provided
 	var passcodeHash *string
@@ -155,23 +287,40 @@ func (s *ContentService) CreateNote(ctx context.Context, req *models.NoteRequest
 	}
 
 	// prepare content model
-	expiresAt := time.Now().UTC().Add(time.Duration(s.config.Storage.ExpirationDays) * 24 * time.Hour)
 	var title *string
 	if req.Title != "" {
 		title = &req.Title
 	}
 
+	// anonymous notes get a token to manage the share later
+	token, tokenHash, err := newManagementToken(req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
 	content := &models.Content{
-		ID:           id,
-		Type:         models.ContentTypeNote,
-		Title:        title,
-		Content:      &req.Content,
-		PasscodeHash: passcodeHash,
-		ExpiresAt:    expiresAt,
+		ID:                  id,
+		Code:                &code,
+		UserID:              ownerID(req.UserID),
+		Type:                models.ContentTypeNote,
+		Title:               title,
+		Content:             &req.Content,
+		PasscodeHash:        passcodeHash,
+		ManagementTokenHash: tokenHash,
+		ManagementToken:     token,
+		ExpiresAt:           expiresAt,
+		MaxViews:            maxViews,
+		UploaderIP:          anonymousAddress(ctx, req.UserID),
+	}
+
+	// notes live in the database, so they only count against the share limit
+	if err := s.quota.Charge(ctx, req.UserID, 0, 1); err != nil {
+		return nil, err
 	}
 
 	// save to database
 	if err := s.repo.Create(ctx, content); err != nil {
+		s.quota.Refund(ctx, req.UserID, 0, 1)
 		return nil, err
 	}
 
@@ -184,94 +333,136 @@ func (s *ContentService) CreateNote(ctx context.Context, req *models.NoteRequest
 }
 
 // create bundle uploads multiple files under a single shared ID/code
-func (s *ContentService) CreateBundle(ctx context.Context, files []*models.UploadRequest) (*models.Content, error) {
-	if len(files) == 0 {
-		return nil, errors.NewBadRequestError("no files provided", nil)
+// files are streamed one at a time; any failure rolls back everything written so far
+func (s *ContentService) CreateBundle(ctx context.Context, req *models.BundleRequest) (*models.Content, error) {
+	expiresAt, maxViews, err := s.resolveShareOptions(&req.ShareOptions)
+	if err != nil {
+		return nil, err
 	}
 
-	// validate all files up front before writing anything
-	for _, req := range files {
-		if req.Size > s.config.Storage.MaxFileSize {
-			return nil, errors.NewFileTooLargeError(s.config.Storage.MaxFileSize)
-		}
-		ext := strings.ToLower(filepath.Ext(req.Filename))
-		if ext != "" && !allowedExtensions[ext] {
-			return nil, errors.NewFileTypeNotAllowedError()
-		}
+	if err := s.quota.Check(ctx, req.UserID, 0, 1); err != nil {
+		return nil, err
 	}
 
 	bundleID, err := s.generateUniqueID(ctx)
 	if err != nil {
 		return nil, err
 	}
+	// files inside a bundle are reached through it, so only the bundle gets a share code
+	code, err := s.generateUniqueCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// anonymous bundles get a token to manage the share later
+	token, tokenHash, err := newManagementToken(req.UserID)
+	if err != nil {
+		return nil, err
+	}
 
-	expiresAt := time.Now().UTC().Add(time.Duration(s.config.Storage.ExpirationDays) * 24 * time.Hour)
 	bundle := &models.Content{
-		ID:        bundleID,
-		Type:      models.ContentTypeBundle,
-		ExpiresAt: expiresAt,
+		ID:                  bundleID,
+		Code:                &code,
+		UserID:              ownerID(req.UserID),
+		Type:                models.ContentTypeBundle,
+		ManagementTokenHash: tokenHash,
+		ManagementToken:     token,
+		ExpiresAt:           expiresAt,
+		MaxViews:            maxViews,
+		UploaderIP:          anonymousAddress(ctx, req.UserID),
+	}
+	// the bundle counts as one share; its files only add bytes
+	if err := s.quota.Charge(ctx, req.UserID, 0, 1); err != nil {
+		return nil, err
 	}
 	if err := s.repo.Create(ctx, bundle); err != nil {
+		s.quota.Refund(ctx, req.UserID, 0, 1)
 		return nil, err
 	}
 
-	var uploadedPaths []string
-	for _, req := range files {
-		id, err := s.generateUniqueID(ctx)
+	var uploadedKeys []string
+	for {
+		file, err := req.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.rollbackBundle(bundleID, uploadedKeys)
+			return nil, err
+		}
+
+		mimeType, src, err := sniff(file.File)
 		if err != nil {
-			s.rollbackBundle(bundleID, uploadedPaths)
+			s.rollbackBundle(bundleID, uploadedKeys)
+			return nil, err
+		}
+		ext, err := s.checkFileType(file.Filename, mimeType)
+		if err != nil {
+			s.rollbackBundle(bundleID, uploadedKeys)
 			return nil, err
 		}
 
-		ext := strings.ToLower(filepath.Ext(req.Filename))
-		diskName := id + ext
-		filePath := filepath.Join(s.config.Storage.UploadDir, diskName)
+		id, err := s.generateUniqueID(ctx)
+		if err != nil {
+			s.rollbackBundle(bundleID, uploadedKeys)
+			return nil, err
+		}
 
-		f, err := os.Create(filePath)
+		key := id + ext
+		size, contentHash, err := s.saveFile(ctx, key, src)
 		if err != nil {
-			s.rollbackBundle(bundleID, uploadedPaths)
-			return nil, errors.NewInternalError("failed to save file", err)
+			s.rollbackBundle(bundleID, uploadedKeys)
+			return nil, err
 		}
-		if _, err := f.Write(req.File); err != nil {
-			f.Close()
-			os.Remove(filePath)
-			s.rollbackBundle(bundleID, uploadedPaths)
-			return nil, errors.NewInternalError("failed to save file", err)
+		uploadedKeys = append(uploadedKeys, key)
+		if err := s.quota.Charge(ctx, req.UserID, size, 0); err != nil {
+			s.rollbackBundle(bundleID, uploadedKeys)
+			return nil, err
 		}
-		f.Close()
-		uploadedPaths = append(uploadedPaths, filePath)
 
+		filename := file.Filename
 		fileContent := &models.Content{
-			ID:        id,
-			BundleID:  &bundleID,
-			Type:      models.ContentTypeFile,
-			Filename:  &req.Filename,
-			Filepath:  &filePath,
-			Filesize:  &req.Size,
-			ExpiresAt: expiresAt,
+			ID:          id,
+			BundleID:    &bundleID,
+			UserID:      bundle.UserID,
+			Type:        models.ContentTypeFile,
+			Filename:    &filename,
+			Filepath:    &key,
+			Filesize:    &size,
+			ContentHash: &contentHash,
+			MimeType:    &mimeType,
+			ExpiresAt:   expiresAt,
+			UploaderIP:  bundle.UploaderIP,
 		}
 		if err := s.repo.Create(ctx, fileContent); err != nil {
-			s.rollbackBundle(bundleID, uploadedPaths)
+			s.quota.Refund(ctx, req.UserID, size, 0)
+			s.rollbackBundle(bundleID, uploadedKeys)
 			return nil, err
 		}
 	}
 
+	if len(uploadedKeys) == 0 {
+		s.rollbackBundle(bundleID, nil)
+		return nil, errors.NewBadRequestError("no files provided", nil)
+	}
+
 	s.logger.WithFields(logrus.Fields{
 		"bundle_id":  bundleID,
-		"file_count": len(files),
+		"file_count": len(uploadedKeys),
 	}).Info("bundle created successfully")
 
 	return bundle, nil
 }
 
-// rollback bundle removes uploaded files and soft-deletes the bundle record on failure
-func (s *ContentService) rollbackBundle(bundleID string, paths []string) {
-	for _, p := range paths {
-		os.Remove(p)
+// rollback bundle removes uploaded files and soft-deletes the bundle with the file records
+// saved so far, which also gives back their quota
+func (s *ContentService) rollbackBundle(bundleID string, keys []string) {
+	for _, key := range keys {
+		s.deleteBlob(key)
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := s.repo.SoftDelete(ctx, bundleID); err != nil {
+	if err := s.repo.SetDeleted(ctx, bundleID, true); err != nil {
 		s.logger.WithError(err).WithField("bundle_id", bundleID).Error("failed to soft-delete bundle during rollback")
 	}
 }
@@ -281,73 +472,267 @@ func (s *ContentService) GetBundleFiles(ctx context.Context, bundleID string) ([
 	return s.repo.FindBundleFiles(ctx, bundleID)
 }
 
-// get content retrieves content by id and increments view count
+// get content retrieves live content by id; content that used up its views is gone.
+// a file in a bundle lives only as long as the bundle and is guarded by its passcode.
 func (s *ContentService) GetContent(ctx context.Context, id string) (*models.Content, error) {
 	content, err := s.repo.FindActiveByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-
-	// increment view count asynchronously
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-		defer cancel()
-		if err := s.repo.IncrementViewCount(ctx, id); err != nil {
-			s.logger.WithError(err).WithField("content_id", id).Error("failed to increment view count")
+	if content.BundleID != nil {
+		bundle, err := s.repo.FindActiveByID(ctx, *content.BundleID)
+		if err != nil {
+			return nil, err
+		}
+		if viewsExhausted(bundle) {
+			return nil, errors.NewGoneError("content is no longer available")
 		}
-	}()
+		content.PasscodeHash = bundle.PasscodeHash
+	}
+	if viewsExhausted(content) {
+		return nil, errors.NewGoneError("content is no longer available")
+	}
+	return content, nil
+}
 
+// get content by code resolves a share code to its content.
+// codes are matched leniently: case, separators and look-alike characters are normalized first.
+func (s *ContentService) GetContentByCode(ctx context.Context, code string) (*models.Content, error) {
+	normalized := normalizeCode(code, s.config.Storage.CodeAlphabet)
+	if normalized == "" {
+		return nil, errors.NewNotFoundError("content not found or expired")
+	}
+
+	content, err := s.repo.FindActiveByCode(ctx, normalized)
+	if err != nil {
+		return nil, err
+	}
+	if viewsExhausted(content) {
+		return nil, errors.NewGoneError("content is no longer available")
+	}
 	return content, nil
 }
 
-// unlock content verifies passcode and returns full content (increments view count on success)
+// consume view counts a delivery of the content's payload (note text, file bytes, bundle zip)
+// and fails with gone once the view limit is used up. files in a bundle count against the bundle.
+func (s *ContentService) ConsumeView(ctx context.Context, content *models.Content) error {
+	id := content.ID
+	if content.BundleID != nil {
+		id = *content.BundleID
+	}
+
+	ok, err := s.repo.ConsumeView(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		s.logger.WithField("content_id", id).Info("view limit reached")
+		return errors.NewGoneError("content is no longer available")
+	}
+	return nil
+}
+
+// unlock content verifies passcode and returns full content
 func (s *ContentService) UnlockContent(ctx context.Context, id, passcode string) (*models.Content, error) {
-	content, err := s.repo.FindActiveByID(ctx, id)
+	content, err := s.GetContent(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := s.VerifyPasscode(ctx, content, passcode); err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+// verify passcode checks a passcode against a content record without fetching from DB.
+// failures are throttled per content, so short passcodes can't be guessed quickly.
+func (s *ContentService) VerifyPasscode(ctx context.Context, content *models.Content, passcode string) error {
 	if content.PasscodeHash == nil || strings.TrimSpace(*content.PasscodeHash) == "" {
-		return content, nil
+		return nil
 	}
 
+	// guesses against the files of a bundle add up to the bundle's lockout
+	key := passcodeAttemptKey(content.ID)
+	if content.BundleID != nil {
+		key = passcodeAttemptKey(*content.BundleID)
+	}
+	if err := s.throttle.Attempt(ctx, key); err != nil {
+		s.audit.Record(ctx, models.AuditPasscode, models.AuditDenied, models.AuditTargetContent, content.ID, "locked out")
+		return err
+	}
 	if err := bcrypt.CompareHashAndPassword([]byte(*content.PasscodeHash), []byte(passcode)); err != nil {
-		s.logger.WithField("content_id", id).Warn("incorrect passcode attempt")
-		return nil, errors.NewForbiddenError("incorrect passcode")
+		s.logger.WithField("content_id", content.ID).Warn("incorrect passcode attempt")
+		s.audit.Record(ctx, models.AuditPasscode, models.AuditFailure, models.AuditTargetContent, content.ID, "incorrect passcode")
+		return errors.NewForbiddenError("incorrect passcode")
+	}
+	s.throttle.Succeed(ctx, key)
+	return nil
+}
+
+// list user content returns a page of the shares created by a user
+func (s *ContentService) ListUserContent(ctx context.Context, userID string, limit, offset int) ([]*models.Content, int, error) {
+	return s.repo.ListByUser(ctx, userID, limit, offset)
+}
+
+// update content applies an owner's changes to expiry, passcode, title or filename
+func (s *ContentService) UpdateContent(ctx context.Context, id, userID, token string, req *models.UpdateContentRequest) (*models.Content, error) {
+	content, err := s.findManageable(ctx, id, userID, token)
+	if err != nil {
+		s.audit.RecordResult(ctx, models.AuditContentUpdate, models.AuditTargetContent, id, err)
+		return nil, err
 	}
 
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-		defer cancel()
-		if err := s.repo.IncrementViewCount(ctx, id); err != nil {
-			s.logger.WithError(err).WithField("content_id", id).Error("failed to increment view count")
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		now := time.Now().UTC()
+		maxExpiresAt := now.Add(s.config.Storage.MaxExpiration)
+		if !expiresAt.After(now) {
+			return nil, errors.NewBadRequestError("expires_at must be in the future", nil)
 		}
-	}()
+		if expiresAt.After(maxExpiresAt) {
+			return nil, errors.NewBadRequestError(fmt.Sprintf("expires_at must be within %s", formatDuration(s.config.Storage.MaxExpiration)), nil)
+		}
+		content.ExpiresAt = expiresAt
+	}
+
+	if req.Passcode != nil {
+		if *req.Passcode == "" {
+			content.PasscodeHash = nil
+		} else {
+			if err := validatePasscode(*req.Passcode); err != nil {
+				return nil, err
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(*req.Passcode), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, errors.NewInternalError("failed to hash passcode", err)
+			}
+			h := string(hash)
+			content.PasscodeHash = &h
+		}
+	}
+
+	if req.Title != nil {
+		if content.Type != models.ContentTypeNote {
+			return nil, errors.NewBadRequestError("only notes have a title", nil)
+		}
+		if *req.Title == "" {
+			content.Title = nil
+		} else {
+			title := *req.Title
+			content.Title = &title
+		}
+	}
+
+	if req.Filename != nil {
+		if content.Type != models.ContentTypeFile {
+			return nil, errors.NewBadRequestError("only files have a filename", nil)
+		}
+		filename := strings.TrimSpace(*req.Filename)
+		if filename == "" || strings.ContainsAny(filename, `/\`) {
+			return nil, errors.NewBadRequestError("invalid filename", nil)
+		}
+		// the new name has to fit the content that is already stored
+		mimeType := ""
+		if content.MimeType != nil {
+			mimeType = *content.MimeType
+		}
+		if _, err := s.checkFileType(filename, mimeType); err != nil {
+			return nil, err
+		}
+		content.Filename = &filename
+	}
 
+	if err := s.repo.Update(ctx, content); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithField("content_id", id).Info("content updated by owner")
+	s.audit.Record(ctx, models.AuditContentUpdate, models.AuditSuccess, models.AuditTargetContent, id, "")
 	return content, nil
 }
 
-// verify passcode checks a passcode against a content record without fetching from DB
-func (s *ContentService) VerifyPasscode(content *models.Content, passcode string) error {
-	if content.PasscodeHash == nil || strings.TrimSpace(*content.PasscodeHash) == "" {
-		return nil
+// delete content soft-deletes an owner's share and removes its blobs; a bundle takes its files along
+func (s *ContentService) DeleteContent(ctx context.Context, id, userID, token string) error {
+	content, err := s.findManageable(ctx, id, userID, token)
+	if err != nil {
+		s.audit.RecordResult(ctx, models.AuditContentDelete, models.AuditTargetContent, id, err)
+		return err
 	}
-	if err := bcrypt.CompareHashAndPassword([]byte(*content.PasscodeHash), []byte(passcode)); err != nil {
-		return errors.NewForbiddenError("incorrect passcode")
+
+	var files []*models.Content
+	if content.Type == models.ContentTypeBundle {
+		files, err = s.repo.FindBundleFiles(ctx, id)
+		if err != nil {
+			return err
+		}
+	} else if content.Type == models.ContentTypeFile {
+		files = []*models.Content{content}
 	}
+
+	// records go first so the share disappears even if blob removal fails
+	if err := s.repo.SoftDelete(ctx, id); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.ID != id {
+			if err := s.repo.SoftDelete(ctx, f.ID); err != nil {
+				s.logger.WithError(err).WithField("content_id", f.ID).Error("failed to soft-delete bundle file")
+			}
+		}
+		if f.Filepath != nil {
+			s.deleteBlob(*f.Filepath)
+		}
+	}
+
+	s.logger.WithField("content_id", id).Info("content deleted by owner")
+	s.audit.Record(ctx, models.AuditContentDelete, models.AuditSuccess, models.AuditTargetContent, id, "")
 	return nil
 }
 
+// delete user content removes everything a user has shared, used when the account is deleted
+func (s *ContentService) DeleteUserContent(ctx context.Context, userID string) (int, error) {
+	keys, err := s.repo.DeleteByUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		s.deleteBlob(key)
+	}
+	return len(keys), nil
+}
+
+// find manageable loads a top-level share and checks the caller owns it,
+// either as the authenticated uploader or by presenting the management token
+func (s *ContentService) findManageable(ctx context.Context, id, userID, token string) (*models.Content, error) {
+	content, err := s.repo.FindActiveByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if content.BundleID != nil {
+		return nil, errors.NewBadRequestError("files in a bundle are managed through the bundle", nil)
+	}
+
+	if userID != "" && content.UserID != nil && *content.UserID == userID {
+		return content, nil
+	}
+	if tokenMatches(token, content.ManagementTokenHash) {
+		return content, nil
+	}
+
+	if userID == "" && token == "" {
+		return nil, errors.NewUnauthorizedError("authentication or management token required")
+	}
+	s.logger.WithField("content_id", id).Warn("unauthorized content management attempt")
+	return nil, errors.NewForbiddenError("not allowed to manage this content")
+}
+
 // get stats retrieves content statistics
 func (s *ContentService) GetStats(ctx context.Context, id string) (*models.Content, error) {
 	return s.repo.FindByID(ctx, id)
 }
 
-// list all content for admin
-func (s *ContentService) ListAll(ctx context.Context) ([]*models.Content, error) {
-	return s.repo.ListAll(ctx)
-}
-
 // cleanup expired content removes expired files and database records
 func (s *ContentService) CleanupExpired(ctx context.Context) (int, error) {
 	s.logger.Info("starting cleanup of expired content")
@@ -358,15 +743,15 @@ func (s *ContentService) CleanupExpired(ctx context.Context) (int, error) {
 		return 0, err
 	}
 
-	// delete files from disk
+	// delete files from storage
 	deletedFiles := 0
 	for _, content := range expiredContent {
 		if content.Filepath == nil {
 			continue
 		}
 
-		if err := os.Remove(*content.Filepath); err != nil && !os.IsNotExist(err) {
-			s.logger.WithError(err).WithField("filepath", *content.Filepath).Error("failed to delete file")
+		if err := s.storage.Delete(ctx, *content.Filepath); err != nil {
+			s.logger.WithError(err).WithField("key", *content.Filepath).Error("failed to delete file")
 		} else {
 			deletedFiles++
 		}
@@ -414,6 +799,76 @@ func (s *ContentService) generateUniqueID(ctx context.Context) (string, error) {
 	return "", errors.NewInternalError("failed to generate unique id after retries", nil)
 }
 
+// generate unique code creates a short share code that is not yet taken
+func (s *ContentService) generateUniqueCode(ctx context.Context) (string, error) {
+	const maxRetries = 5
+
+	for i := 0; i < maxRetries; i++ {
+		code, err := generateRandomCode(s.config.Storage.CodeAlphabet, s.config.Storage.CodeLength)
+		if err != nil {
+			s.logger.WithError(err).Error("failed to generate random code")
+			return "", errors.NewInternalError("failed to generate code", err)
+		}
+
+		// check if code exists
+		exists, err := s.repo.CodeExists(ctx, code)
+		if err != nil {
+			return "", err
+		}
+
+		if !exists {
+			return code, nil
+		}
+
+		s.logger.WithField("code", code).Debug("code collision detected, retrying")
+	}
+
+	return "", errors.NewInternalError("failed to generate unique code after retries", nil)
+}
+
+// helper to generate a random code of length characters drawn uniformly from alphabet
+func generateRandomCode(alphabet string, length int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// normalize code turns user input into the stored form of a share code: separators are dropped,
+// case is folded when the alphabet is single-case, and look-alikes missing from the alphabet
+// (O for 0, I and L for 1) are mapped, so "abc-d0l" finds "ABCD01"
+func normalizeCode(code, alphabet string) string {
+	upper := alphabet == strings.ToUpper(alphabet)
+	lower := alphabet == strings.ToLower(alphabet)
+
+	lookalikes := map[rune]rune{'O': '0', 'o': '0', 'I': '1', 'i': '1', 'L': '1', 'l': '1'}
+
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(code) {
+		if r == '-' || r == ' ' || r == '_' {
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+		} else if lower {
+			r = unicode.ToLower(r)
+		}
+		if !strings.ContainsRune(alphabet, r) {
+			if mapped, ok := lookalikes[r]; ok && strings.ContainsRune(alphabet, mapped) {
+				r = mapped
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 // helper to generate random id
 func generateRandomID(length int) (string, error) {
 	bytes := make([]byte, 8)
@@ -440,6 +895,102 @@ func generateRandomID(length int) (string, error) {
 	return id[:length], nil
 }
 
+// min expiration is the shortest lifetime a client may ask for
+const minExpiration = time.Minute
+
+// resolve share options turns the requested lifetime limits into an expiry time and view limit
+func (s *ContentService) resolveShareOptions(opts *models.ShareOptions) (time.Time, *int, error) {
+	now := time.Now().UTC()
+
+	lifetime := time.Duration(s.config.Storage.ExpirationDays) * 24 * time.Hour
+	if opts.ExpiresIn != 0 {
+		if opts.ExpiresIn < int64(minExpiration/time.Second) {
+			return time.Time{}, nil, errors.NewBadRequestError(fmt.Sprintf("expires_in must be at least %d seconds", int64(minExpiration/time.Second)), nil)
+		}
+		if opts.ExpiresIn > int64(s.config.Storage.MaxExpiration/time.Second) {
+			return time.Time{}, nil, errors.NewBadRequestError(fmt.Sprintf("expires_in must be at most %s", formatDuration(s.config.Storage.MaxExpiration)), nil)
+		}
+		lifetime = time.Duration(opts.ExpiresIn) * time.Second
+	}
+
+	maxViews := opts.MaxViews
+	if opts.BurnAfterRead {
+		if maxViews != nil && *maxViews != 1 {
+			return time.Time{}, nil, errors.NewBadRequestError("burn_after_read cannot be combined with max_views other than 1", nil)
+		}
+		one := 1
+		maxViews = &one
+	}
+	if maxViews != nil && *maxViews < 1 {
+		return time.Time{}, nil, errors.NewBadRequestError("max_views must be at least 1", nil)
+	}
+
+	return now.Add(lifetime), maxViews, nil
+}
+
+// views exhausted reports whether content has reached its view limit
+func viewsExhausted(content *models.Content) bool {
+	return content.MaxViews != nil && content.ViewCount >= *content.MaxViews
+}
+
+// format duration renders a lifetime limit in days or hours for error messages
+func formatDuration(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", int(d/(24*time.Hour)))
+	}
+	return fmt.Sprintf("%d hours", int(d/time.Hour))
+}
+
+// new management token creates the token given to anonymous uploaders and its stored hash.
+// authenticated uploaders manage their shares through their account and get none.
+func newManagementToken(userID string) (string, *string, error) {
+	if userID != "" {
+		return "", nil, nil
+	}
+	token, hash, err := newSecretToken()
+	if err != nil {
+		return "", nil, errors.NewInternalError("failed to generate management token", err)
+	}
+	return token, &hash, nil
+}
+
+// new secret token creates a random url-safe bearer token and the hex sha-256 stored in its place
+func newSecretToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	sum := sha256.Sum256([]byte(token))
+	return token, hex.EncodeToString(sum[:]), nil
+}
+
+// token matches compares a presented secret token with a stored hash in constant time
+func tokenMatches(token string, hash *string) bool {
+	if token == "" || hash == nil {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(*hash)) == 1
+}
+
+// anonymous address returns the client address an anonymous share is counted against,
+// nil for a user's share
+func anonymousAddress(ctx context.Context, userID string) *string {
+	if userID != "" {
+		return nil
+	}
+	return uploaderAddress(ctx)
+}
+
+// owner id turns an optional user id into the nullable owner column value
+func ownerID(userID string) *string {
+	if userID == "" {
+		return nil
+	}
+	return &userID
+}
+
 // validate passcode enforces length bounds (4–64 characters)
 func validatePasscode(passcode string) error {
 	if len(passcode) < 4 {
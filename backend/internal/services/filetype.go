@@ -0,0 +1,122 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"konbi/internal/errors"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sniff len is how much of a file is read to detect its type, the same as http.DetectContentType looks at
+const sniffLen = 512
+
+// executable signatures http.DetectContentType doesn't know; they are checked first so a
+// renamed program is recognized whatever it is called
+var executableSignatures = []struct {
+	magic    string
+	mimeType string
+}{
+	{"MZ", "application/vnd.microsoft.portable-executable"},
+	{"\x7fELF", "application/x-elf"},
+	{"\xfe\xed\xfa\xce", "application/x-mach-binary"},
+	{"\xfe\xed\xfa\xcf", "application/x-mach-binary"},
+	{"\xce\xfa\xed\xfe", "application/x-mach-binary"},
+	{"\xcf\xfa\xed\xfe", "application/x-mach-binary"},
+	{"#!", "text/x-shellscript"},
+	// compound files are what .doc and .xls are stored in
+	{"\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "application/x-ole-storage"},
+}
+
+// extension types maps extensions of formats with a reliable signature to the type their
+// content sniffs as. a file with one of these extensions has to actually be that format;
+// text formats and containers without a fixed signature are left out.
+var extensionTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".zip":  "application/zip",
+	".docx": "application/zip",
+	".xlsx": "application/zip",
+	".pptx": "application/zip",
+	".gz":   "application/x-gzip",
+	".doc":  "application/x-ole-storage",
+	".xls":  "application/x-ole-storage",
+	".wav":  "audio/wave",
+}
+
+// sniff reads the start of r and detects its type. the returned reader yields the whole
+// stream again, so detection doesn't cost the caller any bytes.
+func sniff(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, errors.NewInternalError("failed to read file", err)
+	}
+	head = head[:n]
+	return detectContentType(head), io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// detect content type returns the mime type of a file from its first bytes
+func detectContentType(head []byte) string {
+	for _, sig := range executableSignatures {
+		if bytes.HasPrefix(head, []byte(sig.magic)) {
+			return sig.mimeType
+		}
+	}
+	return http.DetectContentType(head)
+}
+
+// check file type applies the upload policy to a filename and the type sniffed from its
+// content, and returns the normalized extension used for the stored name. an empty mime
+// type, when the content isn't there yet or predates sniffing, is judged by the name alone.
+func (s *ContentService) checkFileType(filename, mimeType string) (string, error) {
+	policy := s.config.Storage.FileTypes
+	ext := strings.ToLower(filepath.Ext(filename))
+	base, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		base = mimeType
+	}
+
+	reason := ""
+	switch {
+	case slices.Contains(policy.DeniedExtensions, ext):
+		reason = "extension denied"
+	case policy.AllowedExtensions != nil && !slices.Contains(policy.AllowedExtensions, ext):
+		reason = "extension not allowed"
+	case base == "":
+	case matchType(policy.DeniedTypes, base):
+		reason = "type denied"
+	case policy.AllowedTypes != nil && !matchType(policy.AllowedTypes, base):
+		reason = "type not allowed"
+	case extensionTypes[ext] != "" && extensionTypes[ext] != base:
+		reason = "content does not match extension"
+	}
+	if reason != "" {
+		s.logger.WithFields(logrus.Fields{
+			"extension": ext,
+			"mime_type": base,
+			"reason":    reason,
+		}).Warn("file type not allowed")
+		return ext, errors.NewFileTypeNotAllowedError()
+	}
+	return ext, nil
+}
+
+// match type reports whether a mime type is listed, either exactly or through a "type/*" pattern
+func matchType(patterns []string, mimeType string) bool {
+	for _, p := range patterns {
+		if p == mimeType || (strings.HasSuffix(p, "/*") && strings.HasPrefix(mimeType, p[:len(p)-1])) {
+			return true
+		}
+	}
+	return false
+}
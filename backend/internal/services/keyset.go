@@ -0,0 +1,246 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"konbi/internal/config"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signing key is one key of a key set. asymmetric keys without a private half
+// are retired keys kept only to verify tokens issued before a rotation.
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   any // []byte for hmac, crypto.Signer otherwise; nil for verify-only keys
+	verifyKey any // []byte for hmac, crypto.PublicKey otherwise
+}
+
+// key set signs tokens with its active key and verifies them with any of its keys
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+// signing keys holds the key sets for access and refresh tokens.
+// with HS256 they use separate secrets; with a key directory they share one key set.
+type SigningKeys struct {
+	Access  *KeySet
+	Refresh *KeySet
+}
+
+// load signing keys builds the key sets from configuration: HS256 secrets by default,
+// or RS256/EdDSA keys from JWT_KEYS_DIR when it is set
+func LoadSigningKeys(cfg config.ServerConfig) (*SigningKeys, error) {
+	if cfg.JWTKeysDir == "" {
+		return &SigningKeys{
+			Access:  newHMACKeySet(cfg.JWTSecret),
+			Refresh: newHMACKeySet(cfg.JWTRefreshSecret),
+		}, nil
+	}
+
+	keys, err := LoadKeySet(cfg.JWTKeysDir, cfg.JWTSigningKeyID)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKeys{Access: keys, Refresh: keys}, nil
+}
+
+// new hmac key set wraps a shared secret; hmac tokens carry no kid
+func newHMACKeySet(secret string) *KeySet {
+	key := &signingKey{
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+	return &KeySet{active: key, keys: map[string]*signingKey{"": key}}
+}
+
+// load key set reads PEM keys from dir. the file name without extension is the kid:
+// "<kid>.pem" holds a private key (RSA or Ed25519, PKCS#8 or PKCS#1) and
+// "<kid>.pub.pem" a public key kept only for verification.
+// activeKID picks the signing key; when empty the last private key by name is used,
+// so date-prefixed names rotate naturally.
+func LoadKeySet(dir, activeKID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list signing keys: %w", err)
+	}
+	sort.Strings(paths)
+
+	set := &KeySet{keys: map[string]*signingKey{}}
+	var lastPrivate *signingKey
+	for _, path := range paths {
+		name := filepath.Base(path)
+		public := strings.HasSuffix(name, ".pub.pem")
+		kid := strings.TrimSuffix(strings.TrimSuffix(name, ".pem"), ".pub")
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key %s: %w", name, err)
+		}
+		key, err := parseSigningKey(kid, data, public)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key %s: %w", name, err)
+		}
+
+		// a private key also covers its public half, so it wins over a .pub.pem of the same kid
+		if existing, ok := set.keys[kid]; ok && existing.signKey != nil {
+			continue
+		}
+		set.keys[kid] = key
+		if key.signKey != nil {
+			lastPrivate = key
+		}
+	}
+
+	if activeKID == "" {
+		set.active = lastPrivate
+	} else if key, ok := set.keys[activeKID]; ok && key.signKey != nil {
+		set.active = key
+	}
+	if set.active == nil {
+		return nil, fmt.Errorf("no private signing key found in %s (wanted %q)", dir, activeKID)
+	}
+	return set, nil
+}
+
+// parse signing key decodes one PEM block into a key and infers its algorithm
+func parseSigningKey(kid string, data []byte, public bool) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	if public {
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		method, err := methodForKey(pub)
+		if err != nil {
+			return nil, err
+		}
+		return &signingKey{kid: kid, method: method, verifyKey: pub}, nil
+	}
+
+	var priv any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		priv, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		priv, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+	method, err := methodForKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{kid: kid, method: method, signKey: signer, verifyKey: signer.Public()}, nil
+}
+
+// method for key maps a public key to the JWT algorithm used with it
+func methodForKey(pub crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T (expected RSA or Ed25519)", pub)
+	}
+}
+
+// sign signs claims with the active key, naming it in the kid header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	if ks.active.kid != "" {
+		token.Header["kid"] = ks.active.kid
+	}
+	return token.SignedString(ks.active.signKey)
+}
+
+// parse verifies a token against the key named by its kid header and fills claims
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims, opts ...jwt.ParserOption) error {
+	methods := make([]string, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		methods = append(methods, key.method.Alg())
+	}
+	opts = append(opts, jwt.WithValidMethods(methods))
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("signing method %s does not match key %q", token.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
+	}, opts...)
+	return err
+}
+
+// jwk is the public JSON Web Key form of a verification key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// jwks returns the public verification keys, sorted by kid. hmac secrets are never published.
+func (ks *KeySet) JWKS() []JWK {
+	keys := make([]JWK, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "RSA",
+				Kid: key.kid,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "OKP",
+				Kid: key.kid,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return keys
+}
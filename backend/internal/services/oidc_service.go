@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"konbi/internal/config"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/oidc"
+	"konbi/internal/repository"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// how long a user has to finish signing in at the provider
+const OIDCStateTTL = 10 * time.Minute
+
+// oidc service signs users in through external openid connect providers
+type OIDCService struct {
+	providers    map[string]*oidc.Provider
+	order        []string
+	redirectURL  string
+	userRepo     *repository.UserRepository
+	identityRepo *repository.IdentityRepository
+	stateRepo    *repository.OIDCStateRepository
+	authService  *AuthService
+	logger       *logrus.Logger
+}
+
+// create new oidc service
+func NewOIDCService(userRepo *repository.UserRepository, identityRepo *repository.IdentityRepository, stateRepo *repository.OIDCStateRepository, authService *AuthService, cfg *config.Config, logger *logrus.Logger) *OIDCService {
+	s := &OIDCService{
+		providers:    make(map[string]*oidc.Provider, len(cfg.OIDC.Providers)),
+		redirectURL:  cfg.OIDC.RedirectURL,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		stateRepo:    stateRepo,
+		authService:  authService,
+		logger:       logger,
+	}
+	for _, p := range cfg.OIDC.Providers {
+		s.providers[p.ID] = oidc.NewProvider(p)
+		s.order = append(s.order, p.ID)
+	}
+	return s
+}
+
+// providers lists the configured providers in configuration order
+func (s *OIDCService) Providers() []models.OIDCProvider {
+	list := make([]models.OIDCProvider, 0, len(s.order))
+	for _, id := range s.order {
+		list = append(list, models.OIDCProvider{
+			ID:       id,
+			Name:     s.providers[id].Name(),
+			LoginURL: "/api/auth/oidc/" + id + "/login",
+		})
+	}
+	return list
+}
+
+// start records a new authorization request and returns the provider url to send the user to,
+// along with the state the caller has to bind to the browser that is being sent there
+func (s *OIDCService) Start(ctx context.Context, providerID string) (string, string, error) {
+	provider, ok := s.providers[providerID]
+	if !ok {
+		return "", "", errors.NewNotFoundError("unknown provider")
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return "", "", errors.NewInternalError("login failed", err)
+	}
+	verifier, err := oidc.RandomString(32)
+	if err != nil {
+		return "", "", errors.NewInternalError("login failed", err)
+	}
+	nonce, err := oidc.RandomString(16)
+	if err != nil {
+		return "", "", errors.NewInternalError("login failed", err)
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, s.redirectURL, state, nonce, verifier)
+	if err != nil {
+		s.logger.WithError(err).WithField("provider", providerID).Error("failed to build authorization url")
+		return "", "", errors.NewBadGatewayError("identity provider unavailable", err)
+	}
+
+	now := time.Now().UTC()
+	err = s.stateRepo.Create(ctx, &models.OIDCState{
+		State:        state,
+		Provider:     providerID,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(OIDCStateTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// callback completes an authorization request: it exchanges the code, resolves the konbi
+// user behind the provider identity and signs them in the same way a password login does.
+// browserState is the state Start bound to the calling browser; it has to match the one
+// posted, or anyone holding a state and code could sign a victim into their own account.
+func (s *OIDCService) Callback(ctx context.Context, req *models.OIDCCallbackRequest, browserState string, client models.ClientInfo) (*models.AuthResponse, error) {
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(browserState), []byte(req.State)) != 1 {
+		s.logger.Warn("oidc callback state was not started by this browser")
+		s.authService.audit.Record(ctx, models.AuditLoginOIDC, models.AuditFailure, "", "", "login state not bound to this browser")
+		return nil, errors.NewBadRequestError("invalid or expired login state", nil)
+	}
+
+	state, err := s.stateRepo.Consume(ctx, req.State)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errors.NewBadRequestError("invalid or expired login state", nil)
+	}
+
+	provider, ok := s.providers[state.Provider]
+	if !ok {
+		// the provider was removed from the configuration while the user was away
+		return nil, errors.NewBadRequestError("unknown provider", nil)
+	}
+
+	claims, err := provider.Exchange(ctx, s.redirectURL, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		s.logger.WithError(err).WithField("provider", state.Provider).Warn("oidc code exchange failed")
+		s.authService.audit.Record(ctx, models.AuditLoginOIDC, models.AuditFailure, "", "", state.Provider+": code exchange failed")
+		return nil, errors.NewUnauthorizedError("sign-in with provider failed")
+	}
+
+	user, err := s.resolveUser(ctx, state.Provider, claims)
+	if err != nil {
+		s.authService.audit.RecordResult(ctx, models.AuditLoginOIDC, "", "", err)
+		return nil, err
+	}
+	if err := s.authService.checkActive(user); err != nil {
+		s.authService.audit.RecordResult(ctx, models.AuditLoginOIDC, models.AuditTargetUser, user.ID, err)
+		return nil, err
+	}
+
+	if s.authService.config.Security.RequireEmailVerification && user.EmailVerifiedAt == nil {
+		s.logger.WithField("user_id", user.ID).Warn("oidc login attempted before email verification")
+		err := errors.NewForbiddenError("email not verified")
+		s.authService.audit.RecordResult(ctx, models.AuditLoginOIDC, models.AuditTargetUser, user.ID, err)
+		return nil, err
+	}
+
+	// a provider login stands in for the password only; two-factor still applies
+	if user.TOTPEnabledAt != nil {
+		s.logger.WithField("user_id", user.ID).Info("provider login accepted, second factor required")
+		s.authService.audit.Record(ctx, models.AuditLoginOIDC, models.AuditSuccess, models.AuditTargetUser, user.ID, state.Provider+": second factor required")
+		return s.authService.mfaChallenge(user)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"provider": state.Provider,
+	}).Info("user logged in through provider")
+	s.authService.audit.Record(ctx, models.AuditLoginOIDC, models.AuditSuccess, models.AuditTargetUser, user.ID, state.Provider)
+
+	return s.authService.startSession(ctx, user, client)
+}
+
+// resolve user finds the user linked to the provider identity. an unlinked identity is linked to
+// the account with the same email only when the provider has verified that email; otherwise a new
+// account is created for it.
+func (s *OIDCService) resolveUser(ctx context.Context, providerID string, claims *oidc.Claims) (*models.User, error) {
+	now := time.Now().UTC()
+
+	identity, err := s.identityRepo.FindBySubject(ctx, providerID, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		if err := s.identityRepo.Touch(ctx, identity.ID, claims.Email, now); err != nil {
+			return nil, err
+		}
+		user, err := s.userRepo.GetByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, errors.NewInternalError("login failed", err)
+		}
+		if user == nil {
+			return nil, errors.NewUnauthorizedError("sign-in with provider failed")
+		}
+		return user, nil
+	}
+
+	if claims.Email == "" {
+		return nil, errors.NewBadRequestError("provider did not share an email address", nil)
+	}
+	verifiedEmail := claims.VerifiedEmail()
+
+	user, err := s.userRepo.GetByEmail(ctx, claims.Email)
+	if err != nil {
+		return nil, errors.NewInternalError("login failed", err)
+	}
+
+	if user != nil {
+		if verifiedEmail == "" {
+			s.logger.WithFields(logrus.Fields{
+				"user_id":  user.ID,
+				"provider": providerID,
+			}).Warn("refused to link provider identity with unverified email")
+			return nil, errors.NewConflictError("an account with this email already exists; sign in with your password to continue")
+		}
+		// the provider vouches for the address, so the account's email counts as verified too
+		if user.EmailVerifiedAt == nil {
+			if _, err := s.userRepo.MarkEmailVerified(ctx, user.ID, user.Email); err != nil {
+				return nil, err
+			}
+			user.EmailVerifiedAt = &now
+		}
+	} else {
+		// accounts created through a provider have no password until one is set through a reset
+		user = &models.User{
+			ID:        generateID(),
+			Email:     claims.Email,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if verifiedEmail != "" {
+			user.EmailVerifiedAt = &now
+		}
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return nil, err
+		}
+		s.logger.WithFields(logrus.Fields{
+			"user_id":  user.ID,
+			"provider": providerID,
+		}).Info("user registered through provider")
+
+		if user.EmailVerifiedAt == nil {
+			s.authService.sendVerification(ctx, user)
+		}
+	}
+
+	err = s.identityRepo.Create(ctx, &models.UserIdentity{
+		ID:          generateID(),
+		UserID:      user.ID,
+		Provider:    providerID,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		CreatedAt:   now,
+		LastLoginAt: &now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// cleanup expired removes authorization requests that were never completed
+func (s *OIDCService) CleanupExpired(ctx context.Context) (int64, error) {
+	return s.stateRepo.DeleteExpired(ctx)
+}
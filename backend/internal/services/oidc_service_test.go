@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"konbi/internal/config"
+	"konbi/internal/models"
+	"konbi/internal/oidc/oidctest"
+)
+
+// new oidc test env configures a provider "test" backed by a mock server
+func newOIDCTestEnv(t *testing.T) (*testEnv, *oidctest.Server) {
+	t.Helper()
+	srv := oidctest.NewServer(t)
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.OIDC.RedirectURL = "http://localhost:3000/auth/callback"
+		cfg.OIDC.Providers = []config.OIDCProviderConfig{{
+			ID:       "test",
+			Name:     "Test",
+			Issuer:   srv.URL,
+			ClientID: "konbi-test",
+			Scopes:   []string{"openid", "email"},
+		}}
+	})
+	return env, srv
+}
+
+// sign in starts a login, approves it at the provider as identity and posts the callback
+// from the browser that started it
+func signIn(t *testing.T, env *testEnv, srv *oidctest.Server, identity oidctest.Identity) (*models.AuthResponse, error) {
+	t.Helper()
+	req, browserState := startOIDCLogin(t, env, srv, identity)
+	return env.oidc.Callback(context.Background(), req, browserState, testClient)
+}
+
+// start oidc login returns the callback request the provider sends the user back with,
+// and the state Start bound to the browser
+func startOIDCLogin(t *testing.T, env *testEnv, srv *oidctest.Server, identity oidctest.Identity) (*models.OIDCCallbackRequest, string) {
+	t.Helper()
+	authURL, browserState, err := env.oidc.Start(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	code, state := srv.Authorize(t, authURL, identity)
+	if state != browserState {
+		t.Fatalf("provider returned state %q, want %q", state, browserState)
+	}
+	return &models.OIDCCallbackRequest{State: state, Code: code}, browserState
+}
+
+func TestOIDCCallbackCreatesAndLinksAccount(t *testing.T) {
+	ctx := context.Background()
+	env, srv := newOIDCTestEnv(t)
+	identity := oidctest.Identity{Subject: "sub-1", Email: "new@example.com", EmailVerified: true}
+
+	resp, err := signIn(t, env, srv, identity)
+	if err != nil {
+		t.Fatalf("first sign-in: %v", err)
+	}
+	if resp.AccessToken == "" || resp.RefreshToken == "" || resp.User == nil {
+		t.Fatalf("first sign-in response %+v has no session", resp)
+	}
+	user, err := env.userRepo.GetByID(ctx, resp.User.ID)
+	if err != nil || user == nil {
+		t.Fatalf("new account not stored: %v", err)
+	}
+	if user.Email != identity.Email || user.EmailVerifiedAt == nil {
+		t.Errorf("new account = %s verified %v, want %s verified", user.Email, user.EmailVerifiedAt, identity.Email)
+	}
+
+	linked, err := env.identityRepo.FindBySubject(ctx, "test", identity.Subject)
+	if err != nil || linked == nil {
+		t.Fatalf("identity not linked: %v", err)
+	}
+	if linked.UserID != resp.User.ID {
+		t.Errorf("identity linked to %s, want %s", linked.UserID, resp.User.ID)
+	}
+
+	// the subject identifies the user from then on, even once the provider's email changes
+	identity.Email = "renamed@example.com"
+	again, err := signIn(t, env, srv, identity)
+	if err != nil {
+		t.Fatalf("second sign-in: %v", err)
+	}
+	if again.User.ID != resp.User.ID {
+		t.Errorf("second sign-in user = %s, want %s", again.User.ID, resp.User.ID)
+	}
+}
+
+func TestOIDCCallbackExistingAccount(t *testing.T) {
+	tests := []struct {
+		name       string
+		verified   bool
+		wantStatus int // 0 links the identity to the existing account
+	}{
+		{name: "verified email links", verified: true},
+		{name: "unverified email conflicts", verified: false, wantStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env, srv := newOIDCTestEnv(t)
+			registered, err := env.auth.Register(ctx, &models.RegisterRequest{Email: "old@example.com", Password: "Password123!"}, testClient)
+			if err != nil {
+				t.Fatalf("register: %v", err)
+			}
+
+			resp, err := signIn(t, env, srv, oidctest.Identity{Subject: "sub-1", Email: "old@example.com", EmailVerified: tt.verified})
+			linked, findErr := env.identityRepo.FindBySubject(ctx, "test", "sub-1")
+			if findErr != nil {
+				t.Fatalf("find identity: %v", findErr)
+			}
+
+			if tt.wantStatus != 0 {
+				if got := statusCode(err); got != tt.wantStatus {
+					t.Fatalf("sign-in error = %v, want status %d", err, tt.wantStatus)
+				}
+				if linked != nil {
+					t.Error("identity was linked despite the unverified email")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("sign-in: %v", err)
+			}
+			if resp.User.ID != registered.User.ID || linked == nil || linked.UserID != registered.User.ID {
+				t.Errorf("sign-in user %s, identity %+v, want both on %s", resp.User.ID, linked, registered.User.ID)
+			}
+			if user, err := env.userRepo.GetByID(ctx, registered.User.ID); err != nil || user.EmailVerifiedAt == nil {
+				t.Errorf("linking through a verified provider email left the account unverified (%v)", err)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRequiresStartingBrowser(t *testing.T) {
+	ctx := context.Background()
+	env, srv := newOIDCTestEnv(t)
+
+	// the attacker's own login, completed from a victim's browser with no or another state cookie
+	req, browserState := startOIDCLogin(t, env, srv, oidctest.Identity{Subject: "attacker", Email: "attacker@example.com", EmailVerified: true})
+	_, otherState := startOIDCLogin(t, env, srv, oidctest.Identity{Subject: "victim"})
+
+	for _, cookie := range []string{"", otherState} {
+		if _, err := env.oidc.Callback(ctx, req, cookie, testClient); statusCode(err) != http.StatusBadRequest {
+			t.Errorf("callback with browser state %q: error = %v, want 400", cookie, err)
+		}
+	}
+
+	// refusing a foreign browser doesn't spend the state for the one that started the login
+	if _, err := env.oidc.Callback(ctx, req, browserState, testClient); err != nil {
+		t.Fatalf("callback from the starting browser: %v", err)
+	}
+	if _, err := env.oidc.Callback(ctx, req, browserState, testClient); statusCode(err) != http.StatusBadRequest {
+		t.Errorf("replayed callback: error = %v, want 400", err)
+	}
+}
+
+func TestOIDCCallbackRejectsForeignIssuer(t *testing.T) {
+	env, srv := newOIDCTestEnv(t)
+	req, browserState := startOIDCLogin(t, env, srv, oidctest.Identity{Subject: "sub-1", Email: "a@example.com", EmailVerified: true})
+	srv.TokenIssuer = "https://evil.example.com"
+
+	if _, err := env.oidc.Callback(context.Background(), req, browserState, testClient); statusCode(err) != http.StatusUnauthorized {
+		t.Fatalf("callback with a foreign id token issuer: error = %v, want 401", err)
+	}
+}
+
+func TestOIDCStartUnknownProvider(t *testing.T) {
+	env, _ := newOIDCTestEnv(t)
+	if _, _, err := env.oidc.Start(context.Background(), "missing"); statusCode(err) != http.StatusNotFound {
+		t.Fatalf("start with an unknown provider: error = %v, want 404", err)
+	}
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"konbi/internal/config"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/repository"
+	"konbi/internal/storage"
+
+	"github.com/sirupsen/logrus"
+)
+
+// quota enforces the per-owner storage quotas and the global capacity guard.
+// a user's usage is kept as counters on the user record: uploads charge them here and the
+// content repository gives them back in the same transaction that removes content. anonymous
+// uploads are counted per client address from the content table instead.
+type Quota struct {
+	userRepo    *repository.UserRepository
+	contentRepo *repository.ContentRepository
+	storage     storage.Backend
+	config      *config.Config
+	logger      *logrus.Logger
+}
+
+// create new quota enforcer
+func NewQuota(userRepo *repository.UserRepository, contentRepo *repository.ContentRepository, store storage.Backend, cfg *config.Config, logger *logrus.Logger) *Quota {
+	return &Quota{
+		userRepo:    userRepo,
+		contentRepo: contentRepo,
+		storage:     store,
+		config:      cfg,
+		logger:      logger,
+	}
+}
+
+// check refuses an upload up front when the server is at capacity or the owner couldn't fit
+// items more shares and bytes more bytes. size often isn't known until the upload has been
+// streamed, so Charge checks again with the real size.
+func (q *Quota) Check(ctx context.Context, userID string, bytes int64, items int) error {
+	if err := q.CheckCapacity(ctx); err != nil {
+		return err
+	}
+
+	if userID != "" {
+		user, err := q.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return errors.NewUnauthorizedError("account not found")
+		}
+		return exceeds(q.Usage(user), bytes, items)
+	}
+
+	usage, err := q.addressUsage(ctx)
+	if err != nil || usage == nil {
+		return err
+	}
+	return exceeds(usage, bytes, items)
+}
+
+// charge counts a stored share against its owner. a user's counters are updated atomically
+// with the check; for anonymous uploads the share's own record is the charge, so this only checks.
+func (q *Quota) Charge(ctx context.Context, userID string, bytes int64, items int) error {
+	if userID == "" {
+		return q.Check(ctx, "", bytes, items)
+	}
+
+	ok, err := q.userRepo.ChargeStorage(ctx, userID, bytes, items, q.config.Storage.UserQuotaBytes, q.config.Storage.UserQuotaItems)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		q.logger.WithFields(logrus.Fields{"user_id": userID, "bytes": bytes, "items": items}).Warn("storage quota exceeded")
+		// say which limit was hit when the account can still be read
+		if user, err := q.userRepo.GetByID(ctx, userID); err == nil && user != nil {
+			if err := exceeds(q.Usage(user), bytes, items); err != nil {
+				return err
+			}
+		}
+		return errors.NewQuotaExceededError("storage quota exceeded")
+	}
+	return nil
+}
+
+// refund gives back a charge for a share that ended up not being saved
+func (q *Quota) Refund(ctx context.Context, userID string, bytes int64, items int) {
+	if userID == "" {
+		return
+	}
+	if err := q.userRepo.AddStorage(context.WithoutCancel(ctx), userID, -bytes, -items); err != nil {
+		q.logger.WithError(err).WithField("user_id", userID).Error("failed to refund storage charge")
+	}
+}
+
+// check capacity refuses new uploads once the stored bytes or the upload directory's disk
+// reach the configured high-watermark
+func (q *Quota) CheckCapacity(ctx context.Context) error {
+	if max := q.config.Storage.MaxTotalBytes; max > 0 {
+		total, err := q.contentRepo.TotalStoredBytes(ctx)
+		if err != nil {
+			return err
+		}
+		if total >= max {
+			q.logger.WithFields(logrus.Fields{"stored_bytes": total, "max_bytes": max}).Warn("storage capacity reached")
+			return errors.NewQuotaExceededError("server storage is full, try again later")
+		}
+	}
+
+	percent := q.config.Storage.HighWatermarkPercent
+	reporter, ok := q.storage.(storage.CapacityReporter)
+	if percent <= 0 || !ok {
+		return nil
+	}
+	used, total, err := reporter.Capacity(ctx)
+	if err != nil || total == 0 {
+		// an unknown fill level shouldn't stop uploads; the write itself fails on a full disk
+		q.logger.WithError(err).Debug("storage capacity unavailable")
+		return nil
+	}
+	if used*100 >= total*uint64(percent) {
+		q.logger.WithFields(logrus.Fields{"used_bytes": used, "total_bytes": total, "watermark_percent": percent}).Warn("storage high-watermark reached")
+		return errors.NewQuotaExceededError("server storage is full, try again later")
+	}
+	return nil
+}
+
+// usage returns user's storage usage with the quota that applies: their override, or the default
+func (q *Quota) Usage(user *models.User) *models.StorageUsage {
+	usage := &models.StorageUsage{
+		Items:      user.StorageItems,
+		Bytes:      user.StorageBytes,
+		QuotaItems: q.config.Storage.UserQuotaItems,
+		QuotaBytes: q.config.Storage.UserQuotaBytes,
+	}
+	if user.QuotaItems != nil {
+		usage.QuotaItems = *user.QuotaItems
+	}
+	if user.QuotaBytes != nil {
+		usage.QuotaBytes = *user.QuotaBytes
+	}
+	return usage
+}
+
+// uploader address returns the client address anonymous uploads are counted against,
+// empty outside a request
+func uploaderAddress(ctx context.Context) *string {
+	if info := RequestInfoFrom(ctx); info != nil && info.IP != "" {
+		return &info.IP
+	}
+	return nil
+}
+
+// address usage returns the anonymous usage of the calling address with its quota,
+// nil when there is no address to count against
+func (q *Quota) addressUsage(ctx context.Context) (*models.StorageUsage, error) {
+	ip := uploaderAddress(ctx)
+	if ip == nil {
+		return nil, nil
+	}
+	usage, err := q.contentRepo.UsageByAddress(ctx, *ip)
+	if err != nil {
+		return nil, err
+	}
+	usage.QuotaItems = q.config.Storage.AnonymousQuotaItems
+	usage.QuotaBytes = q.config.Storage.AnonymousQuotaBytes
+	return usage, nil
+}
+
+// exceeds reports a quota error if usage can't take bytes and items more
+func exceeds(usage *models.StorageUsage, bytes int64, items int) error {
+	if usage.QuotaItems > 0 && usage.Items+items > usage.QuotaItems {
+		return errors.NewQuotaExceededError(fmt.Sprintf("share limit of %d reached", usage.QuotaItems))
+	}
+	if usage.QuotaBytes > 0 && usage.Bytes+bytes > usage.QuotaBytes {
+		return errors.NewQuotaExceededError(fmt.Sprintf("storage quota of %dMB exceeded", usage.QuotaBytes/1024/1024))
+	}
+	return nil
+}
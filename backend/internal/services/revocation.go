@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// revocation store remembers access tokens (by jti) that were revoked before they expired.
+// entries only need to outlive the token, so Prune may drop them after expiresAt.
+type RevocationStore interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	Prune(ctx context.Context) (int64, error)
+}
+
+// memory revocation store keeps revocations in process.
+// suitable for a single instance; revocations are lost on restart.
+type MemoryRevocationStore struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+// create new in-memory revocation store
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// revoke records jti as revoked until expiresAt
+func (m *MemoryRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+// is revoked reports whether jti has been revoked
+func (m *MemoryRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
+
+// prune forgets revocations of tokens that have expired anyway
+func (m *MemoryRevocationStore) Prune(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var count int64
+	for jti, expiresAt := range m.revoked {
+		if expiresAt.Before(now) {
+			delete(m.revoked, jti)
+			count++
+		}
+	}
+	return count, nil
+}
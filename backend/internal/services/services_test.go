@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"konbi/internal/config"
+	"konbi/internal/errors"
+	"konbi/internal/mail"
+	"konbi/internal/models"
+	"konbi/internal/repository"
+	"konbi/internal/storage"
+
+	"github.com/sirupsen/logrus"
+)
+
+// test client is the browser every test request comes from
+var testClient = models.ClientInfo{UserAgent: "konbi-test", IPAddress: "192.0.2.1"}
+
+// test env wires the services the way main.go does, over a fresh sqlite database.
+// mail goes to the file mailer in mailDir.
+type testEnv struct {
+	db      *sql.DB
+	dialect repository.Dialect
+	cfg     *config.Config
+	mailDir string
+
+	userRepo     *repository.UserRepository
+	identityRepo *repository.IdentityRepository
+
+	auth    *AuthService
+	content *ContentService
+	oidc    *OIDCService
+}
+
+// test logger discards output
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// test db opens a migrated sqlite database that is removed when the test ends
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := repository.NewMigrator(db, repository.SQLiteDialect{}, testLogger())
+	if err != nil {
+		t.Fatalf("new migrator: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	return db
+}
+
+// new test env builds the services; configure, if given, adjusts the config first
+func newTestEnv(t *testing.T, configure func(cfg *config.Config)) *testEnv {
+	t.Helper()
+	ctx := context.Background()
+	logger := testLogger()
+
+	cfg := config.Load()
+	cfg.Storage.Backend = "local"
+	cfg.Storage.UploadDir = t.TempDir()
+	cfg.Mail.Backend = "file"
+	cfg.Mail.FileDir = t.TempDir()
+	if configure != nil {
+		configure(cfg)
+	}
+
+	db := testDB(t)
+	dialect := repository.SQLiteDialect{}
+	store, err := storage.New(ctx, cfg.Storage)
+	if err != nil {
+		t.Fatalf("new storage: %v", err)
+	}
+	mailer, err := mail.New(cfg.Mail, logger)
+	if err != nil {
+		t.Fatalf("new mailer: %v", err)
+	}
+	keys, err := LoadSigningKeys(cfg.Server)
+	if err != nil {
+		t.Fatalf("load signing keys: %v", err)
+	}
+
+	env := &testEnv{
+		db:           db,
+		dialect:      dialect,
+		cfg:          cfg,
+		mailDir:      cfg.Mail.FileDir,
+		userRepo:     repository.NewUserRepository(db, dialect, logger),
+		identityRepo: repository.NewIdentityRepository(db, dialect, logger),
+	}
+	contentRepo := repository.NewContentRepository(db, dialect, logger)
+	throttle := NewThrottle(repository.NewAttemptRepository(db, dialect, logger), cfg.Security, logger)
+	audit := NewAuditLogger(repository.NewAuditRepository(db, dialect, logger), cfg, logger)
+	quota := NewQuota(env.userRepo, contentRepo, store, cfg, logger)
+
+	env.content = NewContentService(contentRepo, store, throttle, quota, audit, cfg, logger)
+	env.auth = NewAuthService(
+		env.userRepo,
+		repository.NewRefreshTokenRepository(db, dialect, logger),
+		repository.NewUserTokenRepository(db, dialect, logger),
+		repository.NewRecoveryCodeRepository(db, dialect, logger),
+		repository.NewRevokedTokenRepository(db, dialect, logger),
+		keys, throttle, mailer, audit, cfg, logger,
+	)
+	env.oidc = NewOIDCService(env.userRepo, env.identityRepo, repository.NewOIDCStateRepository(db, dialect, logger), env.auth, cfg, logger)
+	return env
+}
+
+// status code returns the http status of an app error, or 0 for anything else
+func statusCode(err error) int {
+	if appErr, ok := err.(*errors.AppError); ok {
+		return appErr.StatusCode
+	}
+	return 0
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"konbi/internal/config"
+	"konbi/internal/errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// attempt store counts attempts per key that haven't succeeded. a count is forgotten once
+// its window passes without another attempt, so Prune may drop it then.
+type AttemptStore interface {
+	// reserve counts an attempt at now unless key is locked, deciding both in one step so
+	// concurrent attempts can't all pass before any of them is counted. lockout maps a count
+	// to how long the key stays locked after the latest attempt. returns the remaining lockout
+	// if the attempt is refused, else 0 and the new count.
+	Reserve(ctx context.Context, key string, now time.Time, window time.Duration, lockout func(int) time.Duration) (time.Duration, int, error)
+	Reset(ctx context.Context, key string) error
+	Prune(ctx context.Context) (int64, error)
+}
+
+// memory attempt store keeps counters in process.
+// suitable for a single instance; counters are lost on restart.
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*memoryAttempt
+}
+
+type memoryAttempt struct {
+	failures    int
+	lastFailure time.Time
+	expiresAt   time.Time
+}
+
+// create new in-memory attempt store
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{
+		attempts: make(map[string]*memoryAttempt),
+	}
+}
+
+// reserve counts an attempt at now unless key is locked
+func (m *MemoryAttemptStore) Reserve(ctx context.Context, key string, now time.Time, window time.Duration, lockout func(int) time.Duration) (time.Duration, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attempts[key]
+	if !ok || !a.expiresAt.After(now) {
+		a = &memoryAttempt{}
+		m.attempts[key] = a
+	}
+	if remaining := a.lastFailure.Add(lockout(a.failures)).Sub(now); a.failures > 0 && remaining > 0 {
+		return remaining, a.failures, nil
+	}
+	a.failures++
+	a.lastFailure = now
+	a.expiresAt = now.Add(window)
+	return 0, a.failures, nil
+}
+
+// reset forgets the failures of key
+func (m *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+// prune drops counters whose window has passed
+func (m *MemoryAttemptStore) Prune(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var count int64
+	for key, a := range m.attempts {
+		if !a.expiresAt.After(now) {
+			delete(m.attempts, key)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// throttle slows down guessing of passwords and passcodes. the first few failures
+// for a key are free; after that each failure locks the key for exponentially longer.
+type Throttle struct {
+	store        AttemptStore
+	freeAttempts int
+	base         time.Duration
+	max          time.Duration
+	window       time.Duration
+	logger       *logrus.Logger
+}
+
+// create new throttle
+func NewThrottle(store AttemptStore, cfg config.SecurityConfig, logger *logrus.Logger) *Throttle {
+	return &Throttle{
+		store:        store,
+		freeAttempts: cfg.LockoutFreeAttempts,
+		base:         cfg.LockoutBase,
+		max:          cfg.LockoutMax,
+		window:       cfg.LockoutWindow,
+		logger:       logger,
+	}
+}
+
+// attempt counts an attempt for key before it is verified, or returns a 429 error carrying
+// the remaining lockout if key is locked. the attempt counts as a failure until Succeed clears
+// it, so a burst of concurrent guesses is throttled just like the same guesses one by one.
+func (t *Throttle) Attempt(ctx context.Context, key string) error {
+	remaining, failures, err := t.store.Reserve(ctx, key, time.Now().UTC(), t.window, t.lockout)
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		t.logger.WithField("key", key).Warn("attempt rejected during lockout")
+		return errors.NewTooManyAttemptsError(remaining)
+	}
+	if lockout := t.lockout(failures); lockout > 0 {
+		t.logger.WithFields(logrus.Fields{
+			"key":      key,
+			"failures": failures,
+			"lockout":  lockout.String(),
+		}).Warn("too many failed attempts, locking out")
+	}
+	return nil
+}
+
+// succeed clears the failures of key after a successful attempt, its own included
+func (t *Throttle) Succeed(ctx context.Context, key string) {
+	if err := t.store.Reset(ctx, key); err != nil {
+		t.logger.WithError(err).WithField("key", key).Error("failed to reset failed attempts")
+	}
+}
+
+// prune drops counters that have expired
+func (t *Throttle) Prune(ctx context.Context) (int64, error) {
+	return t.store.Prune(ctx)
+}
+
+// lockout returns how long a key stays locked after its latest failure
+func (t *Throttle) lockout(failures int) time.Duration {
+	over := failures - t.freeAttempts
+	if over <= 0 {
+		return 0
+	}
+	lockout := t.base
+	for i := 1; i < over && lockout < t.max; i++ {
+		lockout *= 2
+	}
+	if lockout > t.max {
+		lockout = t.max
+	}
+	return lockout
+}
+
+// login attempt key is the throttle key for password checks of an account
+func loginAttemptKey(email string) string {
+	return "login:" + strings.ToLower(email)
+}
+
+// passcode attempt key is the throttle key for passcode checks of a share
+func passcodeAttemptKey(contentID string) string {
+	return "passcode:" + contentID
+}
+
+// mfa attempt key is the throttle key for second factor checks of an account
+func mfaAttemptKey(userID string) string {
+	return "mfa:" + userID
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"konbi/internal/config"
+	"konbi/internal/models"
+	"konbi/internal/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testLockout = config.SecurityConfig{
+	LockoutFreeAttempts: 3,
+	LockoutBase:         time.Minute,
+	LockoutMax:          time.Hour,
+	LockoutWindow:       time.Hour,
+}
+
+// test attempt stores returns one of each store, the database one over sqlite
+func testAttemptStores(t *testing.T) map[string]AttemptStore {
+	return map[string]AttemptStore{
+		"memory":   NewMemoryAttemptStore(),
+		"database": repository.NewAttemptRepository(testDB(t), repository.SQLiteDialect{}, testLogger()),
+	}
+}
+
+func TestThrottleLocksOut(t *testing.T) {
+	for name, store := range testAttemptStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			throttle := NewThrottle(store, testLockout, testLogger())
+
+			// the free attempts and the one that reaches the limit go through
+			for i := 0; i <= testLockout.LockoutFreeAttempts; i++ {
+				if err := throttle.Attempt(ctx, "login:a"); err != nil {
+					t.Fatalf("attempt %d: %v", i+1, err)
+				}
+			}
+			err := throttle.Attempt(ctx, "login:a")
+			if statusCode(err) != http.StatusTooManyRequests {
+				t.Fatalf("attempt past the limit: error = %v, want 429", err)
+			}
+
+			// other keys are unaffected, and a success clears the count
+			if err := throttle.Attempt(ctx, "login:b"); err != nil {
+				t.Fatalf("attempt on another key: %v", err)
+			}
+			throttle.Succeed(ctx, "login:a")
+			if err := throttle.Attempt(ctx, "login:a"); err != nil {
+				t.Fatalf("attempt after success: %v", err)
+			}
+		})
+	}
+}
+
+func TestThrottleConcurrentAttempts(t *testing.T) {
+	const attempts = 25
+
+	for name, store := range testAttemptStores(t) {
+		t.Run(name, func(t *testing.T) {
+			throttle := NewThrottle(store, testLockout, testLogger())
+
+			var allowed, locked atomic.Int64
+			var wg sync.WaitGroup
+			for range attempts {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					switch err := throttle.Attempt(context.Background(), "passcode:x"); statusCode(err) {
+					case 0:
+						if err != nil {
+							t.Errorf("attempt: %v", err)
+							return
+						}
+						allowed.Add(1)
+					case http.StatusTooManyRequests:
+						locked.Add(1)
+					default:
+						t.Errorf("attempt: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if want := int64(testLockout.LockoutFreeAttempts + 1); allowed.Load() != want || locked.Load() != attempts-want {
+				t.Errorf("allowed %d, locked %d of %d concurrent attempts; want %d allowed", allowed.Load(), locked.Load(), attempts, want)
+			}
+		})
+	}
+}
+
+// a burst of concurrent wrong passcodes for a share gets no more guesses than the same
+// guesses one after another
+func TestVerifyPasscodeConcurrentGuesses(t *testing.T) {
+	const guesses = 20
+	env := newTestEnv(t, func(cfg *config.Config) { cfg.Security = testLockout })
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("1234"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash passcode: %v", err)
+	}
+	passcodeHash := string(hash)
+	content := &models.Content{ID: "share-1", PasscodeHash: &passcodeHash}
+
+	var wrong, locked atomic.Int64
+	var wg sync.WaitGroup
+	for range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := env.content.VerifyPasscode(context.Background(), content, "0000"); statusCode(err) {
+			case http.StatusForbidden:
+				wrong.Add(1)
+			case http.StatusTooManyRequests:
+				locked.Add(1)
+			default:
+				t.Errorf("guess: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if want := int64(testLockout.LockoutFreeAttempts + 1); wrong.Load() != want {
+		t.Errorf("%d of %d concurrent guesses were checked, want %d; %d locked out", wrong.Load(), guesses, want, locked.Load())
+	}
+}
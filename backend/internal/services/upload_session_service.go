@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"konbi/internal/config"
+	"konbi/internal/errors"
+	"konbi/internal/models"
+	"konbi/internal/repository"
+	"konbi/internal/storage"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// upload session service handles resumable uploads: chunks are stored as separate
+// blobs and stitched into a regular file content record on completion
+type UploadSessionService struct {
+	repo           *repository.UploadSessionRepository
+	storage        storage.Backend
+	contentService *ContentService
+	config         *config.Config
+	logger         *logrus.Logger
+}
+
+// create new upload session service
+func NewUploadSessionService(repo *repository.UploadSessionRepository, store storage.Backend, contentService *ContentService, cfg *config.Config, logger *logrus.Logger) *UploadSessionService {
+	return &UploadSessionService{
+		repo:           repo,
+		storage:        store,
+		contentService: contentService,
+		config:         cfg,
+		logger:         logger,
+	}
+}
+
+// create session starts a resumable upload
+func (s *UploadSessionService) CreateSession(ctx context.Context, req *models.CreateUploadSessionRequest) (*models.UploadSession, error) {
+	// reject disallowed names before any bytes are sent; the content is checked on completion
+	if _, err := s.contentService.checkFileType(req.Filename, ""); err != nil {
+		return nil, err
+	}
+	if req.Size != nil {
+		if *req.Size < 0 {
+			return nil, errors.NewBadRequestError("size must not be negative", nil)
+		}
+		if *req.Size > s.config.Storage.MaxFileSize {
+			return nil, errors.NewFileTooLargeError(s.config.Storage.MaxFileSize)
+		}
+	}
+	// the uploader's quota is checked on completion, when it is known who they are
+	if err := s.contentService.quota.CheckCapacity(ctx); err != nil {
+		return nil, err
+	}
+
+	// the token stands in for the creator on every later request, signed in or not
+	token, tokenHash, err := newSecretToken()
+	if err != nil {
+		return nil, errors.NewInternalError("failed to generate upload token", err)
+	}
+
+	now := time.Now().UTC()
+	session := &models.UploadSession{
+		ID:        uuid.New().String(),
+		Filename:  req.Filename,
+		TotalSize: req.Size,
+		Status:    models.UploadSessionActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(s.config.Storage.UploadSessionTTL),
+		UserID:    ownerID(req.UserID),
+		TokenHash: &tokenHash,
+		Token:     token,
+	}
+
+	if err := s.repo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"session_id": session.ID,
+		"filename":   req.Filename,
+	}).Info("upload session created")
+
+	return session, nil
+}
+
+// get session returns the current state of an upload session
+func (s *UploadSessionService) GetSession(ctx context.Context, id, token string) (*models.UploadSession, error) {
+	return s.findSession(ctx, id, token)
+}
+
+// find session loads an active session for a request presenting its upload token.
+// sessions started before tokens existed have none and can't be continued.
+func (s *UploadSessionService) findSession(ctx context.Context, id, token string) (*models.UploadSession, error) {
+	if token == "" {
+		return nil, errors.NewUnauthorizedError("upload token required")
+	}
+	session, err := s.repo.FindActiveByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !tokenMatches(token, session.TokenHash) {
+		s.logger.WithField("session_id", id).Warn("upload session accessed with wrong token")
+		return nil, errors.NewForbiddenError("not allowed to use this upload session")
+	}
+	return session, nil
+}
+
+// append chunk stores the bytes of r as the chunk starting at offset and returns the new offset.
+// a chunk is only accepted at the session's current offset; an interrupted chunk is discarded
+// and the client resumes from the offset reported by GetSession.
+func (s *UploadSessionService) AppendChunk(ctx context.Context, id, token string, offset int64, r io.Reader) (int64, error) {
+	session, err := s.findSession(ctx, id, token)
+	if err != nil {
+		return 0, err
+	}
+	if session.Status != models.UploadSessionActive {
+		return session.Offset, errors.NewConflictError("upload session is being finalized")
+	}
+	if offset != session.Offset {
+		return session.Offset, errors.NewConflictError("upload offset mismatch")
+	}
+	if err := s.contentService.quota.CheckCapacity(ctx); err != nil {
+		return session.Offset, err
+	}
+
+	// remaining bytes this session may still accept
+	remaining := s.config.Storage.MaxFileSize - offset
+	limitedByDeclaredSize := false
+	if session.TotalSize != nil && *session.TotalSize-offset < remaining {
+		remaining = *session.TotalSize - offset
+		limitedByDeclaredSize = true
+	}
+
+	key := fmt.Sprintf("sessions/%s/%d-%s", id, offset, uuid.New().String())
+	// detached from the request timeout: the chunk body can legitimately take longer than a db query
+	size, err := s.storage.Put(context.WithoutCancel(ctx), key, io.LimitReader(r, remaining+1))
+	if err != nil {
+		s.deleteBlob(key)
+		s.logger.WithError(err).WithField("session_id", id).Warn("failed to store upload chunk")
+		return session.Offset, errors.NewInternalError("failed to store chunk", err)
+	}
+	if size > remaining {
+		s.deleteBlob(key)
+		if limitedByDeclaredSize {
+			return session.Offset, errors.NewBadRequestError("chunk exceeds declared upload size", nil)
+		}
+		return session.Offset, errors.NewFileTooLargeError(s.config.Storage.MaxFileSize)
+	}
+	if size == 0 {
+		s.deleteBlob(key)
+		return session.Offset, nil
+	}
+
+	chunk := &models.UploadChunk{
+		SessionID:   id,
+		StartOffset: offset,
+		Size:        size,
+		StorageKey:  key,
+	}
+	ok, err := s.repo.AppendChunk(ctx, chunk, time.Now().UTC().Add(s.config.Storage.UploadSessionTTL))
+	if err != nil {
+		s.deleteBlob(key)
+		return session.Offset, err
+	}
+	if !ok {
+		// another request advanced the session while this chunk was streaming
+		s.deleteBlob(key)
+		current, err := s.repo.FindActiveByID(ctx, id)
+		if err != nil {
+			return session.Offset, err
+		}
+		return current.Offset, errors.NewConflictError("upload offset mismatch")
+	}
+
+	return offset + size, nil
+}
+
+// complete session assembles the chunks into a regular file content via ContentService
+func (s *UploadSessionService) CompleteSession(ctx context.Context, id, token string, req *models.CompleteUploadSessionRequest) (*models.Content, error) {
+	session, err := s.findSession(ctx, id, token)
+	if err != nil {
+		return nil, err
+	}
+	if session.TotalSize != nil && session.Offset != *session.TotalSize {
+		return nil, errors.NewConflictError(fmt.Sprintf("upload incomplete: %d of %d bytes received", session.Offset, *session.TotalSize))
+	}
+
+	// claim the session so concurrent completes or late chunks can't race the assembly
+	claimed, err := s.repo.SetStatus(ctx, id, models.UploadSessionActive, models.UploadSessionFinalizing)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, errors.NewConflictError("upload session is being finalized")
+	}
+
+	chunks, err := s.repo.FindChunks(ctx, id)
+	if err != nil {
+		s.releaseSession(id)
+		return nil, err
+	}
+
+	keys := chunkKeys(chunks)
+
+	// the share belongs to whoever started the upload, not whoever completes it
+	userID := ""
+	if session.UserID != nil {
+		userID = *session.UserID
+	}
+
+	reader := &chunkReader{ctx: context.WithoutCancel(ctx), storage: s.storage, keys: keys}
+	content, err := s.contentService.UploadFile(ctx, &models.UploadRequest{
+		File:         reader,
+		Filename:     session.Filename,
+		Passcode:     req.Passcode,
+		UserID:       userID,
+		ShareOptions: req.ShareOptions,
+	})
+	reader.Close()
+	if err != nil {
+		s.releaseSession(id)
+		return nil, err
+	}
+
+	s.removeSession(ctx, id, keys)
+
+	s.logger.WithFields(logrus.Fields{
+		"session_id": id,
+		"content_id": content.ID,
+		"chunks":     len(chunks),
+	}).Info("upload session completed")
+
+	return content, nil
+}
+
+// abort session discards an upload session and its chunks
+func (s *UploadSessionService) AbortSession(ctx context.Context, id, token string) error {
+	if _, err := s.findSession(ctx, id, token); err != nil {
+		return err
+	}
+
+	chunks, err := s.repo.FindChunks(ctx, id)
+	if err != nil {
+		return err
+	}
+	s.removeSession(ctx, id, chunkKeys(chunks))
+	return nil
+}
+
+// cleanup expired removes abandoned sessions and their chunk blobs
+func (s *UploadSessionService) CleanupExpired(ctx context.Context) (int, error) {
+	ids, err := s.repo.FindExpired(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, id := range ids {
+		chunks, err := s.repo.FindChunks(ctx, id)
+		if err != nil {
+			s.logger.WithError(err).WithField("session_id", id).Error("failed to load chunks of expired upload session")
+			continue
+		}
+		s.removeSession(ctx, id, chunkKeys(chunks))
+		removed++
+	}
+
+	if removed > 0 {
+		s.logger.WithField("removed_sessions", removed).Info("expired upload sessions removed")
+	}
+	return removed, nil
+}
+
+// remove session deletes chunk blobs, then the session records
+func (s *UploadSessionService) removeSession(ctx context.Context, id string, keys []string) {
+	for _, key := range keys {
+		s.deleteBlob(key)
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		s.logger.WithError(err).WithField("session_id", id).Error("failed to delete upload session")
+	}
+}
+
+// release session returns a session to active after a failed completion so the client can retry
+func (s *UploadSessionService) releaseSession(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := s.repo.SetStatus(ctx, id, models.UploadSessionFinalizing, models.UploadSessionActive); err != nil {
+		s.logger.WithError(err).WithField("session_id", id).Error("failed to release upload session")
+	}
+}
+
+// delete blob removes a stored chunk, logging instead of failing
+func (s *UploadSessionService) deleteBlob(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.storage.Delete(ctx, key); err != nil {
+		s.logger.WithError(err).WithField("key", key).Error("failed to delete chunk")
+	}
+}
+
+// chunk keys lists the storage keys of chunks in order
+func chunkKeys(chunks []*models.UploadChunk) []string {
+	keys := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		keys = append(keys, chunk.StorageKey)
+	}
+	return keys
+}
+
+// chunk reader concatenates chunk blobs, opening each one only once the previous is drained
+type chunkReader struct {
+	ctx     context.Context
+	storage storage.Backend
+	keys    []string
+	current io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.keys) == 0 {
+				return 0, io.EOF
+			}
+			rc, err := r.storage.Get(r.ctx, r.keys[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current = rc
+			r.keys = r.keys[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		err := r.current.Close()
+		r.current = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// local backend stores blobs as files under a root directory
+type LocalBackend struct {
+	root string
+}
+
+// create new local backend, making sure the root directory exists
+func NewLocalBackend(root string) (*LocalBackend, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return &LocalBackend{root: root}, nil
+}
+
+// path maps a key to a file path inside root.
+// keys written before the storage abstraction were full paths ("uploads/AbC123Xy.pdf"),
+// so a leading root prefix is stripped to keep those records readable.
+func (l *LocalBackend) path(key string) (string, error) {
+	root := filepath.Clean(l.root)
+	name := filepath.Clean(filepath.FromSlash(key))
+	if rel, ok := strings.CutPrefix(name, root+string(filepath.Separator)); ok {
+		name = rel
+	}
+
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(root, name), nil
+}
+
+// put writes to a temp file first so readers never observe a partial blob
+func (l *LocalBackend) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+
+	return written, nil
+}
+
+// get opens the file behind key
+func (l *LocalBackend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// get range opens the file and seeks to offset, limiting reads to length bytes
+func (l *LocalBackend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	rc, err := l.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	f := rc.(*os.File)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
+// limited read closer pairs a limited reader with the closer of the underlying file
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// delete removes the file behind key
+func (l *LocalBackend) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// prune directories left empty by nested keys ("sessions/<id>/..."); removal of a
+	// non-empty directory fails, which ends the walk
+	root := filepath.Clean(l.root)
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// stat returns file metadata
+func (l *LocalBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:     key,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// exists reports whether the file behind key is present
+func (l *LocalBackend) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := l.Stat(ctx, key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// capacity isn't available on this platform; the high-watermark check is skipped
+func (l *LocalBackend) Capacity(ctx context.Context) (uint64, uint64, error) {
+	return 0, 0, errors.ErrUnsupported
+}
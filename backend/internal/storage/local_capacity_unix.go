@@ -0,0 +1,21 @@
+//go:build unix
+
+package storage
+
+import (
+	"context"
+
+	"golang.org/x/sys/unix"
+)
+
+// capacity reports the usage of the filesystem holding the upload directory
+func (l *LocalBackend) Capacity(ctx context.Context) (uint64, uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(l.root, &st); err != nil {
+		return 0, 0, err
+	}
+	total := st.Blocks * uint64(st.Bsize)
+	// bavail rather than bfree: blocks reserved for root aren't available to the server either
+	used := total - st.Bavail*uint64(st.Bsize)
+	return used, total, nil
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"konbi/internal/config"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// part size used for streaming uploads of unknown length.
+// bounds memory per in-flight upload instead of letting the client pick a huge default.
+const s3PartSize = 16 * 1024 * 1024
+
+// s3 backend stores blobs in an s3-compatible bucket (AWS S3, MinIO, R2, ...)
+type S3Backend struct {
+	client *minio.Client
+	core   *minio.Core
+	bucket string
+}
+
+// create new s3 backend and verify the bucket is reachable
+func NewS3Backend(ctx context.Context, cfg config.S3Config) (*S3Backend, error) {
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(stripScheme(cfg.Endpoint), &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       cfg.UseSSL,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach s3 bucket %q: %w", cfg.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("s3 bucket %q does not exist", cfg.Bucket)
+	}
+
+	return &S3Backend{
+		client: client,
+		core:   &minio.Core{Client: client},
+		bucket: cfg.Bucket,
+	}, nil
+}
+
+// put streams r into the bucket using a multipart upload of unknown size
+func (b *S3Backend) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	// unsigned payload avoids aws-chunked streaming signatures, which several
+	// s3-compatible services don't implement; integrity is left to TLS
+	info, err := b.client.PutObject(ctx, b.bucket, key, r, -1, minio.PutObjectOptions{
+		ContentType:          "application/octet-stream",
+		PartSize:             s3PartSize,
+		DisableContentSha256: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// get opens the object for reading
+func (b *S3Backend) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return b.getObject(ctx, key, minio.GetObjectOptions{})
+}
+
+// get range fetches only the requested byte range from the bucket
+func (b *S3Backend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, err
+	}
+	return b.getObject(ctx, key, opts)
+}
+
+// get object sends the GET right away, unlike the lazy client.GetObject, so a missing
+// key surfaces as ErrNotFound here without a separate stat round trip
+func (b *S3Backend) getObject(ctx context.Context, key string, opts minio.GetObjectOptions) (io.ReadCloser, error) {
+	body, _, _, err := b.core.GetObject(ctx, b.bucket, key, opts)
+	if err != nil {
+		return nil, translateS3Error(err)
+	}
+	return body, nil
+}
+
+// delete removes the object; s3 treats missing keys as success
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	return translateS3Error(b.client.RemoveObject(ctx, b.bucket, key, minio.RemoveObjectOptions{}))
+}
+
+// stat returns object metadata
+func (b *S3Backend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := b.client.StatObject(ctx, b.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, translateS3Error(err)
+	}
+	return &ObjectInfo{
+		Key:     key,
+		Size:    info.Size,
+		ModTime: info.LastModified,
+	}, nil
+}
+
+// exists reports whether the object is present
+func (b *S3Backend) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := b.Stat(ctx, key)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// translate s3 error maps "no such key" responses onto ErrNotFound
+func translateS3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
+
+// strip scheme lets S3_ENDPOINT be given as a url; minio expects host[:port]
+func stripScheme(endpoint string) string {
+	endpoint = strings.TrimPrefix(endpoint, "https://")
+	endpoint = strings.TrimPrefix(endpoint, "http://")
+	return strings.TrimSuffix(endpoint, "/")
+}
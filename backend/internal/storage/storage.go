@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"konbi/internal/config"
+	"time"
+)
+
+// err not found is returned when a key does not exist in the backend
+var ErrNotFound = errors.New("object not found")
+
+// object info describes a stored blob
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// backend abstracts where uploaded blobs live (local disk, s3-compatible bucket, ...)
+// keys are slash-separated relative names such as "AbC123Xy.pdf"
+type Backend interface {
+	// put streams r into key and returns the number of bytes written
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// get opens key for reading; the caller must close the reader
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// get range opens length bytes of key starting at offset
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// stat returns metadata for key or ErrNotFound
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// exists reports whether key is present
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// capacity reporter is implemented by backends that can tell how full their storage is
+type CapacityReporter interface {
+	// capacity returns the used and total bytes of the storage holding the blobs
+	Capacity(ctx context.Context) (used, total uint64, err error)
+}
+
+// new creates the backend selected by cfg.Backend
+func New(ctx context.Context, cfg config.StorageConfig) (Backend, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocalBackend(cfg.UploadDir)
+	case "s3":
+		return NewS3Backend(ctx, cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"konbi/internal/config"
 	"konbi/internal/handlers"
+	"konbi/internal/mail"
 	"konbi/internal/middleware"
+	"konbi/internal/models"
 	"konbi/internal/repository"
 	"konbi/internal/services"
+	"konbi/internal/storage"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -41,7 +45,7 @@ func main() {
 	// initialize database
 	ctx := context.Background()
 	dbManager := repository.NewDBManager(logger)
-	db, err := dbManager.Initialize(ctx, cfg.Database.URL)
+	db, dialect, err := dbManager.Initialize(ctx, cfg.Database.URL)
 	if err != nil {
 		logger.WithError(err).Fatal("failed to initialize database")
 	}
@@ -54,44 +58,196 @@ func main() {
 		int(cfg.Database.ConnMaxLife.Minutes()),
 	)
 
+	// "konbi migrate ..." manages the schema and exits without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(ctx, dbManager, os.Args[2:]); err != nil {
+			logger.WithError(err).Fatal("migrate command failed")
+		}
+		return
+	}
+
 	// run database migrations
 	if err := dbManager.RunMigrations(ctx); err != nil {
 		logger.WithError(err).Fatal("failed to run migrations")
 	}
 
-	// ensure uploads directory exists
-	if err := os.MkdirAll(cfg.Storage.UploadDir, 0755); err != nil {
-		logger.WithError(err).Fatal("failed to create uploads directory")
+	// "konbi promote <email> [role]" sets an account's role, e.g. to bootstrap the first admin
+	if len(os.Args) > 1 && os.Args[1] == "promote" {
+		if err := runPromoteCommand(ctx, repository.NewUserRepository(db, dialect, logger), os.Args[2:]); err != nil {
+			logger.WithError(err).Fatal("promote command failed")
+		}
+		return
+	}
+
+	// initialize blob storage
+	store, err := storage.New(ctx, cfg.Storage)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to initialize storage")
 	}
+	logger.WithField("backend", cfg.Storage.Backend).Info("storage initialized")
 
 	// initialize repositories
-	contentRepo := repository.NewContentRepository(db, logger)
-	userRepo := repository.NewUserRepository(db, logger)
+	contentRepo := repository.NewContentRepository(db, dialect, logger)
+	userRepo := repository.NewUserRepository(db, dialect, logger)
+	uploadSessionRepo := repository.NewUploadSessionRepository(db, dialect, logger)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db, dialect, logger)
+	userTokenRepo := repository.NewUserTokenRepository(db, dialect, logger)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepository(db, dialect, logger)
+	apiKeyRepo := repository.NewAPIKeyRepository(db, dialect, logger)
+	identityRepo := repository.NewIdentityRepository(db, dialect, logger)
+	oidcStateRepo := repository.NewOIDCStateRepository(db, dialect, logger)
+	auditRepo := repository.NewAuditRepository(db, dialect, logger)
+
+	// revoked access tokens live in the database unless a single instance opts for memory
+	var revocations services.RevocationStore = repository.NewRevokedTokenRepository(db, dialect, logger)
+	if cfg.Security.RevocationStore == "memory" {
+		revocations = services.NewMemoryRevocationStore()
+	}
+
+	// failed login and passcode attempts are counted in the database unless a single instance opts for memory
+	var attempts services.AttemptStore = repository.NewAttemptRepository(db, dialect, logger)
+	if cfg.Security.AttemptStore == "memory" {
+		attempts = services.NewMemoryAttemptStore()
+	}
+	throttle := services.NewThrottle(attempts, cfg.Security, logger)
+
+	// load token signing keys
+	signingKeys, err := services.LoadSigningKeys(cfg.Server)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to load signing keys")
+	}
+
+	// initialize mailer
+	mailer, err := mail.New(cfg.Mail, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to initialize mailer")
+	}
+	logger.WithField("backend", cfg.Mail.Backend).Info("mailer initialized")
 
 	// initialize services
-	contentService := services.NewContentService(contentRepo, cfg, logger)
-	authService := services.NewAuthService(userRepo, cfg, logger)
+	auditLogger := services.NewAuditLogger(auditRepo, cfg, logger)
+	quota := services.NewQuota(userRepo, contentRepo, store, cfg, logger)
+	contentService := services.NewContentService(contentRepo, store, throttle, quota, auditLogger, cfg, logger)
+	authService := services.NewAuthService(userRepo, refreshTokenRepo, userTokenRepo, recoveryCodeRepo, revocations, signingKeys, throttle, mailer, auditLogger, cfg, logger)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, logger)
+	oidcService := services.NewOIDCService(userRepo, identityRepo, oidcStateRepo, authService, cfg, logger)
+	accountService := services.NewAccountService(userRepo, refreshTokenRepo, authService, contentService, logger)
+	adminService := services.NewAdminService(contentRepo, userRepo, refreshTokenRepo, contentService, quota, authService, accountService, auditLogger, logger)
+	uploadSessionService := services.NewUploadSessionService(uploadSessionRepo, store, contentService, cfg, logger)
 
 	// initialize handlers
 	contentHandler := handlers.NewContentHandler(contentService, logger)
 	authHandler := handlers.NewAuthHandler(authService, logger)
+	accountHandler := handlers.NewAccountHandler(accountService, logger)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService, logger)
+	oidcHandler := handlers.NewOIDCHandler(oidcService, cfg, logger)
+	adminHandler := handlers.NewAdminHandler(adminService, logger)
+	uploadSessionHandler := handlers.NewUploadSessionHandler(uploadSessionService, logger)
 
 	// initialize middlewares
 	loggerMiddleware := middleware.NewLoggerMiddleware(logger)
 	rateLimiter := middleware.NewRateLimiter(cfg.Security.RateLimitPerSec, cfg.Security.RateLimitBurst, logger)
-	adminAuth := middleware.NewAdminAuth(cfg, logger)
-	jwtAuth := middleware.NewJWTAuth(authService, logger)
+	jwtAuth := middleware.NewJWTAuth(authService, apiKeyService, revocations, logger)
+	adminAuth := middleware.NewAdminAuth(cfg, jwtAuth, authService, auditLogger, logger)
 
 	// setup router
-	r := setupRouter(db, cfg, contentHandler, authHandler, loggerMiddleware, rateLimiter, adminAuth, jwtAuth)
+	r := setupRouter(db, cfg, contentHandler, authHandler, accountHandler, apiKeyHandler, oidcHandler, adminHandler, uploadSessionHandler, loggerMiddleware, rateLimiter, adminAuth, jwtAuth)
+
+	// client IPs key rate limits and anonymous quotas, so X-Forwarded-For is
+	// only read from requests that arrive through a configured proxy
+	var trustedProxies []string
+	if proxies := splitAndTrim(cfg.Server.TrustedProxies, ","); len(proxies) > 0 {
+		trustedProxies = proxies
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		logger.WithError(err).Fatal("invalid TRUSTED_PROXIES")
+	}
 
 	// start cleanup routine
-	go startCleanupRoutine(contentService, logger)
+	go startCleanupRoutine(contentService, uploadSessionService, authService, oidcService, auditLogger, throttle, logger)
 
 	// start server with graceful shutdown
 	startServer(r, cfg, logger)
 }
 
+// run migrate command handles "migrate status", "migrate up" and "migrate down [steps]"
+func runMigrateCommand(ctx context.Context, dbManager *repository.DBManager, args []string) error {
+	migrator, err := dbManager.NewMigrator()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return fmt.Errorf("usage: konbi migrate status|up|down [steps]")
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-30s %s\n", s.Version, s.Name, applied)
+		}
+	case "up":
+		count, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s)\n", count)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("steps must be a positive number")
+			}
+		}
+		count, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migration(s)\n", count)
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected status, up or down)", args[0])
+	}
+	return nil
+}
+
+// run promote command handles "promote <email> [role]"; the role defaults to admin
+func runPromoteCommand(ctx context.Context, userRepo *repository.UserRepository, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: konbi promote <email> [user|moderator|admin]")
+	}
+
+	role := models.RoleAdmin
+	if len(args) == 2 {
+		role = args[1]
+	}
+	if !models.ValidRole(role) {
+		return fmt.Errorf("unknown role %q (expected user, moderator or admin)", role)
+	}
+
+	user, err := userRepo.GetByEmail(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("no account with email %q", args[0])
+	}
+
+	if err := userRepo.UpdateRole(ctx, user.ID, role); err != nil {
+		return err
+	}
+	fmt.Printf("%s is now %s (was %s)\n", user.Email, role, user.Role)
+	return nil
+}
+
 // setup logger configures structured logging
 func setupLogger() *logrus.Logger {
 	logger := logrus.New()
@@ -118,6 +274,11 @@ func setupRouter(
 	cfg *config.Config,
 	contentHandler *handlers.ContentHandler,
 	authHandler *handlers.AuthHandler,
+	accountHandler *handlers.AccountHandler,
+	apiKeyHandler *handlers.APIKeyHandler,
+	oidcHandler *handlers.OIDCHandler,
+	adminHandler *handlers.AdminHandler,
+	uploadSessionHandler *handlers.UploadSessionHandler,
 	loggerMiddleware *middleware.LoggerMiddleware,
 	rateLimiter *middleware.RateLimiter,
 	adminAuth *middleware.AdminAuth,
@@ -146,19 +307,22 @@ func setupRouter(
 		}
 		corsConfig.AllowOrigins = origins
 	}
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Content-Length", "Accept", "X-Admin-Secret", "Authorization"}
+	corsConfig.AllowMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Content-Length", "Accept", "X-Admin-Secret", "X-Passcode", "X-Management-Token", "X-Upload-Token", "Authorization", "Upload-Offset", "Upload-Length", "Range", "If-Range", "If-None-Match"}
+	corsConfig.ExposeHeaders = []string{"Location", "Upload-Offset", "Upload-Length", "Content-Range", "Accept-Ranges", "ETag", "Content-Disposition"}
 	corsConfig.AllowCredentials = true
 	r.Use(cors.New(corsConfig))
 
 	// global middleware
 	r.Use(loggerMiddleware.Middleware())
 	r.Use(rateLimiter.Middleware())
-	r.Use(middleware.Timeout(30 * time.Second))
+	// streamed uploads, chunks and completions of large resumable uploads legitimately run longer
+	r.Use(middleware.Timeout(30*time.Second, "/api/upload", "/api/bundle", "/api/uploads"))
 
 	// public routes
 	r.GET("/", handlers.Root)
 	r.GET("/health", handlers.HealthCheck(db))
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
 
 	// api routes
 	api := r.Group("/api")
@@ -168,34 +332,97 @@ func setupRouter(
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/login/mfa", authHandler.LoginMFA)
 			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/verify", authHandler.VerifyEmail)
+			auth.POST("/verify/resend", authHandler.ResendVerification)
+			auth.POST("/forgot", authHandler.ForgotPassword)
+			auth.POST("/reset", authHandler.ResetPassword)
+			auth.GET("/oidc/providers", oidcHandler.Providers)
+			auth.GET("/oidc/:provider/login", oidcHandler.Login)
+			auth.POST("/oidc/callback", oidcHandler.Callback)
 			auth.GET("/me", jwtAuth.Middleware(), authHandler.Me)
 			auth.DELETE("/logout", jwtAuth.Middleware(), authHandler.Logout)
+			auth.GET("/sessions", jwtAuth.Middleware(), authHandler.ListSessions)
+			auth.DELETE("/sessions", jwtAuth.Middleware(), authHandler.RevokeAllSessions)
+			auth.DELETE("/sessions/:id", jwtAuth.Middleware(), authHandler.RevokeSession)
 		}
 
-		// content routes
-		api.POST("/upload", contentHandler.Upload)
-		api.POST("/note", contentHandler.Note)
-		api.POST("/bundle", contentHandler.Bundle)
+		// account routes (authenticated)
+		account := api.Group("/account", jwtAuth.Middleware())
+		{
+			account.PUT("/password", accountHandler.ChangePassword)
+			account.PUT("/email", accountHandler.ChangeEmail)
+			account.DELETE("", accountHandler.DeleteAccount)
+			account.POST("/2fa/totp", accountHandler.EnrollTOTP)
+			account.POST("/2fa/totp/activate", accountHandler.ActivateTOTP)
+			account.DELETE("/2fa/totp", accountHandler.DisableTOTP)
+			account.POST("/2fa/recovery-codes", accountHandler.RegenerateRecoveryCodes)
+			account.POST("/api-keys", apiKeyHandler.Create)
+			account.GET("/api-keys", apiKeyHandler.List)
+			account.DELETE("/api-keys/:id", apiKeyHandler.Revoke)
+		}
+
+		// content routes; api keys with the matching scope are accepted where allowed
+		upload := jwtAuth.AllowAPIKey(models.APIKeyScopeUpload)
+		api.POST("/upload", upload, jwtAuth.Optional(), contentHandler.Upload)
+		api.POST("/note", upload, jwtAuth.Optional(), contentHandler.Note)
+		api.POST("/bundle", upload, jwtAuth.Optional(), contentHandler.Bundle)
 		api.GET("/content/:id", contentHandler.GetContent)
+		api.PATCH("/content/:id", jwtAuth.Optional(), contentHandler.Update)
+		api.DELETE("/content/:id", jwtAuth.AllowAPIKey(models.APIKeyScopeDelete), jwtAuth.Optional(), contentHandler.Delete)
+		api.GET("/code/:code", contentHandler.GetByCode)
 		api.GET("/content/:id/download", contentHandler.Download)
+		api.HEAD("/content/:id/download", contentHandler.Download)
 		api.GET("/content/:id/zip", contentHandler.BundleZip)
 		api.POST("/content/:id/unlock", contentHandler.Unlock)
 		api.GET("/stats/:id", contentHandler.GetStats)
 
-		// admin routes
+		// owner routes
+		api.GET("/me/content", jwtAuth.AllowAPIKey(models.APIKeyScopeRead), jwtAuth.Middleware(), contentHandler.ListMine)
+
+		// resumable upload routes
+		api.POST("/uploads", upload, jwtAuth.Optional(), uploadSessionHandler.Create)
+		api.HEAD("/uploads/:id", uploadSessionHandler.Head)
+		api.GET("/uploads/:id", uploadSessionHandler.Get)
+		api.PATCH("/uploads/:id", uploadSessionHandler.Patch)
+		api.POST("/uploads/:id/complete", uploadSessionHandler.Complete)
+		api.DELETE("/uploads/:id", uploadSessionHandler.Delete)
+
+		// admin routes; moderators may do anything short of permanent deletion
 		admin := api.Group("/admin")
-		admin.Use(adminAuth.Middleware())
+		admin.Use(adminAuth.Require(models.RoleModerator))
 		{
-			admin.GET("/list", contentHandler.ListAdmin)
+			requireAdmin := adminAuth.Require(models.RoleAdmin)
+			admin.GET("/list", adminHandler.ListContent) // older name of GET /content
+			admin.GET("/content", adminHandler.ListContent)
+			admin.DELETE("/content/:id", adminHandler.DeleteContent)
+			admin.POST("/content/:id/restore", adminHandler.RestoreContent)
+			admin.DELETE("/content/:id/purge", requireAdmin, adminHandler.PurgeContent)
+			admin.POST("/content/bulk/delete", adminHandler.BulkDeleteContent)
+			admin.POST("/content/bulk/restore", adminHandler.BulkRestoreContent)
+			admin.POST("/content/bulk/purge", requireAdmin, adminHandler.BulkPurgeContent)
+
+			admin.GET("/audit", requireAdmin, adminHandler.ListAudit)
+
+			users := admin.Group("/users", requireAdmin)
+			users.GET("", adminHandler.ListUsers)
+			users.GET("/:id", adminHandler.GetUser)
+			users.GET("/:id/content", adminHandler.ListUserContent)
+			users.POST("/:id/disable", adminHandler.DisableUser)
+			users.POST("/:id/enable", adminHandler.EnableUser)
+			users.POST("/:id/password-reset", adminHandler.ForcePasswordReset)
+			users.PUT("/:id/quota", adminHandler.SetQuota)
+			users.DELETE("/:id", adminHandler.DeleteUser)
 		}
 	}
 
 	return r
 }
 
-// start cleanup routine runs periodic cleanup of expired content
-func startCleanupRoutine(service *services.ContentService, logger *logrus.Logger) {
+// start cleanup routine runs periodic cleanup of expired content, abandoned uploads, refresh tokens
+// and audit events past their retention
+func startCleanupRoutine(service *services.ContentService, uploadSessionService *services.UploadSessionService, authService *services.AuthService, oidcService *services.OIDCService, auditLogger *services.AuditLogger, throttle *services.Throttle, logger *logrus.Logger) {
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
 
@@ -209,6 +436,48 @@ func startCleanupRoutine(service *services.ContentService, logger *logrus.Logger
 		} else {
 			logger.WithField("deleted_count", count).Info("cleanup routine completed")
 		}
+
+		sessions, err := uploadSessionService.CleanupExpired(ctx)
+		if err != nil {
+			logger.WithError(err).Error("upload session cleanup failed")
+		} else {
+			logger.WithField("removed_sessions", sessions).Info("upload session cleanup completed")
+		}
+
+		tokens, err := authService.CleanupExpired(ctx)
+		if err != nil {
+			logger.WithError(err).Error("auth token cleanup failed")
+		} else {
+			logger.WithField("removed_tokens", tokens).Info("auth token cleanup completed")
+		}
+
+		states, err := oidcService.CleanupExpired(ctx)
+		if err != nil {
+			logger.WithError(err).Error("oidc state cleanup failed")
+		} else {
+			logger.WithField("removed_states", states).Info("oidc state cleanup completed")
+		}
+
+		pruned, err := authService.PruneRevocations(ctx)
+		if err != nil {
+			logger.WithError(err).Error("revoked token pruning failed")
+		} else {
+			logger.WithField("pruned_revocations", pruned).Info("revoked token pruning completed")
+		}
+
+		forgotten, err := throttle.Prune(ctx)
+		if err != nil {
+			logger.WithError(err).Error("failed attempt pruning failed")
+		} else {
+			logger.WithField("pruned_attempts", forgotten).Info("failed attempt pruning completed")
+		}
+
+		events, err := auditLogger.Prune(ctx)
+		if err != nil {
+			logger.WithError(err).Error("audit log pruning failed")
+		} else {
+			logger.WithField("pruned_audit_events", events).Info("audit log pruning completed")
+		}
 	}
 }
 
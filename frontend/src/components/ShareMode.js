@@ -108,8 +108,9 @@ function ShareMode() {
       setUploadProgress(0);
 
       const formData = new FormData();
-      formData.append('file', file);
+      // fields go before the file: the server streams the upload and reads parts in order
       if (passcode.trim()) formData.append('passcode', passcode.trim());
+      formData.append('file', file);
 
       try {
         const response = await axios.post(`${API_URL}/upload`, formData, {
@@ -146,8 +147,8 @@ function ShareMode() {
 
       setUploadProgress(0);
       const formData = new FormData();
-      files.forEach(f => formData.append('files', f));
       if (passcode.trim()) formData.append('passcode', passcode.trim());
+      files.forEach(f => formData.append('files', f));
 
       try {
         const response = await axios.post(`${API_URL}/bundle`, formData, {